@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func getAuditCmd() *cobra.Command {
+	var auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Query the audit journal of issued, signed and revoked certificates",
+		Run:   auditEntryPoint,
+	}
+
+	auditCmd.Flags().StringP(conf.FLAG_AUDIT_CN, "", "", "Only show records for this common name")
+	auditCmd.Flags().StringP(conf.FLAG_AUDIT_SERIAL, "", "", "Only show records for this serial")
+	auditCmd.Flags().StringP(conf.FLAG_AUDIT_SINCE, "", "", "Only show records after this point in time, either RFC3339 or a duration relative to now, e.g. '720h'")
+	auditCmd.Flags().StringP(conf.FLAG_AUDIT_UNTIL, "", "", "Only show records before this point in time, either RFC3339 or a duration relative to now")
+	auditCmd.Flags().BoolP(conf.FLAG_AUDIT_JSON, "", false, "Print the records as JSON lines")
+
+	return auditCmd
+}
+
+func auditEntryPoint(_ *cobra.Command, _ []string) {
+	config, err := config()
+	DieOnErr(err, "could not get config")
+
+	if len(config.AuditJournal) == 0 {
+		DieOnErr(fmt.Errorf("no '%s' configured", conf.FLAG_AUDIT_JOURNAL), "can not query audit journal")
+	}
+
+	journal, err := buildAuditJournal(config)
+	DieOnErr(err, "could not build audit journal")
+
+	filter := audit.Filter{
+		CommonName: viper.GetString(conf.FLAG_AUDIT_CN),
+		Serial:     viper.GetString(conf.FLAG_AUDIT_SERIAL),
+	}
+	filter.Since, err = parseTimeArg(viper.GetString(conf.FLAG_AUDIT_SINCE))
+	DieOnErr(err, fmt.Sprintf("invalid value for '%s'", conf.FLAG_AUDIT_SINCE))
+	filter.Until, err = parseTimeArg(viper.GetString(conf.FLAG_AUDIT_UNTIL))
+	DieOnErr(err, fmt.Sprintf("invalid value for '%s'", conf.FLAG_AUDIT_UNTIL))
+
+	records, err := journal.Query(filter)
+	DieOnErr(err, "could not query audit journal")
+
+	if viper.GetBool(conf.FLAG_AUDIT_JSON) {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, record := range records {
+			DieOnErr(encoder.Encode(record), "could not print record")
+		}
+		return
+	}
+
+	printAuditRecords(records)
+}
+
+func buildAuditJournal(config *conf.Config) (*audit.Journal, error) {
+	var opts []audit.JournalOpt
+	if config.AuditMaxSize > 0 {
+		opts = append(opts, audit.WithMaxSize(config.AuditMaxSize))
+	}
+	opts = append(opts, audit.WithMaxBackups(config.AuditMaxBackups))
+
+	return audit.NewJournal(expandPath(config.AuditJournal), opts...)
+}
+
+// parseTimeArg parses either a RFC3339 timestamp or a duration that is subtracted from the current time.
+func parseTimeArg(arg string) (time.Time, error) {
+	if len(arg) == 0 {
+		return time.Time{}, nil
+	}
+
+	if ts, err := time.Parse(time.RFC3339, arg); err == nil {
+		return ts, nil
+	}
+
+	duration, err := time.ParseDuration(arg)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' is neither a RFC3339 timestamp nor a duration", arg)
+	}
+
+	return time.Now().Add(-duration), nil
+}
+
+func printAuditRecords(records []audit.Record) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIME\tOPERATION\tOUTCOME\tCN\tSERIAL\tNOT AFTER\tSANS\tERROR")
+	for _, record := range records {
+		notAfter := "-"
+		if record.NotAfter != nil {
+			notAfter = record.NotAfter.Format(time.RFC3339)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Time.Format(time.RFC3339),
+			record.Operation,
+			record.Outcome,
+			orDash(record.CommonName),
+			orDash(record.Serial),
+			notAfter,
+			orDash(strings.Join(record.Sans, ",")),
+			orDash(record.ErrorLabel))
+	}
+	_ = writer.Flush()
+}
+
+func orDash(val string) string {
+	if len(val) == 0 {
+		return "-"
+	}
+	return val
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/control"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+func getControlCmd() *cobra.Command {
+	var controlCmd = &cobra.Command{
+		Use:   "control",
+		Short: "Control a running 'issue' daemon via its control api",
+	}
+
+	controlCmd.PersistentFlags().StringP(conf.FLAG_CONTROL_ADDR, "", "", "Address of the control api, either 'unix:/path/to/socket' or a loopback address")
+	controlCmd.PersistentFlags().StringP(conf.FLAG_CONTROL_TOKEN_FILE, "", "", "File containing the token to authenticate against the control api")
+
+	renewCmd := &cobra.Command{
+		Use:   "renew",
+		Short: "Force the renewal of a certificate and wait for the result",
+		Run: func(_ *cobra.Command, _ []string) {
+			client, config := buildControlClient()
+			if len(config.CommonName) == 0 {
+				DieOnErr(fmt.Errorf("no '%s' specified", conf.FLAG_ISSUE_COMMON_NAME), "can not renew certificate")
+			}
+			result, err := client.Renew(context.Background(), config.CommonName)
+			DieOnErr(err, "renewal request failed")
+			printControlResult(result)
+		},
+	}
+	renewCmd.Flags().StringP(conf.FLAG_ISSUE_COMMON_NAME, "", "", "Common name of the certificate to renew")
+
+	refreshCrlCmd := &cobra.Command{
+		Use:   "refresh-crl",
+		Short: "Check the certificate against a freshly fetched CRL and wait for the result",
+		Run: func(_ *cobra.Command, _ []string) {
+			client, _ := buildControlClient()
+			result, err := client.RefreshCrl(context.Background())
+			if errors.Is(err, control.ErrNotSupported) {
+				DieOnErr(fmt.Errorf("daemon does not run with '--%s'", conf.FLAG_ISSUE_CHECK_REVOCATION), "refreshing crl failed")
+			}
+			DieOnErr(err, "refreshing crl failed")
+			printControlResult(result)
+		},
+	}
+
+	pauseCmd := &cobra.Command{
+		Use:   "pause",
+		Short: "Pause scheduled renewals",
+		Run: func(_ *cobra.Command, _ []string) {
+			client, _ := buildControlClient()
+			queue, err := client.Pause(context.Background())
+			DieOnErr(err, "pausing renewals failed")
+			printJson(queue)
+		},
+	}
+
+	resumeCmd := &cobra.Command{
+		Use:   "resume",
+		Short: "Resume scheduled renewals",
+		Run: func(_ *cobra.Command, _ []string) {
+			client, _ := buildControlClient()
+			queue, err := client.Resume(context.Background())
+			DieOnErr(err, "resuming renewals failed")
+			printJson(queue)
+		},
+	}
+
+	queueCmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Show the scheduled renewals and pending revocations",
+		Run: func(_ *cobra.Command, _ []string) {
+			client, _ := buildControlClient()
+			queue, err := client.Queue(context.Background())
+			DieOnErr(err, "reading queue failed")
+			printJson(queue)
+		},
+	}
+
+	controlCmd.AddCommand(renewCmd, refreshCrlCmd, pauseCmd, resumeCmd, queueCmd)
+	return controlCmd
+}
+
+func buildControlClient() (*control.Client, *conf.Config) {
+	config, err := config()
+	DieOnErr(err, "could not get config")
+
+	if len(config.ControlAddr) == 0 {
+		DieOnErr(fmt.Errorf("no '%s' specified", conf.FLAG_CONTROL_ADDR), "can not build control client")
+	}
+
+	token, err := control.ReadToken(expandPath(config.ControlTokenFile))
+	DieOnErr(err, "can not build control client")
+
+	client, err := control.NewClient(config.ControlAddr, token)
+	DieOnErr(err, "can not build control client")
+
+	return client, config
+}
+
+func printControlResult(result control.Result) {
+	printJson(result)
+	if len(result.Error) > 0 {
+		os.Exit(1)
+	}
+}
+
+func printJson(val any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	DieOnErr(encoder.Encode(val), "could not print result")
+}
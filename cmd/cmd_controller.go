@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/controller"
+	"github.com/soerenschneider/vault-pki-cli/internal/leader"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+func getControllerCmd() *cobra.Command {
+	var controllerCmd = &cobra.Command{
+		Use:   "controller",
+		Short: "Issue and renew certificates stored in annotated Kubernetes Secrets and ConfigMaps",
+		Long: "Watches Secrets and ConfigMaps carrying the annotation '" + controller.AnnotationCommonName + "' and issues " +
+			"certificates into them. The request is refined using the annotations '" + controller.AnnotationAltNames + "', '" +
+			controller.AnnotationIpSans + "', '" + controller.AnnotationTtl + "' and '" + controller.AnnotationRole + "'.",
+		Run: controllerEntryPoint,
+	}
+
+	controllerCmd.Flags().StringP(conf.FLAG_CONTROLLER_NAMESPACE, "", "", "Only watch objects in this namespace, defaults to all namespaces")
+	controllerCmd.Flags().StringSlice(conf.FLAG_CONTROLLER_KINDS, conf.FLAG_CONTROLLER_KINDS_DEFAULT, "Kinds of objects to watch, 'secret' and/or 'configmap'")
+	controllerCmd.Flags().Int(conf.FLAG_CONTROLLER_WORKERS, conf.FLAG_CONTROLLER_WORKERS_DEFAULT, "Number of objects to reconcile in parallel")
+	controllerCmd.Flags().Duration(conf.FLAG_CONTROLLER_RESYNC_INTERVAL, conf.FLAG_CONTROLLER_RESYNC_INTERVAL_DEFAULT, "Interval to check certificates for renewal")
+	controllerCmd.Flags().StringSlice(conf.FLAG_CONTROLLER_ALLOWED_ROLES, []string{}, "Roles that may be requested using the role annotation, defaults to all roles")
+	controllerCmd.Flags().Float64P(conf.FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE, "", conf.FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE_DEFAULT, "Create new certificate when a given threshold of its overall lifetime has been reached")
+	controllerCmd.Flags().BoolP(conf.FLAG_ISSUE_CHECK_REVOCATION, "", conf.FLAG_ISSUE_CHECK_REVOCATION_DEFAULT, "Issue a new certificate if the current certificate is listed on the CRL")
+	controllerCmd.Flags().StringP(conf.FLAG_ISSUE_METRICS_ADDR, "", conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT, "Address to serve metrics on")
+	controllerCmd.Flags().BoolP(conf.FLAG_LEADER_ELECTION, "", false, "Only reconcile objects while holding a Kubernetes Lease, allowing to run multiple replicas of the controller")
+	controllerCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_NAMESPACE, "", "", "Namespace of the Lease, defaults to the namespace of the pod")
+	controllerCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_LEASE_NAME, "", conf.FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT, "Name of the Lease")
+	controllerCmd.Flags().Duration(conf.FLAG_LEADER_ELECTION_LEASE_DURATION, conf.FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT, "Time after which a follower takes over a Lease that has not been renewed")
+	controllerCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_IDENTITY, "", "", "Identity of this replica, defaults to the hostname")
+
+	viper.SetDefault(conf.FLAG_CONTROLLER_KINDS, conf.FLAG_CONTROLLER_KINDS_DEFAULT)
+	viper.SetDefault(conf.FLAG_CONTROLLER_WORKERS, conf.FLAG_CONTROLLER_WORKERS_DEFAULT)
+	viper.SetDefault(conf.FLAG_CONTROLLER_RESYNC_INTERVAL, conf.FLAG_CONTROLLER_RESYNC_INTERVAL_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE, conf.FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_METRICS_ADDR, conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT)
+	viper.SetDefault(conf.FLAG_LEADER_ELECTION_LEASE_NAME, conf.FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT)
+	viper.SetDefault(conf.FLAG_LEADER_ELECTION_LEASE_DURATION, conf.FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT)
+
+	return controllerCmd
+}
+
+func controllerEntryPoint(_ *cobra.Command, _ []string) {
+	PrintVersionInfo()
+	config, err := config()
+	DieOnErr(err, "could not get config")
+	config.Print()
+
+	err = config.ValidateController()
+	DieOnErr(err, "invalid config", config)
+
+	storage.InitBuilder(config)
+	builder, err := storage.GetBuilder()
+	DieOnErr(err, "could not get storage builder", config)
+	client, err := builder.KubernetesClient()
+	DieOnErr(err, "could not build kubernetes client", config)
+
+	services, err := buildServiceFactory(config)
+	DieOnErr(err, "could not build pki service", config)
+
+	opts := []controller.ControllerOpts{
+		controller.WithNamespace(config.ControllerNamespace),
+		controller.WithKinds(config.ControllerKinds...),
+	}
+	if config.ControllerWorkers > 0 {
+		opts = append(opts, controller.WithWorkers(config.ControllerWorkers))
+	}
+	if config.ControllerResyncInterval > 0 {
+		opts = append(opts, controller.WithResyncInterval(config.ControllerResyncInterval))
+	}
+	if len(config.ControllerAllowedRoles) > 0 {
+		opts = append(opts, controller.WithAllowedRoles(config.ControllerAllowedRoles...))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var elector *leader.Elector
+	if config.LeaderElection {
+		elector, err = buildElector(config)
+		DieOnErr(err, "could not build leader election", config)
+		opts = append(opts, controller.WithLeaderCheck(elector.IsLeader))
+	}
+
+	ctrl, err := controller.NewController(client, services, opts...)
+	DieOnErr(err, "could not build controller", config)
+
+	var electorDone <-chan struct{}
+	if elector != nil {
+		electorDone = startLeaderElection(ctx, config, elector, ctrl.Resync)
+	}
+
+	startMetricsServer(config)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Info().Msgf("got interrupt")
+		cancel()
+	}()
+
+	err = ctrl.Run(ctx)
+	waitForLeaseRelease(electorDone)
+	DieOnErr(err, "could not run controller", config)
+}
+
+// buildServiceFactory logs in to Vault once and returns a factory that builds a PkiService for each role that is
+// requested via annotations.
+func buildServiceFactory(config *conf.Config) (controller.ServiceFactory, error) {
+	vaultClient, err := buildLoggedInVaultClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(role string) (*pki.PkiService, error) {
+		roleConfig := *config
+		if len(role) > 0 {
+			roleConfig.VaultPkiRole = role
+		}
+		return buildPkiService(&roleConfig, vaultClient)
+	}, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/leader"
+	"github.com/soerenschneider/vault-pki-cli/internal/signer"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/soerenschneider/vault-pki-cli/pkg/vault"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	certificatesv1 "k8s.io/api/certificates/v1"
+)
+
+func getCsrSignerCmd() *cobra.Command {
+	var signerCmd = &cobra.Command{
+		Use:   "csr-signer",
+		Short: "Sign Kubernetes CertificateSigningRequests using Vault",
+		Long: "Watches CertificateSigningRequests of the certificates.k8s.io API that are addressed to the configured " +
+			"signer name and signs them once they are approved. Optionally approves CSRs that comply with the policy.",
+		Run: csrSignerEntryPoint,
+	}
+
+	defaultUsages := make([]string, 0, len(signer.DefaultAllowedUsages))
+	for _, usage := range signer.DefaultAllowedUsages {
+		defaultUsages = append(defaultUsages, string(usage))
+	}
+
+	signerCmd.Flags().StringP(conf.FLAG_SIGNER_NAME, "", "", "Sign CSRs with this signer name, e.g. 'example.com/vault'")
+	signerCmd.Flags().BoolP(conf.FLAG_SIGNER_AUTO_APPROVE, "", false, "Approve CSRs that comply with the policy and deny all others")
+	signerCmd.Flags().StringSlice(conf.FLAG_SIGNER_ALLOWED_USAGES, defaultUsages, "Key usages CSRs may request")
+	signerCmd.Flags().StringSlice(conf.FLAG_SIGNER_ALLOWED_NAMES, []string{}, "Glob patterns the common name and all SANs of CSRs must match, a wildcard matches a single label")
+	signerCmd.Flags().StringSlice(conf.FLAG_SIGNER_ALLOWED_REQUESTERS, []string{}, "Glob patterns the user creating the CSR must match, e.g. 'system:serviceaccount:my-namespace:*'")
+	signerCmd.Flags().Int(conf.FLAG_CONTROLLER_WORKERS, conf.FLAG_CONTROLLER_WORKERS_DEFAULT, "Number of CSRs to handle in parallel")
+	signerCmd.Flags().StringP(conf.FLAG_ISSUE_METRICS_ADDR, "", conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT, "Address to serve metrics on")
+	signerCmd.Flags().BoolP(conf.FLAG_LEADER_ELECTION, "", false, "Only sign CSRs while holding a Kubernetes Lease, allowing to run multiple replicas of the signer")
+	signerCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_NAMESPACE, "", "", "Namespace of the Lease, defaults to the namespace of the pod")
+	signerCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_LEASE_NAME, "", conf.FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT, "Name of the Lease")
+	signerCmd.Flags().Duration(conf.FLAG_LEADER_ELECTION_LEASE_DURATION, conf.FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT, "Time after which a follower takes over a Lease that has not been renewed")
+	signerCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_IDENTITY, "", "", "Identity of this replica, defaults to the hostname")
+
+	viper.SetDefault(conf.FLAG_SIGNER_ALLOWED_USAGES, defaultUsages)
+	viper.SetDefault(conf.FLAG_CONTROLLER_WORKERS, conf.FLAG_CONTROLLER_WORKERS_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_METRICS_ADDR, conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT)
+	viper.SetDefault(conf.FLAG_LEADER_ELECTION_LEASE_NAME, conf.FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT)
+	viper.SetDefault(conf.FLAG_LEADER_ELECTION_LEASE_DURATION, conf.FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT)
+
+	return signerCmd
+}
+
+func csrSignerEntryPoint(_ *cobra.Command, _ []string) {
+	PrintVersionInfo()
+	config, err := config()
+	DieOnErr(err, "could not get config")
+	config.Print()
+
+	err = config.ValidateSigner()
+	DieOnErr(err, "invalid config", config)
+
+	storage.InitBuilder(config)
+	builder, err := storage.GetBuilder()
+	DieOnErr(err, "could not get storage builder", config)
+	client, err := builder.KubernetesClient()
+	DieOnErr(err, "could not build kubernetes client", config)
+
+	pkiImpl, err := buildSignerPkiService(config)
+	DieOnErr(err, "could not build pki service", config)
+
+	policy := signer.Policy{
+		AllowedNames:      config.SignerAllowedNames,
+		AllowedRequesters: config.SignerAllowedRequesters,
+	}
+	for _, usage := range config.SignerAllowedUsages {
+		policy.AllowedUsages = append(policy.AllowedUsages, certificatesv1.KeyUsage(usage))
+	}
+
+	opts := []signer.SignerOpts{
+		signer.WithPolicy(policy),
+		signer.WithAutoApprove(config.SignerAutoApprove),
+	}
+	if config.ControllerWorkers > 0 {
+		opts = append(opts, signer.WithWorkers(config.ControllerWorkers))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var elector *leader.Elector
+	if config.LeaderElection {
+		elector, err = buildElector(config)
+		DieOnErr(err, "could not build leader election", config)
+		opts = append(opts, signer.WithLeaderCheck(elector.IsLeader))
+	}
+
+	csrSigner, err := signer.NewSigner(client, pkiImpl, config.SignerName, opts...)
+	DieOnErr(err, "could not build csr signer", config)
+
+	var electorDone <-chan struct{}
+	if elector != nil {
+		electorDone = startLeaderElection(ctx, config, elector, csrSigner.Resync)
+	}
+
+	startMetricsServer(config)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Info().Msgf("got interrupt")
+		cancel()
+	}()
+
+	err = csrSigner.Run(ctx)
+	waitForLeaseRelease(electorDone)
+	DieOnErr(err, "could not run csr signer", config)
+}
+
+func buildSignerPkiService(config *conf.Config) (*pki.PkiService, error) {
+	vaultClient, err := buildLoggedInVaultClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []vault.VaultOpts{
+		vault.WithPkiMount(config.VaultMountPki),
+		vault.WithKv2Mount(config.VaultMountKv2),
+		vault.WithAcmePrefix(config.AcmePrefix),
+	}
+
+	vaultBackend, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't build vault pki: %w", err)
+	}
+
+	observers, err := buildObservers(config, audit.OperationSign)
+	if err != nil {
+		return nil, fmt.Errorf("can't build observers: %w", err)
+	}
+
+	return pki.NewPkiService(vaultBackend, nil, observers...)
+}
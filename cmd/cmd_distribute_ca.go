@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/cabundle"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg/vault"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+func getDistributeCaCmd() *cobra.Command {
+	var distributeCmd = &cobra.Command{
+		Use:   "distribute-ca",
+		Short: "Distribute the pki ca chain to ConfigMaps in many namespaces",
+		Long: "Reads the ca chain from vault and writes it to a ConfigMap in each namespace matching the label selector. " +
+			"The bundle is removed from namespaces that stop matching. In daemon mode, new and relabeled namespaces " +
+			"are handled right away and the chain is read again periodically.",
+		Run: distributeCaEntryPoint,
+	}
+
+	distributeCmd.Flags().StringP(conf.FLAG_CA_BUNDLE_NAMESPACE_SELECTOR, "", "", "Label selector of the namespaces to distribute the bundle to, defaults to all namespaces")
+	distributeCmd.Flags().StringP(conf.FLAG_CA_BUNDLE_CONFIGMAP_NAME, "", conf.FLAG_CA_BUNDLE_CONFIGMAP_NAME_DEFAULT, "Name of the ConfigMap to write the bundle to")
+	distributeCmd.Flags().StringP(conf.FLAG_CA_BUNDLE_KEY, "", conf.FLAG_CA_BUNDLE_KEY_DEFAULT, "Key in the ConfigMap to write the bundle to")
+	distributeCmd.Flags().Duration(conf.FLAG_CA_BUNDLE_REFRESH_INTERVAL, conf.FLAG_CA_BUNDLE_REFRESH_INTERVAL_DEFAULT, "Interval to read the ca chain again in daemon mode")
+	distributeCmd.Flags().BoolP(conf.FLAG_ISSUE_DAEMONIZE, "", conf.FLAG_ISSUE_DAEMONIZE_DEFAULT, "Run as daemon, watching namespaces")
+	distributeCmd.Flags().StringP(conf.FLAG_ISSUE_METRICS_ADDR, "", conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT, "Address to serve metrics on in daemon mode")
+
+	viper.SetDefault(conf.FLAG_CA_BUNDLE_CONFIGMAP_NAME, conf.FLAG_CA_BUNDLE_CONFIGMAP_NAME_DEFAULT)
+	viper.SetDefault(conf.FLAG_CA_BUNDLE_KEY, conf.FLAG_CA_BUNDLE_KEY_DEFAULT)
+	viper.SetDefault(conf.FLAG_CA_BUNDLE_REFRESH_INTERVAL, conf.FLAG_CA_BUNDLE_REFRESH_INTERVAL_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_METRICS_ADDR, conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT)
+
+	return distributeCmd
+}
+
+func distributeCaEntryPoint(_ *cobra.Command, _ []string) {
+	PrintVersionInfo()
+	config, err := config()
+	DieOnErr(err, "could not get config")
+	config.Print()
+
+	err = config.ValidateCaBundle()
+	DieOnErr(err, "invalid config", config)
+
+	vaultClient, err := buildVaultClient(config)
+	DieOnErr(err, "could not build vault client", config)
+
+	opts := []vault.VaultOpts{
+		vault.WithPkiMount(config.VaultMountPki),
+		vault.WithKv2Mount(config.VaultMountKv2),
+		vault.WithAcmePrefix(config.AcmePrefix),
+	}
+
+	pkiImpl, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
+	DieOnErr(err, "could not build vault pki", config)
+
+	storage.InitBuilder(config)
+	builder, err := storage.GetBuilder()
+	DieOnErr(err, "could not get storage builder", config)
+	client, err := builder.KubernetesClient()
+	DieOnErr(err, "could not build kubernetes client", config)
+
+	distributorOpts := []cabundle.DistributorOpts{
+		cabundle.WithNamespaceSelector(config.CaBundleNamespaceSelector),
+		cabundle.WithConfigMapName(config.CaBundleConfigMapName),
+		cabundle.WithKey(config.CaBundleKey),
+	}
+	if config.CaBundleRefreshInterval > 0 {
+		distributorOpts = append(distributorOpts, cabundle.WithRefreshInterval(config.CaBundleRefreshInterval))
+	}
+
+	distributor, err := cabundle.NewDistributor(client, pkiImpl.FetchCaChain, distributorOpts...)
+	DieOnErr(err, "could not build ca bundle distributor", config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if !config.Daemonize {
+		err = distributor.Sync(ctx)
+		DieOnErr(err, "could not distribute ca bundle", config)
+		return
+	}
+
+	startMetricsServer(config)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Info().Msgf("got interrupt")
+		cancel()
+	}()
+
+	err = distributor.Run(ctx)
+	DieOnErr(err, "could not run ca bundle distributor", config)
+}
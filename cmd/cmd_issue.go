@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/x509"
 	"fmt"
 	"math/rand"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/hashicorp/vault/api"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/soerenschneider/vault-pki-cli/internal"
 	"github.com/soerenschneider/vault-pki-cli/internal/storage"
@@ -16,9 +18,14 @@ import (
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
 
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/hooks"
+	"github.com/soerenschneider/vault-pki-cli/internal/leader"
+	"github.com/soerenschneider/vault-pki-cli/internal/status"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
 	"github.com/soerenschneider/vault-pki-cli/pkg/renew_strategy"
+	"github.com/soerenschneider/vault-pki-cli/pkg/revocation"
 
 	log "github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -44,7 +51,28 @@ func getIssueCmd() *cobra.Command {
 	issueCmd.Flags().StringArrayP(conf.FLAG_ISSUE_ALT_NAMES, "", []string{}, "Specifies requested Subject Alternative Names, in a comma-delimited list. These can be host names or email addresses; they will be parsed into their respective fields. If any requested names do not match role policy, the entire request will be denied.")
 	issueCmd.Flags().StringSlice(conf.FLAG_ISSUE_HOOKS, []string{}, "Run commands after issuing a new certificate.")
 	issueCmd.Flags().StringSlice(conf.FLAG_ISSUE_BACKEND_CONFIG, []string{}, "Backend config.")
+	issueCmd.Flags().BoolP(conf.FLAG_STORAGE_PARALLEL_WRITES, "", false, "Write to all configured storages in parallel")
 	issueCmd.Flags().Uint64(conf.FLAG_RETRIES, conf.FLAG_RETRIES_DEFAULT, "How many retries to perform for non-permanent errors")
+	issueCmd.Flags().BoolP(conf.FLAG_ISSUE_CHECK_REVOCATION, "", conf.FLAG_ISSUE_CHECK_REVOCATION_DEFAULT, "Issue a new certificate if the current certificate is listed on the CRL")
+	issueCmd.Flags().BoolP(conf.FLAG_ISSUE_CHECK_REVOCATION_DELTA, "", false, "Merge the delta CRL into the base CRL when checking for revocation")
+	issueCmd.Flags().BoolP(conf.FLAG_ISSUE_CHECK_REVOCATION_UNIFIED, "", false, "Use the unified cross-cluster CRL when checking for revocation")
+	issueCmd.Flags().Duration(conf.FLAG_ISSUE_REVOCATION_GRACE_PERIOD, conf.FLAG_ISSUE_REVOCATION_GRACE_PERIOD_DEFAULT, "Time to wait before revoking a superseded certificate. Superseded certificates are only revoked after the post-issue hooks ran successfully.")
+	issueCmd.Flags().StringP(conf.FLAG_ISSUE_REVOCATION_QUEUE_FILE, "", "", "File to persist superseded certificates that are waiting to be revoked")
+	issueCmd.Flags().Duration(conf.FLAG_NOTIFY_EXPIRY_THRESHOLD, conf.FLAG_NOTIFY_EXPIRY_THRESHOLD_DEFAULT, "Send a notification if the certificate expires within this duration")
+	issueCmd.Flags().Int(conf.FLAG_ISSUE_PRE_HOOKS_DELAY_EXIT_CODE, conf.FLAG_ISSUE_PRE_HOOKS_DELAY_EXIT_CODE_DEFAULT, "Exit code of a pre-issue hook that delays the renewal instead of vetoing it")
+	issueCmd.Flags().Duration(conf.FLAG_ISSUE_PRE_HOOKS_RETRY_DELAY, conf.FLAG_ISSUE_PRE_HOOKS_RETRY_DELAY_DEFAULT, "Time to wait before retrying a renewal that has been delayed by a pre-issue hook")
+	issueCmd.Flags().StringP(conf.FLAG_CONTROL_ADDR, "", "", "Serve the control api on this unix socket ('unix:/path/to/socket') or loopback address in daemon mode")
+	issueCmd.Flags().StringP(conf.FLAG_CONTROL_TOKEN_FILE, "", "", "File containing the token to authenticate requests against the control api, created if it does not exist")
+	issueCmd.Flags().BoolP(conf.FLAG_LEADER_ELECTION, "", false, "Only issue certificates while holding a Kubernetes Lease, allowing to run multiple replicas of the daemon")
+	issueCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_NAMESPACE, "", "", "Namespace of the Lease, defaults to the namespace of the pod")
+	issueCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_LEASE_NAME, "", conf.FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT, "Name of the Lease")
+	issueCmd.Flags().Duration(conf.FLAG_LEADER_ELECTION_LEASE_DURATION, conf.FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT, "Time after which a follower takes over a Lease that has not been renewed")
+	issueCmd.Flags().StringP(conf.FLAG_LEADER_ELECTION_IDENTITY, "", "", "Identity of this replica, defaults to the hostname")
+	issueCmd.Flags().BoolP(conf.FLAG_WATCH_CONFIG, "", false, "Reload the config file in daemon mode when it changes, in addition to reloading on SIGHUP")
+	issueCmd.Flags().StringArray(conf.FLAG_ROLLOUT_RESTART, []string{}, "Restart workloads after issuing a new certificate, either 'kind/namespace/name' or 'kind/namespace?selector'. Supported kinds are deployment, statefulset and daemonset.")
+	issueCmd.Flags().BoolP(conf.FLAG_ROLLOUT_WAIT, "", false, "Wait for the rollout of the restarted workloads to finish")
+	issueCmd.Flags().Duration(conf.FLAG_ROLLOUT_TIMEOUT, conf.FLAG_ROLLOUT_TIMEOUT_DEFAULT, "Time to wait for the rollout of the restarted workloads to finish")
+	issueCmd.Flags().Duration(conf.FLAG_HEALTH_STALL_TIMEOUT, conf.FLAG_HEALTH_STALL_TIMEOUT_DEFAULT, "Time a scheduled run may be overdue before '/healthz' reports the daemon as unhealthy")
 
 	viper.SetDefault(conf.FLAG_ISSUE_TTL, conf.FLAG_ISSUE_TTL_DEFAULT)
 	viper.SetDefault(conf.FLAG_RETRIES, conf.FLAG_RETRIES_DEFAULT)
@@ -52,6 +80,15 @@ func getIssueCmd() *cobra.Command {
 	viper.SetDefault(conf.FLAG_ISSUE_METRICS_ADDR, conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT)
 	viper.SetDefault(conf.FLAG_METRICS_FILE, "")
 	viper.SetDefault(conf.FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE, conf.FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_CHECK_REVOCATION, conf.FLAG_ISSUE_CHECK_REVOCATION_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_REVOCATION_GRACE_PERIOD, conf.FLAG_ISSUE_REVOCATION_GRACE_PERIOD_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_PRE_HOOKS_DELAY_EXIT_CODE, conf.FLAG_ISSUE_PRE_HOOKS_DELAY_EXIT_CODE_DEFAULT)
+	viper.SetDefault(conf.FLAG_ISSUE_PRE_HOOKS_RETRY_DELAY, conf.FLAG_ISSUE_PRE_HOOKS_RETRY_DELAY_DEFAULT)
+	viper.SetDefault(conf.FLAG_NOTIFY_EXPIRY_THRESHOLD, conf.FLAG_NOTIFY_EXPIRY_THRESHOLD_DEFAULT)
+	viper.SetDefault(conf.FLAG_HEALTH_STALL_TIMEOUT, conf.FLAG_HEALTH_STALL_TIMEOUT_DEFAULT)
+	viper.SetDefault(conf.FLAG_ROLLOUT_TIMEOUT, conf.FLAG_ROLLOUT_TIMEOUT_DEFAULT)
+	viper.SetDefault(conf.FLAG_LEADER_ELECTION_LEASE_NAME, conf.FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT)
+	viper.SetDefault(conf.FLAG_LEADER_ELECTION_LEASE_DURATION, conf.FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT)
 
 	//issueCmd.MarkFlagRequired(conf.FLAG_ISSUE_COMMON_NAME)
 
@@ -70,18 +107,49 @@ func issueCertEntryPoint(_ *cobra.Command, _ []string) {
 	internal.MetricSuccess.WithLabelValues(config.CommonName).Set(0)
 	internal.MetricRunTimestamp.WithLabelValues(config.CommonName).SetToCurrentTime()
 
-	pkiImpl, sink := buildDependencies(config)
+	var opts []status.TrackerOpts
+	if config.HealthStallTimeout > 0 {
+		opts = append(opts, status.WithStallTimeout(config.HealthStallTimeout))
+	}
+	tracker, err := status.NewTracker(opts...)
+	DieOnErr(err, "could not build status tracker", config)
+
+	pkiImpl, sink, err := buildDependencies(config, tracker)
+	DieOnErr(err, "can't build dependencies", config)
+	queue, err := revocation.NewQueue(config.RevocationQueueFile)
+	DieOnErr(err, "could not build revocation queue", config)
+
 	ctx, cancel := context.WithCancel(context.Background())
-	log.Info().Msg("Conditionally issuing cert")
-	err = issueCert(ctx, config, pkiImpl, sink)
+	var elector *leader.Elector
+	if config.Daemonize && config.LeaderElection {
+		elector, err = buildElector(config)
+		DieOnErr(err, "could not build leader election", config)
+		log.Info().Msg("Leader election enabled, issuing cert after becoming the leader")
+	} else {
+		log.Info().Msg("Conditionally issuing cert")
+		_, err = issueCert(ctx, config, pkiImpl, sink, queue, false)
+	}
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	done := make(chan bool, 1)
 
+	stopped := make(chan struct{})
 	if config.Daemonize {
-		go runAsDaemon(ctx, config, pkiImpl, sink)
+		daemon := &issueDaemon{
+			config:  config,
+			pkiImpl: pkiImpl,
+			sink:    sink,
+			queue:   queue,
+			tracker: tracker,
+			elector: elector,
+		}
+		go func() {
+			defer close(stopped)
+			daemon.run(ctx)
+		}()
 	} else {
+		close(stopped)
 		done <- true
 	}
 
@@ -89,6 +157,7 @@ func issueCertEntryPoint(_ *cobra.Command, _ []string) {
 	case <-interrupt:
 		log.Info().Msgf("got interrupt")
 		cancel()
+		waitForShutdown(stopped)
 	case <-done:
 		cancel()
 	}
@@ -101,113 +170,180 @@ func issueCertEntryPoint(_ *cobra.Command, _ []string) {
 	}
 }
 
-func runAsDaemon(ctx context.Context, config *conf.Config, pkiImpl *pki.PkiService, sink pki.IssueStorage) {
-	if config.Daemonize && len(config.MetricsAddr) > 0 {
-		log.Info().Msgf("Starting metrics server at '%s'", config.MetricsAddr)
-		go func() {
-			err := internal.StartMetricsServer(config.MetricsAddr)
-			DieOnErr(err, "could not start metrics server", config)
-		}()
+func issueCert(ctx context.Context, config *conf.Config, pkiImpl *pki.PkiService, sink pki.IssueStorage, queue *revocation.Queue, force bool) (pkg.IssueResult, error) {
+	args := pkg.IssueArgs{
+		CommonName: config.CommonName,
+		Ttl:        config.Ttl,
+		IpSans:     config.IpSans,
+		AltNames:   config.AltNames,
+		Force:      force,
 	}
 
-	ticker := time.NewTicker(daemonRunInterval)
-	defer ticker.Stop()
+	result, err := pkiImpl.Issue(ctx, sink, args)
+	if result.Status == pkg.Issued {
+		// errors after a certificate has been issued are caused by the post-issue hooks
+		enqueueSupersededCert(config, result.ExistingCert, err == nil, queue)
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			err := issueCert(ctx, config, pkiImpl, sink)
-			if err != nil {
-				log.Error().Err(err).Msg("issuing cert not successful")
-			}
-		case <-ctx.Done():
-			return
-		}
+	processRevocationQueue(ctx, config, pkiImpl, queue)
+	if err == nil || result.Status == pkg.Issued {
+		tidyStorage(ctx, pkiImpl)
 	}
+	return result, err
 }
 
-func issueCert(ctx context.Context, config *conf.Config, pkiImpl *pki.PkiService, sink pki.IssueStorage) error {
-	var serial string
-	cert, err := sink.ReadCert()
-	if err == nil {
-		serial = pkg.FormatSerial(cert.SerialNumber)
+// enqueueSupersededCert adds the superseded certificate to the revocation queue. The certificate will only be revoked
+// after the grace period has passed and if the post-issue hooks ran successfully.
+func enqueueSupersededCert(config *conf.Config, cert *x509.Certificate, hooksSucceeded bool, queue *revocation.Queue) {
+	if cert == nil || pkg.IsCertExpired(*cert) {
+		return
 	}
 
-	args := pkg.IssueArgs{
-		CommonName: config.CommonName,
-		Ttl:        config.Ttl,
-		IpSans:     config.IpSans,
-		AltNames:   config.AltNames,
+	serial := pkg.FormatSerial(cert.SerialNumber)
+	if !hooksSucceeded {
+		log.Warn().Str("serial", serial).Msg("Post-issue hooks failed, superseded certificate will not be revoked")
 	}
 
-	result, err := pkiImpl.Issue(ctx, sink, args)
-	if err != nil {
+	entry := revocation.Entry{
+		Serial:         serial,
+		CommonName:     cert.Subject.CommonName,
+		NotAfter:       cert.NotAfter,
+		RevokeAfter:    time.Now().Add(config.RevocationGracePeriod),
+		HooksSucceeded: hooksSucceeded,
+	}
+	if err := queue.Add(entry); err != nil {
+		log.Error().Err(err).Str("serial", serial).Msg("Could not add superseded certificate to revocation queue")
+	}
+}
+
+func processRevocationQueue(ctx context.Context, config *conf.Config, pkiImpl *pki.PkiService, queue *revocation.Queue) {
+	if err := queue.Process(ctx, pkiImpl); err != nil {
+		log.Warn().Err(err).Msg("Revoking superseded certificates failed")
 		labels := prometheus.Labels{
 			internal.MetricCertErrorsLabelCn:    config.CommonName,
 			internal.MetricCertErrorsLabelError: internal.TranslateErrToPromLabel(err),
 		}
 		internal.MetricCertErrors.With(labels).Inc()
-		return err
-	}
-	internal.MetricSuccess.WithLabelValues(config.CommonName).Set(1)
-
-	handleIssueLogs(result)
-	if result.Status == pkg.Issued {
-		commandCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
-		defer cancel()
-		// overwrite outer 'err'
-		err = runPostIssueHooks(commandCtx, config)
-
-		if !pkg.IsCertExpired(*cert) {
-			err := pkiImpl.Revoke(ctx, serial)
-			if err != nil {
-				log.Warn().Err(err).Str("serial", serial).Msg("Revoking cert failed")
-			}
-		}
 	}
-
-	tidyStorage(ctx, pkiImpl)
-	return err
+	internal.MetricRevocationQueueSize.WithLabelValues(config.CommonName).Set(float64(queue.Len()))
 }
 
-func handleIssueLogs(result pkg.IssueResult) {
-	if result.Status == pkg.Issued {
+// logIssueEvents logs the outcome of issuing a certificate.
+func logIssueEvents(_ context.Context, event pki.Event) error {
+	switch e := event.(type) {
+	case pki.CertIssued:
+		result := e.Result
 		if result.ExistingCert != nil {
 			percentage := fmt.Sprintf("%.1f", renew_strategy.GetPercentage(*result.ExistingCert))
 			log.Info().Msgf("Existing certificate at %s%% expired or below threshold, valid from %v until %v", percentage, result.ExistingCert.NotBefore.Format(time.RFC3339), result.ExistingCert.NotAfter.Format(time.RFC3339))
 		}
 		log.Info().Msgf("New certificate valid until %v (%s)", result.IssuedCert.NotAfter.Format(time.RFC3339), time.Until(result.IssuedCert.NotAfter).Round(time.Second))
-		internal.UpdateCertificateMetrics(result.IssuedCert)
-	} else if result.Status == pkg.Noop {
-		percentage := fmt.Sprintf("%.1f", renew_strategy.GetPercentage(*result.ExistingCert))
-		log.Info().Msgf("Existing certificate at %s%%, valid until %v (%s)", percentage, result.ExistingCert.NotAfter.Format(time.RFC3339), time.Until(result.ExistingCert.NotAfter).Round(time.Second))
-		internal.UpdateCertificateMetrics(result.ExistingCert)
+	case pki.RenewalSkipped:
+		result := e.Result
+		switch result.Status {
+		case pkg.Noop:
+			percentage := fmt.Sprintf("%.1f", renew_strategy.GetPercentage(*result.ExistingCert))
+			log.Info().Msgf("Existing certificate at %s%%, valid until %v (%s)", percentage, result.ExistingCert.NotAfter.Format(time.RFC3339), time.Until(result.ExistingCert.NotAfter).Round(time.Second))
+		case pkg.Vetoed:
+			log.Warn().Msgf("Renewal of certificate valid until %v vetoed by pre-issue hook", result.ExistingCert.NotAfter.Format(time.RFC3339))
+		case pkg.Delayed:
+			log.Warn().Msgf("Renewal of certificate valid until %v delayed by pre-issue hook for %v", result.ExistingCert.NotAfter.Format(time.RFC3339), result.RetryAfter)
+		}
 	}
+
+	return nil
 }
 
-func buildRenewalStrategy(config *conf.Config) (pki.RenewStrategy, error) {
+func buildRenewalStrategy(config *conf.Config, crlSource renew_strategy.CrlSource) (pki.RenewStrategy, error) {
 	if config.ForceNewCertificate {
 		return &renew_strategy.StaticRenewal{Decision: true}, nil
 	}
 
-	return renew_strategy.NewPercentage(config.CertificateLifetimeThresholdPercentage)
+	strat, err := renew_strategy.NewPercentage(config.CertificateLifetimeThresholdPercentage)
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.CheckRevocation {
+		return strat, nil
+	}
+
+	onRevoked := func(cert *x509.Certificate) {
+		internal.MetricCertRevoked.WithLabelValues(cert.Subject.CommonName).Set(1)
+	}
+	opts := []renew_strategy.RevocationOpt{
+		renew_strategy.WithRevokedHandler(onRevoked),
+	}
+	if config.CheckRevocationDelta {
+		opts = append(opts, renew_strategy.WithDeltaCrl())
+	}
+	if config.CheckRevocationUnified {
+		opts = append(opts, renew_strategy.WithUnifiedCrl())
+	}
+
+	return renew_strategy.NewRevocation(crlSource, strat, opts...)
+}
+
+func buildPreIssueGate(config *conf.Config) (*hooks.Gate, error) {
+	env := func(cert *x509.Certificate) map[string]string {
+		return buildHookEnv(config, cert)
+	}
+
+	var opts []hooks.GateOpts
+	if config.PreIssueHooksDelayExitCode > 0 {
+		opts = append(opts, hooks.WithDelayExitCode(config.PreIssueHooksDelayExitCode))
+	}
+	if config.PreIssueHooksRetryDelay > 0 {
+		opts = append(opts, hooks.WithRetryDelay(config.PreIssueHooksRetryDelay))
+	}
+
+	return hooks.NewGate(config.PreIssueHooks, env, opts...)
 }
 
-func buildDependencies(config *conf.Config) (*pki.PkiService, pki.IssueStorage) {
+func buildDependencies(config *conf.Config, additional ...pki.Observer) (*pki.PkiService, pki.IssueStorage, error) {
 	storage.InitBuilder(config)
 
+	vaultClient, err := buildLoggedInVaultClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkiImpl, err := buildPkiService(config, vaultClient, additional...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sink, err := storage.MultiKeyPairStorageFromConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't build sink: %w", err)
+	}
+
+	return pkiImpl, sink, nil
+}
+
+func buildLoggedInVaultClient(config *conf.Config) (*api.Client, error) {
 	vaultClient, err := buildVaultClient(config)
-	DieOnErr(err, "can't build client", config)
+	if err != nil {
+		return nil, fmt.Errorf("can't build client: %w", err)
+	}
 
 	authStrategy, err := buildAuthImpl(config)
-	DieOnErr(err, "can't build auth", config)
+	if err != nil {
+		return nil, fmt.Errorf("can't build auth: %w", err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err = vaultClient.Auth().Login(ctx, authStrategy)
-	DieOnErr(err, "can't login to vault")
+	if _, err = vaultClient.Auth().Login(ctx, authStrategy); err != nil {
+		return nil, fmt.Errorf("can't login to vault: %w", err)
+	}
+
+	return vaultClient, nil
+}
 
+// buildPkiService builds the service that issues certificates for the role of the given config.
+func buildPkiService(config *conf.Config, vaultClient *api.Client, additional ...pki.Observer) (*pki.PkiService, error) {
 	opts := []vault.VaultOpts{
 		vault.WithPkiMount(config.VaultMountPki),
 		vault.WithKv2Mount(config.VaultMountKv2),
@@ -215,18 +351,34 @@ func buildDependencies(config *conf.Config) (*pki.PkiService, pki.IssueStorage)
 	}
 
 	vaultBackend, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
-	DieOnErr(err, "can't build vault pki", config)
+	if err != nil {
+		return nil, fmt.Errorf("can't build vault pki: %w", err)
+	}
 
-	strat, err := buildRenewalStrategy(config)
-	DieOnErr(err, "can't build renewal strategy", config)
+	strat, err := buildRenewalStrategy(config, vaultBackend)
+	if err != nil {
+		return nil, fmt.Errorf("can't build renewal strategy: %w", err)
+	}
 
-	pkiImpl, err := pki.NewPkiService(vaultBackend, strat)
-	DieOnErr(err, "can't build pki impl", config)
+	observers := append([]pki.Observer{pki.ObserverFunc(logIssueEvents)}, additional...)
+	pkiOpts, err := buildObservers(config, audit.OperationIssue, observers...)
+	if err != nil {
+		return nil, fmt.Errorf("can't build observers: %w", err)
+	}
+	if len(config.PreIssueHooks) > 0 {
+		gate, err := buildPreIssueGate(config)
+		if err != nil {
+			return nil, fmt.Errorf("can't build pre-issue hooks: %w", err)
+		}
+		pkiOpts = append(pkiOpts, pki.WithPreIssueGate(gate))
+	}
 
-	sink, err := storage.MultiKeyPairStorageFromConfig(config)
-	DieOnErr(err, "can't build sink", config)
+	pkiImpl, err := pki.NewPkiService(vaultBackend, strat, pkiOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't build pki impl: %w", err)
+	}
 
-	return pkiImpl, sink
+	return pkiImpl, nil
 }
 
 func tidyStorage(ctx context.Context, pkiImpl *pki.PkiService) {
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/ocsp"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/soerenschneider/vault-pki-cli/pkg/storage/shape"
+	"github.com/soerenschneider/vault-pki-cli/pkg/vault"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+const ocspRetryInterval = 5 * time.Minute
+
+func getOcspCmd() *cobra.Command {
+	var ocspCmd = &cobra.Command{
+		Use:   "ocsp",
+		Short: "Check the OCSP status of stored certificates and write stapling files",
+		Run:   ocspEntryPoint,
+	}
+
+	ocspCmd.Flags().StringP(conf.FLAG_OCSP_RESPONDER, "", "", "OCSP responder to query. If not specified, the OCSP endpoint of the Vault PKI mount is used.")
+	ocspCmd.Flags().BoolP(conf.FLAG_OCSP_USE_AIA, "", false, "Query the OCSP responders listed in the certificate's AIA extension")
+	ocspCmd.Flags().StringP(conf.FLAG_METRICS_FILE, "", "", "File to write metrics to")
+	ocspCmd.Flags().StringP(conf.FLAG_ISSUE_METRICS_ADDR, "", conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT, "Address to serve metrics on in daemon mode")
+	ocspCmd.Flags().BoolP(conf.FLAG_ISSUE_DAEMONIZE, "", conf.FLAG_ISSUE_DAEMONIZE_DEFAULT, "Run as daemon and refresh OCSP responses before they expire")
+
+	return ocspCmd
+}
+
+func ocspEntryPoint(_ *cobra.Command, _ []string) {
+	PrintVersionInfo()
+	config, err := config()
+	DieOnErr(err, "could not get config")
+	config.Print()
+
+	storage.InitBuilder(config)
+	sinks, err := storage.OcspStorageFromConfig(config)
+	DieOnErr(err, "could not build ocsp storage from config")
+	if len(sinks) == 0 {
+		log.Fatal().Msg("no storage configured")
+	}
+
+	vaultClient, err := buildVaultClient(config)
+	DieOnErr(err, "could not build vault client")
+
+	opts := []vault.VaultOpts{
+		vault.WithPkiMount(config.VaultMountPki),
+		vault.WithKv2Mount(config.VaultMountKv2),
+		vault.WithAcmePrefix(config.AcmePrefix),
+	}
+
+	pkiImpl, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
+	DieOnErr(err, "could not build vault pki")
+
+	client, err := buildOcspClient(config)
+	DieOnErr(err, "could not build ocsp client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if !config.Daemonize {
+		_, err := checkOcsp(ctx, client, pkiImpl, sinks)
+		if len(config.MetricsFile) > 0 {
+			if err := internal.WriteMetrics(config.MetricsFile); err != nil {
+				log.Warn().Err(err).Msg("could not write metrics")
+			}
+		}
+		DieOnErr(err, "checking ocsp status not successful")
+		return
+	}
+
+	startMetricsServer(config)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Info().Msgf("got interrupt")
+		cancel()
+	}()
+
+	runOcspDaemon(ctx, client, pkiImpl, sinks)
+}
+
+func buildOcspClient(config *conf.Config) (*ocsp.Client, error) {
+	if config.OcspUseAia {
+		return ocsp.NewClient()
+	}
+
+	responder := config.OcspResponder
+	if len(responder) == 0 {
+		responder = fmt.Sprintf("%s/v1/%s/ocsp", strings.TrimRight(config.VaultAddress, "/"), strings.Trim(config.VaultMountPki, "/"))
+	}
+
+	return ocsp.NewClient(ocsp.WithResponder(responder))
+}
+
+func runOcspDaemon(ctx context.Context, client *ocsp.Client, pkiImpl pki.PkiClient, sinks []*shape.OcspStorage) {
+	for {
+		refreshAt, err := checkOcsp(ctx, client, pkiImpl, sinks)
+		wait := time.Until(refreshAt)
+		if err != nil {
+			log.Error().Err(err).Msg("checking ocsp status not successful")
+			wait = min(wait, ocspRetryInterval)
+		}
+		wait = max(wait, time.Minute)
+		log.Info().Msgf("Refreshing OCSP responses in %v", wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// checkOcsp queries the OCSP status for the certificates of all sinks and writes the responses. It returns the
+// earliest time at which one of the responses needs to be refreshed.
+func checkOcsp(ctx context.Context, client *ocsp.Client, pkiImpl pki.PkiClient, sinks []*shape.OcspStorage) (time.Time, error) {
+	refreshAt := time.Now().Add(daemonRunInterval)
+
+	chainData, err := pkiImpl.FetchCaChain()
+	if err != nil {
+		return refreshAt, fmt.Errorf("could not fetch ca chain: %w", err)
+	}
+
+	chain, err := pkg.ParseCertsPem(chainData)
+	if err != nil {
+		return refreshAt, fmt.Errorf("could not parse ca chain: %w", err)
+	}
+
+	var errs []error
+	for _, sink := range sinks {
+		resp, err := checkOcspSink(ctx, client, chain, sink)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if resp.RefreshAt().Before(refreshAt) {
+			refreshAt = resp.RefreshAt()
+		}
+	}
+
+	if len(errs) > 0 {
+		return refreshAt, fmt.Errorf("could not check ocsp status: %v", errs)
+	}
+
+	return refreshAt, nil
+}
+
+func checkOcspSink(ctx context.Context, client *ocsp.Client, chain []*x509.Certificate, sink *shape.OcspStorage) (*ocsp.Response, error) {
+	cert, err := sink.ReadCert()
+	if err != nil {
+		return nil, fmt.Errorf("could not read certificate: %w", err)
+	}
+
+	issuer, err := ocsp.FindIssuer(cert, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Query(ctx, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := cert.Subject.CommonName
+	internal.MetricOcspStatus.WithLabelValues(cn).Set(float64(resp.Status))
+	internal.MetricOcspNextUpdate.WithLabelValues(cn).Set(float64(resp.NextUpdate.Unix()))
+
+	logger := log.Info()
+	if !resp.IsGood() {
+		logger = log.Error()
+	}
+	logger.Str("serial", pkg.FormatSerial(cert.SerialNumber)).Str("status", ocsp.StatusString(resp.Status)).Msgf("Received OCSP response for '%s', valid until %v", cn, resp.NextUpdate.Format(time.RFC3339))
+
+	if err := sink.WriteOcspResponse(resp.Der); err != nil {
+		return nil, fmt.Errorf("could not write ocsp response: %w", err)
+	}
+
+	return resp, nil
+}
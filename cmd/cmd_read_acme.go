@@ -3,9 +3,9 @@ package main
 import (
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/rs/zerolog/log"
 	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
 	"github.com/soerenschneider/vault-pki-cli/internal/storage"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
@@ -88,33 +88,30 @@ func readAcmeCert(config *conf.Config) error {
 	vaultBackend, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
 	DieOnErr(err, "can't build vault pki")
 
-	pkiImpl, err := pki.NewPkiService(vaultBackend, nil)
+	observers, err := buildObservers(config, audit.OperationReadAcme, pki.ObserverFunc(logAcmeEvents))
+	DieOnErr(err, "can't build observers")
+
+	pkiImpl, err := pki.NewPkiService(vaultBackend, nil, observers...)
 	DieOnErr(err, "can't build pki impl")
 
 	sink, err := storage.MultiKeyPairStorageFromConfig(config)
 	DieOnErr(err, "can't build sink")
 
-	result, err := pkiImpl.ReadAcme(ctx, sink, config.CommonName)
-	if err != nil {
-		labels := prometheus.Labels{
-			internal.MetricCertErrorsLabelCn:    config.CommonName,
-			internal.MetricCertErrorsLabelError: internal.TranslateErrToPromLabel(err),
-		}
-		internal.MetricCertErrors.With(labels).Inc()
+	// the login context is not reused as the post-issue hooks may take longer
+	result, err := pkiImpl.ReadAcme(context.Background(), sink, config.CommonName)
+	if err != nil && result.Status != pkg.Issued {
 		DieOnErr(err, "can't read acme cert")
 	}
 
-	switch result.Status {
-	case pkg.Issued:
-		internal.UpdateCertificateMetrics(result.IssuedCert)
+	return err
+}
+
+func logAcmeEvents(_ context.Context, event pki.Event) error {
+	switch event.(type) {
+	case pki.CertIssued:
 		log.Info().Msg("Detected update between local cert on disk and the read certificate")
-		commandCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
-		defer cancel()
-		return runPostIssueHooks(commandCtx, config)
-	case pkg.Noop:
+	case pki.RenewalSkipped:
 		log.Info().Msg("No update detected for certificate")
-		internal.UpdateCertificateMetrics(result.ExistingCert)
-		return nil
 	}
 
 	return nil
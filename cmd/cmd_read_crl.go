@@ -1,12 +1,26 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
 	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
 	"github.com/soerenschneider/vault-pki-cli/pkg/vault"
 	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
 )
 
+const crlRetryInterval = 5 * time.Minute
+
 func readCrlCmd() *cobra.Command {
 	var getCaCmd = &cobra.Command{
 		Use:   "read-crl",
@@ -17,6 +31,10 @@ func readCrlCmd() *cobra.Command {
 	getCaCmd.Flags().Uint64(conf.FLAG_RETRIES, conf.FLAG_RETRIES_DEFAULT, "How many retries to perform for non-permanent errors")
 	getCaCmd.PersistentFlags().StringP(conf.FLAG_OUTPUT_FILE, "o", "", "WriteSignature CRL to this file")
 	getCaCmd.PersistentFlags().BoolP(conf.FLAG_DER_ENCODED, "d", false, "Use DER encoding")
+	getCaCmd.Flags().StringP(conf.FLAG_METRICS_FILE, "", "", "File to write metrics to")
+	getCaCmd.Flags().StringP(conf.FLAG_ISSUE_METRICS_ADDR, "", conf.FLAG_ISSUE_METRICS_ADDR_DEFAULT, "Address to serve metrics on in daemon mode")
+	getCaCmd.Flags().BoolP(conf.FLAG_ISSUE_DAEMONIZE, "", conf.FLAG_ISSUE_DAEMONIZE_DEFAULT, "Run as daemon and refresh the CRL before it expires")
+	getCaCmd.Flags().StringSlice(conf.FLAG_ISSUE_HOOKS, []string{}, "Run commands after the CRL has changed.")
 	getCaCmd.MarkFlagRequired(conf.FLAG_CERTIFICATE_FILE) // nolint:errcheck
 
 	return getCaCmd
@@ -36,16 +54,120 @@ func readCrlEntryPoint(_ *cobra.Command, _ []string) {
 		vault.WithAcmePrefix(config.AcmePrefix),
 	}
 
-	pkiImpl, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
+	vaultBackend, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
 	DieOnErr(err, "could not build crl client")
 
+	pkiImpl, err := pki.NewPkiService(vaultBackend, nil, pki.WithObserver(&internal.MetricsObserver{}))
+	DieOnErr(err, "could not build pki impl")
+
 	storage.InitBuilder(config)
-	crlData, err := pkiImpl.FetchCrl(config.DerEncoded)
-	DieOnErr(err, "could not fetch crl")
+	sinks := map[pkg.CrlKind]pki.CrlStorage{}
+	for _, kind := range storage.ConfiguredCrlKinds(config.StorageConfig) {
+		sink, err := storage.CrlStorageFromConfig(config.StorageConfig, kind)
+		DieOnErr(err, "could not build crl sink from config")
+		sinks[kind] = sink
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if !config.Daemonize {
+		_, err := updateCrls(ctx, config, pkiImpl, sinks)
+		if len(config.MetricsFile) > 0 {
+			if err := internal.WriteMetrics(config.MetricsFile); err != nil {
+				log.Warn().Err(err).Msg("could not write metrics")
+			}
+		}
+		DieOnErr(err, "could not update crl")
+		return
+	}
+
+	startMetricsServer(config)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Info().Msgf("got interrupt")
+		cancel()
+	}()
+
+	runCrlDaemon(ctx, config, pkiImpl, sinks)
+}
+
+func runCrlDaemon(ctx context.Context, config *conf.Config, pkiImpl *pki.PkiService, sinks map[pkg.CrlKind]pki.CrlStorage) {
+	for {
+		refreshAt, err := updateCrls(ctx, config, pkiImpl, sinks)
+		wait := time.Until(refreshAt)
+		if err != nil {
+			log.Error().Err(err).Msg("could not update crl")
+			wait = min(wait, crlRetryInterval)
+		}
+		wait = max(wait, time.Minute)
+		log.Info().Msgf("Refreshing CRLs in %v", wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
 
-	sink, err := storage.CrlStorageFromConfig(config.StorageConfig)
-	DieOnErr(err, "could not build crl sink from config")
+// updateCrls fetches and writes the CRLs of all configured kinds and runs the hooks if any CRL has changed. It returns
+// the earliest time at which a CRL should be refreshed.
+func updateCrls(ctx context.Context, config *conf.Config, pkiImpl *pki.PkiService, sinks map[pkg.CrlKind]pki.CrlStorage) (time.Time, error) {
+	refreshAt := time.Now().Add(daemonRunInterval)
+
+	var errs error
+	var changed bool
+	for _, kind := range pkg.CrlKinds {
+		sink, ok := sinks[kind]
+		if !ok {
+			continue
+		}
+
+		crlRefreshAt, crlChanged, err := updateCrl(pkiImpl, sink, kind, config.DerEncoded)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not update %s: %w", kind, err))
+			continue
+		}
+
+		changed = changed || crlChanged
+		if crlRefreshAt.Before(refreshAt) {
+			refreshAt = crlRefreshAt
+		}
+	}
+
+	if changed {
+		errs = multierr.Append(errs, runPostIssueHooks(ctx, config, buildHookEnv(config, nil)))
+	}
+
+	return refreshAt, errs
+}
+
+// updateCrl fetches and writes a single CRL. It returns the time at which the CRL should be refreshed, which is halfway
+// between its ThisUpdate and NextUpdate, and whether the CRL has changed.
+func updateCrl(pkiImpl *pki.PkiService, sink pki.CrlStorage, kind pkg.CrlKind, binary bool) (time.Time, bool, error) {
+	refreshAt := time.Now().Add(daemonRunInterval)
+
+	result, err := pkiImpl.UpdateCrl(sink, kind, binary)
+	if err != nil {
+		return refreshAt, false, err
+	}
+
+	crl := result.FetchedCrl
+	if !crl.NextUpdate.IsZero() {
+		refreshAt = crl.ThisUpdate.Add(crl.NextUpdate.Sub(crl.ThisUpdate) / 2)
+	}
+
+	if result.Status == pkg.Noop {
+		log.Info().Msgf("%s has not changed, valid until %v", kind, crl.NextUpdate.Format(time.RFC3339))
+		return refreshAt, false, nil
+	}
 
-	err = sink.WriteCrl(crlData)
-	DieOnErr(err, "could not write crl")
+	log.Info().Msgf("Wrote %s with %d revoked certificates, valid until %v", kind, len(crl.RevokedCertificateEntries), crl.NextUpdate.Format(time.RFC3339))
+	return refreshAt, true, nil
 }
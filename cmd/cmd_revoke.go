@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
 	"github.com/soerenschneider/vault-pki-cli/internal/storage"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
@@ -56,7 +57,10 @@ func revokeCertEntryPoint(_ *cobra.Command, _ []string) {
 	vaultBackend, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
 	DieOnErr(err, "could not build rotation client")
 
-	pkiImpl, err := pki.NewPkiService(vaultBackend, nil)
+	observers, err := buildObservers(config, audit.OperationRevoke)
+	DieOnErr(err, "could not build observers")
+
+	pkiImpl, err := pki.NewPkiService(vaultBackend, nil, observers...)
 	DieOnErr(err, "could not build pki impl")
 
 	sink, err := storage.MultiKeyPairStorageFromConfig(config)
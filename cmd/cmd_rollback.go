@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+func getRollbackCmd() *cobra.Command {
+	var rollbackCmd = &cobra.Command{
+		Use:   "rollback",
+		Short: "Restore the previous keypair from the backups of the configured file storages",
+		Long: "Restores the previous version of the certificate, private key and ca of each configured storage. " +
+			"Backups are kept by file storages, configured using the 'backups' query parameter. Runs the post-issue " +
+			"hooks afterwards, so services pick up the restored keypair.",
+		Run: rollbackEntryPoint,
+	}
+
+	rollbackCmd.Flags().StringSlice(conf.FLAG_ISSUE_HOOKS, []string{}, "Run commands after the keypair has been restored.")
+	rollbackCmd.Flags().Bool(conf.FLAG_ROLLBACK_SKIP_HOOKS, false, "Do not run the post-issue hooks after the keypair has been restored")
+
+	return rollbackCmd
+}
+
+func rollbackEntryPoint(_ *cobra.Command, _ []string) {
+	PrintVersionInfo()
+	config, err := config()
+	DieOnErr(err, "could not get config")
+
+	if len(config.StorageConfig) == 0 {
+		DieOnErr(errors.New("no storage configured"), "invalid config", config)
+	}
+
+	storage.InitBuilder(config)
+	sinks, err := storage.KeyPairStorageFromConfig(config)
+	DieOnErr(err, "could not build storage", config)
+
+	var restored *x509.Certificate
+	for index, sink := range sinks {
+		err = sink.Rollback()
+		DieOnErr(err, "could not roll back storage", config)
+
+		cert, err := sink.ReadCert()
+		if err != nil {
+			log.Warn().Err(err).Msgf("Rolled back storage %d, could not read restored certificate", index)
+			continue
+		}
+		log.Info().Msgf("Rolled back storage %d to certificate with serial %s, valid until %v", index, pkg.FormatSerial(cert.SerialNumber), cert.NotAfter.Format(time.RFC3339))
+		restored = cert
+	}
+
+	if viper.GetBool(conf.FLAG_ROLLBACK_SKIP_HOOKS) {
+		return
+	}
+
+	err = runPostIssueHooks(context.Background(), config, buildHookEnv(config, restored))
+	DieOnErr(err, "could not run post-issue hooks", config)
+}
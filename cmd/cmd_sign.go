@@ -11,6 +11,7 @@ import (
 	"github.com/soerenschneider/vault-pki-cli/pkg/vault"
 	"golang.org/x/net/context"
 
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
 	"github.com/soerenschneider/vault-pki-cli/pkg/renew_strategy"
 
@@ -90,7 +91,10 @@ func signCert(config *conf.Config) error {
 	vaultBackend, err := vault.NewVaultPki(vaultClient.Logical(), config.VaultPkiRole, opts...)
 	DieOnErr(err, "can't build vault pki")
 
-	pkiImpl, err := pki.NewPkiService(vaultBackend, &renew_strategy.StaticRenewal{Decision: false})
+	observers, err := buildObservers(config, audit.OperationSign)
+	DieOnErr(err, "can't build observers")
+
+	pkiImpl, err := pki.NewPkiService(vaultBackend, &renew_strategy.StaticRenewal{Decision: false}, observers...)
 	DieOnErr(err, "can't build pki impl")
 
 	sink, err := storage.CsrStorageFromConfig(config.StorageConfig)
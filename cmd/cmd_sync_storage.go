@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func getSyncStorageCmd() *cobra.Command {
+	var syncCmd = &cobra.Command{
+		Use:   "sync-storage",
+		Short: "Repair storage sinks that diverged from the newest valid keypair",
+		Long: "Reads the keypair of all configured storages and compares them by serial and whether the private key " +
+			"matches the certificate. Stale storages are rewritten using the newest valid keypair without contacting Vault.",
+		Run: syncStorageEntryPoint,
+	}
+
+	syncCmd.Flags().Bool(conf.FLAG_SYNC_CHECK_ONLY, false, "Only report diverging storages and exit with an error instead of repairing them")
+	syncCmd.Flags().String(conf.FLAG_METRICS_FILE, "", "File to write metrics to")
+
+	return syncCmd
+}
+
+func syncStorageEntryPoint(_ *cobra.Command, _ []string) {
+	PrintVersionInfo()
+	config, err := config()
+	DieOnErr(err, "could not get config")
+
+	if len(config.StorageConfig) == 0 {
+		DieOnErr(errors.New("no storage configured"), "invalid config", config)
+	}
+
+	storage.InitBuilder(config)
+	sinks, err := storage.MultiKeyPairStorageFromConfig(config)
+	DieOnErr(err, "could not build storage", config)
+
+	if viper.GetBool(conf.FLAG_SYNC_CHECK_ONLY) {
+		stale := 0
+		statuses := sinks.Inspect()
+		internal.UpdateSinkMetrics(statuses)
+		for _, status := range statuses {
+			switch {
+			case status.Err != nil:
+				log.Warn().Err(status.Err).Msgf("Could not read storage %d", status.Index)
+			case status.Cert != nil:
+				log.Info().Msgf("Storage %d contains certificate with serial %s, valid until %v, key matches: %t, stale: %t", status.Index, pkg.FormatSerial(status.Cert.SerialNumber), status.Cert.NotAfter.Format(time.RFC3339), status.KeyMatches, status.Stale)
+			}
+			if status.Stale {
+				stale++
+			}
+		}
+		writeSyncMetrics(config)
+		if stale > 0 {
+			log.Fatal().Msgf("%d of %d storages diverged", stale, len(statuses))
+		}
+		return
+	}
+
+	synced, err := sinks.Sync()
+	writeSyncMetrics(config)
+	DieOnErr(err, "could not sync storage", config)
+	log.Info().Msgf("Synced %d storages", synced)
+}
+
+func writeSyncMetrics(config *conf.Config) {
+	if len(config.MetricsFile) > 0 {
+		if err := internal.WriteMetrics(config.MetricsFile); err != nil {
+			log.Error().Err(err).Msg("could not write metrics")
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/control"
+	"github.com/soerenschneider/vault-pki-cli/internal/leader"
+	"github.com/soerenschneider/vault-pki-cli/internal/status"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/internal/systemd"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/soerenschneider/vault-pki-cli/pkg/revocation"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+// issueDaemon periodically renews the certificate and can be controlled via the control api.
+type issueDaemon struct {
+	config  *conf.Config
+	pkiImpl *pki.PkiService
+	sink    pki.IssueStorage
+	queue   *revocation.Queue
+	tracker *status.Tracker
+	// elector is only set if leader election is enabled
+	elector *leader.Elector
+
+	paused atomic.Bool
+	// runs serializes the scheduled runs and the ones requested via the control api
+	runs sync.Mutex
+}
+
+func (d *issueDaemon) run(ctx context.Context) {
+	config := d.config
+	ready := func() error {
+		return status.StorageReadiness(d.currentSink())()
+	}
+	startMetricsServer(config,
+		internal.WithHandler("/healthz", d.tracker.HealthzHandler()),
+		internal.WithHandler("/readyz", status.ReadyzHandler(ready)),
+		internal.WithHandler("/status", d.tracker.StatusHandler(ready)),
+	)
+
+	if len(config.ControlAddr) > 0 {
+		d.startControlServer(ctx)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	// reload requests are coalesced, editors tend to emit several events for a single write
+	reloads := make(chan struct{}, 1)
+	if config.WatchConfig {
+		d.watchConfig(reloads)
+	}
+
+	// runs block the loop for a long time while waiting for hooks or rollouts, so the watchdog is pinged by a
+	// goroutine as long as no scheduled run is overdue
+	if ticker := sdWatchdog(); ticker != nil {
+		defer ticker.Stop()
+		go d.pingWatchdog(ctx, ticker.C)
+	}
+
+	// elections are coalesced, a single run checks the certificate
+	elected := make(chan struct{}, 1)
+	if d.elector != nil {
+		electorDone := startLeaderElection(ctx, config, d.elector, func() {
+			select {
+			case elected <- struct{}{}:
+			default:
+			}
+		})
+		defer waitForLeaseRelease(electorDone)
+	}
+
+	timer := d.schedule(nil, daemonRunInterval)
+	sdNotify(systemd.Ready)
+	for {
+		select {
+		case <-timer.C:
+			timer = d.schedule(timer, d.scheduledRun(ctx))
+		case <-elected:
+			log.Info().Msg("Checking certificate after becoming the leader")
+			timer = d.schedule(timer, d.scheduledRun(ctx))
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGHUP:
+				log.Info().Msg("Received SIGHUP, reloading config")
+				d.reload()
+			case syscall.SIGUSR1:
+				log.Info().Msg("Received SIGUSR1, forcing renewal")
+				if !d.isLeader() {
+					log.Warn().Msg("Not the leader, ignoring forced renewal")
+				} else if _, err := d.issue(ctx, true); err != nil {
+					log.Error().Err(err).Msg("forced renewal not successful")
+				}
+			}
+		case <-reloads:
+			log.Info().Msg("Config file changed, reloading config")
+			d.reload()
+		case <-ctx.Done():
+			sdNotify(systemd.Stopping)
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// pingWatchdog notifies the systemd watchdog on every tick until a scheduled run is overdue by more than the stall
+// timeout, so systemd restarts a wedged daemon.
+func (d *issueDaemon) pingWatchdog(ctx context.Context, ticks <-chan time.Time) {
+	for {
+		select {
+		case <-ticks:
+			if err := d.tracker.Alive(); err != nil {
+				log.Error().Err(err).Msg("Daemon is stalled, not notifying systemd watchdog")
+				continue
+			}
+			sdNotify(systemd.Watchdog)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scheduledRun conditionally renews the certificate and returns the time to wait for the next run.
+func (d *issueDaemon) scheduledRun(ctx context.Context) time.Duration {
+	if d.paused.Load() {
+		log.Info().Msg("Renewals are paused, skipping run")
+		return daemonRunInterval
+	}
+
+	if !d.isLeader() {
+		log.Info().Msg("Not the leader, skipping run")
+		return daemonRunInterval
+	}
+
+	result, err := d.issue(ctx, false)
+	if err != nil {
+		log.Error().Err(err).Msg("issuing cert not successful")
+	} else if result.Status == pkg.Delayed && result.RetryAfter > 0 {
+		return min(result.RetryAfter, daemonRunInterval)
+	}
+
+	return daemonRunInterval
+}
+
+func (d *issueDaemon) isLeader() bool {
+	return d.elector == nil || d.elector.IsLeader()
+}
+
+func (d *issueDaemon) schedule(timer *time.Timer, wait time.Duration) *time.Timer {
+	next := time.Now().Add(wait)
+	d.tracker.ScheduleNextRun(d.currentConfig().CommonName, next)
+	if d.paused.Load() {
+		sdNotify(systemd.Status("Renewals paused"))
+	} else {
+		sdNotify(systemd.Status("Next renewal check at %s", next.Format(time.RFC3339)))
+	}
+
+	if timer == nil {
+		return time.NewTimer(wait)
+	}
+
+	// drain the channel if the timer has fired but the value has not been received
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(wait)
+	return timer
+}
+
+func (d *issueDaemon) watchConfig(reloads chan<- struct{}) {
+	if len(viper.ConfigFileUsed()) == 0 {
+		log.Warn().Msgf("No config file used, ignoring '%s'", conf.FLAG_WATCH_CONFIG)
+		return
+	}
+
+	log.Info().Msgf("Watching config file '%s' for changes", viper.ConfigFileUsed())
+	viper.OnConfigChange(func(_ fsnotify.Event) {
+		select {
+		case reloads <- struct{}{}:
+		default:
+		}
+	})
+	viper.WatchConfig()
+}
+
+// reload re-reads the config and rebuilds the storage, the renewal strategy and the observers. The scheduler state,
+// i.e. the status of the certificates, the revocation queue and whether renewals are paused, is kept. If the new config
+// is invalid, the current config remains active.
+func (d *issueDaemon) reload() {
+	sdNotify(systemd.Reloading)
+	defer sdNotify(systemd.Ready)
+
+	newConfig, err := config()
+	if err == nil {
+		err = newConfig.ValidateIssue()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid config, keeping current config")
+		internal.MetricConfigReloads.WithLabelValues("invalid").Inc()
+		return
+	}
+
+	// the storage is built using a new builder, cached kubernetes clients may be based on outdated settings
+	restoreBuilder := storage.ReplaceBuilder(newConfig)
+	pkiImpl, sink, err := buildDependencies(newConfig, d.tracker)
+	if err != nil {
+		restoreBuilder()
+		log.Error().Err(err).Msg("Could not apply config, keeping current config")
+		internal.MetricConfigReloads.WithLabelValues("failed").Inc()
+		return
+	}
+
+	d.runs.Lock()
+	oldConfig := d.config
+	d.config = newConfig
+	d.pkiImpl = pkiImpl
+	d.sink = sink
+	d.runs.Unlock()
+
+	warnRestartRequired(oldConfig, newConfig)
+	if oldConfig.CommonName != newConfig.CommonName {
+		log.Info().Msgf("Common name changed from '%s' to '%s'", oldConfig.CommonName, newConfig.CommonName)
+		if next := d.nextRun(oldConfig.CommonName); next != nil {
+			d.tracker.ScheduleNextRun(newConfig.CommonName, *next)
+		}
+		d.tracker.Remove(oldConfig.CommonName)
+	}
+
+	newConfig.Print()
+	internal.MetricConfigReloads.WithLabelValues("success").Inc()
+	log.Info().Msg("Config reloaded")
+}
+
+func (d *issueDaemon) nextRun(commonName string) *time.Time {
+	for _, cert := range d.tracker.Certificates() {
+		if cert.CommonName == commonName {
+			return cert.NextRun
+		}
+	}
+	return nil
+}
+
+// warnRestartRequired warns about changed settings that only take effect after a restart.
+func warnRestartRequired(oldConfig, newConfig *conf.Config) {
+	settings := []struct {
+		name    string
+		changed bool
+	}{
+		{conf.FLAG_ISSUE_METRICS_ADDR, oldConfig.MetricsAddr != newConfig.MetricsAddr},
+		{conf.FLAG_METRICS_TLS_CERT_FILE, oldConfig.MetricsTlsCertFile != newConfig.MetricsTlsCertFile},
+		{conf.FLAG_METRICS_TLS_KEY_FILE, oldConfig.MetricsTlsKeyFile != newConfig.MetricsTlsKeyFile},
+		{conf.FLAG_CONTROL_ADDR, oldConfig.ControlAddr != newConfig.ControlAddr},
+		{conf.FLAG_CONTROL_TOKEN_FILE, oldConfig.ControlTokenFile != newConfig.ControlTokenFile},
+		{conf.FLAG_ISSUE_REVOCATION_QUEUE_FILE, oldConfig.RevocationQueueFile != newConfig.RevocationQueueFile},
+		{conf.FLAG_HEALTH_STALL_TIMEOUT, oldConfig.HealthStallTimeout != newConfig.HealthStallTimeout},
+		{conf.FLAG_WATCH_CONFIG, oldConfig.WatchConfig != newConfig.WatchConfig},
+	}
+
+	for _, setting := range settings {
+		if setting.changed {
+			log.Warn().Msgf("Changing '%s' requires a restart", setting.name)
+		}
+	}
+}
+
+func (d *issueDaemon) currentConfig() *conf.Config {
+	d.runs.Lock()
+	defer d.runs.Unlock()
+	return d.config
+}
+
+func (d *issueDaemon) currentSink() pki.IssueStorage {
+	d.runs.Lock()
+	defer d.runs.Unlock()
+	return d.sink
+}
+
+func (d *issueDaemon) startControlServer(ctx context.Context) {
+	config := d.currentConfig()
+	token, err := control.ReadOrCreateToken(expandPath(config.ControlTokenFile))
+	DieOnErr(err, "could not read control token", config)
+
+	server, err := control.NewServer(config.ControlAddr, token, d)
+	DieOnErr(err, "could not build control server", config)
+
+	log.Info().Msgf("Starting control api at '%s'", config.ControlAddr)
+	go func() {
+		err := server.Serve(ctx)
+		DieOnErr(err, "could not start control server", config)
+	}()
+}
+
+// issue runs under a context that is canceled as soon as this replica loses the lease, so a run that outlasts the lease,
+// e.g. because of a slow Vault call, does not write or revoke certificates alongside the new leader.
+func (d *issueDaemon) issue(ctx context.Context, force bool) (pkg.IssueResult, error) {
+	if d.elector != nil {
+		leaderCtx, cancel, ok := d.elector.LeaderContext(ctx)
+		defer cancel()
+		if !ok {
+			return pkg.IssueResult{Status: pkg.Unknown}, control.ErrNotLeader
+		}
+		ctx = leaderCtx
+	}
+
+	d.runs.Lock()
+	defer d.runs.Unlock()
+
+	return issueCert(ctx, d.config, d.pkiImpl, d.sink, d.queue, force)
+}
+
+// Renew forces the renewal of the certificate. Forced renewals are performed even if renewals are paused, but are
+// still subject to the pre-issue hooks.
+func (d *issueDaemon) Renew(ctx context.Context, commonName string) (control.Result, error) {
+	if commonName != d.currentConfig().CommonName {
+		return control.Result{}, control.ErrUnknownCert
+	}
+
+	if !d.isLeader() {
+		return control.Result{}, control.ErrNotLeader
+	}
+
+	result, err := d.issue(ctx, true)
+	return buildControlResult(commonName, result, err), nil
+}
+
+// RefreshCrl runs a regular renewal check which fetches the current CRL to detect whether the certificate has been
+// revoked.
+func (d *issueDaemon) RefreshCrl(ctx context.Context) (control.Result, error) {
+	config := d.currentConfig()
+	if !config.CheckRevocation {
+		return control.Result{}, control.ErrNotSupported
+	}
+
+	if !d.isLeader() {
+		return control.Result{}, control.ErrNotLeader
+	}
+
+	result, err := d.issue(ctx, false)
+	return buildControlResult(config.CommonName, result, err), nil
+}
+
+func (d *issueDaemon) Pause() error {
+	d.paused.Store(true)
+	sdNotify(systemd.Status("Renewals paused"))
+	return nil
+}
+
+func (d *issueDaemon) Resume() error {
+	d.paused.Store(false)
+	sdNotify(systemd.Status("Renewals resumed"))
+	return nil
+}
+
+func (d *issueDaemon) Queue() (control.Queue, error) {
+	ret := control.Queue{
+		Paused:      d.paused.Load(),
+		Jobs:        []control.Job{},
+		Revocations: []control.Revocation{},
+	}
+
+	for _, cert := range d.tracker.Certificates() {
+		ret.Jobs = append(ret.Jobs, control.Job{CommonName: cert.CommonName, NextRun: cert.NextRun})
+	}
+
+	for _, entry := range d.queue.Entries() {
+		ret.Revocations = append(ret.Revocations, control.Revocation{
+			Serial:      entry.Serial,
+			CommonName:  entry.CommonName,
+			RevokeAfter: entry.RevokeAfter,
+			Attempts:    entry.Attempts,
+			LastError:   entry.LastError,
+		})
+	}
+
+	return ret, nil
+}
+
+func buildControlResult(commonName string, result pkg.IssueResult, err error) control.Result {
+	ret := control.Result{
+		CommonName: commonName,
+		Status:     status.IssueStatusName(result.Status),
+	}
+
+	cert := result.IssuedCert
+	if cert == nil {
+		cert = result.ExistingCert
+	}
+	if cert != nil {
+		ret.Serial = pkg.FormatSerial(cert.SerialNumber)
+		notAfter := cert.NotAfter
+		ret.NotAfter = &notAfter
+	}
+
+	if result.RetryAfter > 0 {
+		ret.RetryAfter = result.RetryAfter.String()
+	}
+
+	if err != nil {
+		ret.Error = err.Error()
+		if result.Status != pkg.Issued {
+			ret.Status = status.StatusFailed
+		}
+	}
+
+	return ret
+}
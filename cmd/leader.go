@@ -0,0 +1,81 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/leader"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"golang.org/x/net/context"
+)
+
+func buildElector(config *conf.Config) (*leader.Elector, error) {
+	builder, err := storage.GetBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := builder.KubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []leader.ElectorOpts
+	if len(config.LeaderElectionNamespace) > 0 {
+		opts = append(opts, leader.WithNamespace(config.LeaderElectionNamespace))
+	}
+	if len(config.LeaderElectionLeaseName) > 0 {
+		opts = append(opts, leader.WithLeaseName(config.LeaderElectionLeaseName))
+	}
+	if config.LeaderElectionLeaseDuration > 0 {
+		opts = append(opts, leader.WithLeaseDuration(config.LeaderElectionLeaseDuration))
+	}
+	if len(config.LeaderElectionIdentity) > 0 {
+		opts = append(opts, leader.WithIdentity(config.LeaderElectionIdentity))
+	}
+
+	return leader.NewElector(client, opts...)
+}
+
+// startLeaderElection takes part in the leader election and calls resync each time this replica becomes the leader.
+// The returned channel is closed after the lease has been released.
+func startLeaderElection(ctx context.Context, config *conf.Config, elector *leader.Elector, resync func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := elector.Run(ctx)
+		DieOnErr(err, "could not run leader election", config)
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-elector.Elected():
+				log.Info().Msg("Became leader, resyncing")
+				resync()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+// waitForLeaseRelease waits for the lease to be released after the context passed to startLeaderElection has been
+// canceled, so a follower can take over right away. A nil channel, i.e. leader election is disabled, returns at once.
+func waitForLeaseRelease(electorDone <-chan struct{}) {
+	if electorDone != nil {
+		waitForShutdown(electorDone)
+	}
+}
+
+// waitForShutdown waits a limited time for the daemon to shut down, e.g. to release the leader election lease.
+func waitForShutdown(stopped <-chan struct{}) {
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		log.Warn().Msg("Daemon did not shut down in time")
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
 	"github.com/spf13/pflag"
 
-	log "github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -57,14 +56,31 @@ func main() {
 	root.PersistentFlags().StringP(conf.FLAG_VAULT_PKI_MOUNT, "", conf.FLAG_VAULT_MOUNT_PKI_DEFAULT, "Path where the PKI secret engine is mounted.")
 	root.PersistentFlags().StringP(conf.FLAG_VAULT_PKI_BACKEND_ROLE, "", conf.FLAG_VAULT_PKI_BACKEND_ROLE_DEFAULT, "The name of the PKI role backend.")
 	root.PersistentFlags().StringP(conf.FLAG_CONFIG_FILE, "", "", "File to read the config from")
+	root.PersistentFlags().StringP(conf.FLAG_AUDIT_JOURNAL, "", "", "File to append audit records of issued, signed and revoked certificates to")
+	root.PersistentFlags().Int64(conf.FLAG_AUDIT_MAX_SIZE, conf.FLAG_AUDIT_MAX_SIZE_DEFAULT, "Size in bytes after which the audit journal is rotated")
+	root.PersistentFlags().Int(conf.FLAG_AUDIT_MAX_BACKUPS, conf.FLAG_AUDIT_MAX_BACKUPS_DEFAULT, "Number of rotated audit journals to keep, 0 keeps all of them")
+	root.PersistentFlags().StringP(conf.FLAG_KUBECONFIG, "", "", "Kubeconfig file(s) to access Kubernetes outside a cluster, defaults to the in-cluster config")
+	root.PersistentFlags().StringP(conf.FLAG_KUBE_CONTEXT, "", "", "Kubeconfig context to use, can be overridden per storage uri using the 'context' query parameter")
+	root.PersistentFlags().StringP(conf.FLAG_KUBE_IMPERSONATE_USER, "", "", "User to impersonate for Kubernetes requests")
+	root.PersistentFlags().StringSlice(conf.FLAG_KUBE_IMPERSONATE_GROUPS, []string{}, "Groups to impersonate for Kubernetes requests")
+	root.PersistentFlags().StringP(conf.FLAG_METRICS_TLS_CERT_FILE, "", "", "Certificate file to serve metrics and status endpoints via TLS")
+	root.PersistentFlags().StringP(conf.FLAG_METRICS_TLS_KEY_FILE, "", "", "Private key file to serve metrics and status endpoints via TLS")
 
 	root.AddCommand(getRevokeCmd())
+	root.AddCommand(getRollbackCmd())
+	root.AddCommand(getSyncStorageCmd())
 	root.AddCommand(getIssueCmd())
 	root.AddCommand(getSignCmd())
 	root.AddCommand(readCaCmd())
 	root.AddCommand(readCaChainCmd())
+	root.AddCommand(getDistributeCaCmd())
 	root.AddCommand(readCrlCmd())
 	root.AddCommand(getReadAcmeCmd())
+	root.AddCommand(getOcspCmd())
+	root.AddCommand(getAuditCmd())
+	root.AddCommand(getControlCmd())
+	root.AddCommand(getControllerCmd())
+	root.AddCommand(getCsrSignerCmd())
 	root.AddCommand(versionCmd)
 
 	if err := root.Execute(); err != nil {
@@ -98,6 +114,8 @@ func config() (*conf.Config, error) {
 	viper.SetDefault(conf.FLAG_VAULT_PKI_MOUNT, conf.FLAG_VAULT_MOUNT_PKI_DEFAULT)
 	viper.SetDefault(conf.FLAG_VAULT_APPROLE_MOUNT, conf.FLAG_VAULT_MOUNT_APPROLE_DEFAULT)
 	viper.SetDefault(conf.FLAG_VAULT_PKI_BACKEND_ROLE, conf.FLAG_VAULT_PKI_BACKEND_ROLE_DEFAULT)
+	viper.SetDefault(conf.FLAG_AUDIT_MAX_SIZE, conf.FLAG_AUDIT_MAX_SIZE_DEFAULT)
+	viper.SetDefault(conf.FLAG_AUDIT_MAX_BACKUPS, conf.FLAG_AUDIT_MAX_BACKUPS_DEFAULT)
 
 	viper.SetConfigName(defaultConfigFilename)
 	viper.SetConfigType("yaml")
@@ -115,14 +133,14 @@ func config() (*conf.Config, error) {
 
 	err := viper.ReadInConfig()
 	if err != nil && viper.IsSet(conf.FLAG_CONFIG_FILE) {
-		log.Fatal().Msgf("Can't read config: %v", err)
+		return nil, fmt.Errorf("can't read config: %w", err)
 	}
 
 	var config *conf.Config
 
 	err = viper.Unmarshal(&config)
 	if err != nil {
-		log.Fatal().Msgf("unable to decode into struct, %v", err)
+		return nil, fmt.Errorf("unable to decode into struct: %w", err)
 	}
 
 	setupLogLevel(config.Debug)
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/notification"
+	"go.uber.org/multierr"
+)
+
+func buildDispatcher(config *conf.Config) (*notification.Dispatcher, error) {
+	dispatcher := notification.NewDispatcher()
+
+	var errs error
+	for index, webhookConf := range config.Webhooks {
+		webhook, err := notification.NewWebhookFromConfig(webhookConf)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not build webhook %d: %w", index, err))
+			continue
+		}
+
+		name := webhookConf.Name
+		if len(name) == 0 {
+			name = fmt.Sprintf("webhook-%d", index)
+		}
+		dispatcher.Add(name, webhook, webhookConf.Filter)
+	}
+
+	// mails are deduplicated in memory, so they are only sent from the daemon loop to prevent flooding the recipients
+	if !config.Daemonize && len(config.Emails) > 0 {
+		log.Info().Msg("Not running as daemon, email notifications are disabled")
+		return dispatcher, errs
+	}
+
+	for index, emailConf := range config.Emails {
+		email, err := notification.NewEmailFromConfig(emailConf)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not build email notifier %d: %w", index, err))
+			continue
+		}
+
+		name := emailConf.Name
+		if len(name) == 0 {
+			name = fmt.Sprintf("email-%d", index)
+		}
+		dispatcher.Add(name, email, notification.EmailDefaultFilter(emailConf.Filter))
+	}
+
+	return dispatcher, errs
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/internal/audit"
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/hooks"
+	"github.com/soerenschneider/vault-pki-cli/internal/notification"
+	"github.com/soerenschneider/vault-pki-cli/internal/rollout"
+	"github.com/soerenschneider/vault-pki-cli/internal/storage"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+)
+
+// buildObservers returns the observers that are shared by all commands working with certificates: metrics, audit
+// journal, post-issue hooks, rollout restarts and notifications. Additional command specific observers are registered first.
+func buildObservers(config *conf.Config, operation string, additional ...pki.Observer) ([]pki.PkiServiceOpts, error) {
+	var opts []pki.PkiServiceOpts
+	for _, observer := range additional {
+		opts = append(opts, pki.WithObserver(observer))
+	}
+
+	opts = append(opts, pki.WithObserver(&internal.MetricsObserver{}))
+
+	if len(config.AuditJournal) > 0 {
+		journal, err := buildAuditJournal(config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pki.WithObserver(audit.NewObserver(journal, operation, config.VaultAddress, config.VaultPkiRole)))
+	}
+
+	postIssueHooks, err := config.PostIssueHooks()
+	if err != nil {
+		return nil, err
+	}
+	if len(postIssueHooks) > 0 {
+		env := func(cert *x509.Certificate) map[string]string {
+			return buildHookEnv(config, cert)
+		}
+		opts = append(opts, pki.WithObserver(hooks.NewObserver(postIssueHooks, env)))
+	}
+
+	if len(config.RolloutRestart) > 0 {
+		restarter, err := buildRestarter(config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pki.WithObserver(rollout.NewObserver(restarter)))
+	}
+
+	dispatcher, err := buildDispatcher(config)
+	if err != nil {
+		return nil, err
+	}
+	if dispatcher.Len() > 0 {
+		opts = append(opts, pki.WithObserver(notification.NewObserver(dispatcher, config.NotifyExpiryThreshold)))
+	}
+
+	return opts, nil
+}
+
+// buildRestarter builds the restarter for the workloads that are restarted after a new certificate has been issued.
+func buildRestarter(config *conf.Config) (*rollout.Restarter, error) {
+	targets := make([]rollout.Target, 0, len(config.RolloutRestart))
+	for _, val := range config.RolloutRestart {
+		target, err := rollout.ParseTarget(val)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	builder, err := storage.GetBuilder()
+	if err != nil {
+		return nil, err
+	}
+	client, err := builder.KubernetesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not build kubernetes client: %w", err)
+	}
+
+	var opts []rollout.RestarterOpts
+	if config.RolloutWait {
+		timeout := config.RolloutTimeout
+		if timeout <= 0 {
+			timeout = rollout.DefaultTimeout
+		}
+		opts = append(opts, rollout.WithWait(timeout))
+	}
+
+	return rollout.NewRestarter(client, targets, opts...)
+}
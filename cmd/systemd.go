@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/systemd"
+)
+
+// metricsSocketName is the FileDescriptorName= of the socket unit that is used for the metrics server
+const metricsSocketName = "metrics"
+
+// socketActivatedListener returns the socket passed by systemd for the metrics server, which is either the one named
+// 'metrics' or the only socket passed.
+func socketActivatedListener() net.Listener {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		log.Error().Err(err).Msg("could not use sockets passed by systemd")
+		return nil
+	}
+
+	if listener, ok := listeners[metricsSocketName]; ok {
+		return listener
+	}
+
+	if len(listeners) == 1 {
+		for _, listener := range listeners {
+			return listener
+		}
+	}
+
+	if len(listeners) > 1 {
+		log.Warn().Msgf("systemd passed %d sockets but none is named '%s'", len(listeners), metricsSocketName)
+	}
+	return nil
+}
+
+func sdNotify(states ...string) {
+	if _, err := systemd.Notify(states...); err != nil {
+		log.Warn().Err(err).Msg("could not notify systemd")
+	}
+}
+
+// sdWatchdog returns a ticker that ticks at half the watchdog interval, or nil if the watchdog is disabled.
+func sdWatchdog() *time.Ticker {
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Warn().Err(err).Msg("could not read systemd watchdog interval")
+		return nil
+	}
+	if interval == 0 {
+		return nil
+	}
+
+	log.Info().Msgf("Sending systemd watchdog notifications every %v", interval/2)
+	return time.NewTicker(interval / 2)
+}
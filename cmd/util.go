@@ -1,10 +1,11 @@
 package main
 
 import (
+	"crypto/x509"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/api/auth/approle"
@@ -13,9 +14,9 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/vault-pki-cli/internal"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/internal/hooks"
 	"github.com/soerenschneider/vault-pki-cli/internal/vault"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
-	"go.uber.org/multierr"
 	"golang.org/x/net/context"
 	"golang.org/x/term"
 )
@@ -62,6 +63,30 @@ func DieOnErr(err error, msg string, config ...*conf.Config) {
 	log.Fatal().Err(err).Msg(msg)
 }
 
+// startMetricsServer starts the metrics server if systemd passed a socket or an address is configured.
+func startMetricsServer(config *conf.Config, opts ...internal.MetricsServerOpts) {
+	listener := socketActivatedListener()
+	if listener == nil && len(config.MetricsAddr) == 0 {
+		return
+	}
+
+	if len(config.MetricsTlsCertFile) > 0 {
+		opts = append(opts, internal.WithTls(expandPath(config.MetricsTlsCertFile), expandPath(config.MetricsTlsKeyFile)))
+	}
+
+	if listener != nil {
+		log.Info().Msgf("Starting metrics server on socket '%s' passed by systemd", listener.Addr())
+		opts = append(opts, internal.WithListener(listener))
+	} else {
+		log.Info().Msgf("Starting metrics server at '%s'", config.MetricsAddr)
+	}
+
+	go func() {
+		err := internal.StartMetricsServer(config.MetricsAddr, opts...)
+		DieOnErr(err, "could not start metrics server", config)
+	}()
+}
+
 func buildVaultClient(config *conf.Config) (*api.Client, error) {
 	vaultConfig := getVaultConfig(config)
 	vaultClient, err := api.NewClient(vaultConfig)
@@ -117,21 +142,35 @@ func initLogging() {
 	}
 }
 
-func runPostIssueHooks(ctx context.Context, config *conf.Config) error {
-	if len(config.PostHooks) > 0 {
-		log.Info().Msg("Running post-issue hooks")
+const hookEnvPrefix = "VAULT_PKI_CLI_"
+
+// buildHookEnv returns the environment variables that are passed to the hooks. The certificate may be nil, e.g. for
+// hooks that run after a CRL has been updated.
+func buildHookEnv(config *conf.Config, cert *x509.Certificate) map[string]string {
+	env := map[string]string{}
+	if cert != nil {
+		env[hookEnvPrefix+"SERIAL"] = pkg.FormatSerial(cert.SerialNumber)
+		env[hookEnvPrefix+"COMMON_NAME"] = cert.Subject.CommonName
+		env[hookEnvPrefix+"NOT_AFTER"] = cert.NotAfter.Format(time.RFC3339)
+	} else if len(config.CommonName) > 0 {
+		env[hookEnvPrefix+"COMMON_NAME"] = config.CommonName
 	}
 
-	var err error
-	for _, hook := range config.PostHooks {
-		log.Info().Msgf("Running command '%s'", hook)
-		parsed := strings.Split(hook, " ")
-		cmd := exec.CommandContext(ctx, parsed[0], parsed[1:]...) //#nosec G204
-		cmdErr := cmd.Run()
-		if cmdErr != nil {
-			err = multierr.Append(err, fmt.Errorf("%w: cmd '%s' failed: %v", pkg.ErrRunHook, parsed[0], cmdErr))
+	for index, storage := range config.StorageConfig {
+		for slot, uri := range storage {
+			key := fmt.Sprintf("%sSTORAGE_%d_%s", hookEnvPrefix, index, strings.ToUpper(strings.ReplaceAll(slot, "-", "_")))
+			env[key] = uri
 		}
 	}
 
-	return err
+	return env
+}
+
+func runPostIssueHooks(ctx context.Context, config *conf.Config, env map[string]string) error {
+	postIssueHooks, err := config.PostIssueHooks()
+	if err != nil {
+		return fmt.Errorf("%w: %v", pkg.ErrRunHook, err)
+	}
+
+	return hooks.NewRunner(postIssueHooks).Run(ctx, env)
 }
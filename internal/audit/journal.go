@@ -0,0 +1,265 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OperationIssue    = "issue"
+	OperationSign     = "sign"
+	OperationRevoke   = "revoke"
+	OperationReadAcme = "read-acme"
+
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+
+	DefaultMaxSize    = 10 * 1024 * 1024
+	DefaultMaxBackups = 5
+
+	// maxRecordSize limits the size of a single line that is read from the journal
+	maxRecordSize = 1024 * 1024
+)
+
+// Record is a single entry of the audit journal.
+type Record struct {
+	Time         time.Time  `json:"time"`
+	Operation    string     `json:"operation"`
+	CommonName   string     `json:"common_name,omitempty"`
+	Sans         []string   `json:"sans,omitempty"`
+	Serial       string     `json:"serial,omitempty"`
+	NotBefore    *time.Time `json:"not_before,omitempty"`
+	NotAfter     *time.Time `json:"not_after,omitempty"`
+	VaultAddress string     `json:"vault_address,omitempty"`
+	Role         string     `json:"role,omitempty"`
+	Outcome      string     `json:"outcome"`
+	ErrorLabel   string     `json:"error_label,omitempty"`
+}
+
+// Journal is an append-only JSON-lines file. If a write would exceed the maximum size, the file is rotated and up to
+// maxBackups old files are kept, e.g. 'audit.log.1' to 'audit.log.5' with '.1' being the most recent one. If maxBackups
+// is 0, all rotated files are kept, records are never deleted.
+type Journal struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	mutex      sync.Mutex
+}
+
+type JournalOpt func(j *Journal) error
+
+func WithMaxSize(bytes int64) JournalOpt {
+	return func(j *Journal) error {
+		if bytes <= 0 {
+			return fmt.Errorf("invalid max size %d", bytes)
+		}
+		j.maxSize = bytes
+		return nil
+	}
+}
+
+func WithMaxBackups(backups int) JournalOpt {
+	return func(j *Journal) error {
+		if backups < 0 {
+			return fmt.Errorf("invalid number of backups %d", backups)
+		}
+		j.maxBackups = backups
+		return nil
+	}
+}
+
+func NewJournal(path string, opts ...JournalOpt) (*Journal, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty journal path")
+	}
+
+	ret := &Journal{
+		path:       path,
+		maxSize:    DefaultMaxSize,
+		maxBackups: DefaultMaxBackups,
+	}
+
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (j *Journal) Append(record Record) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not marshal audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := j.rotateIfNeeded(int64(len(line))); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open audit journal: %w", err)
+	}
+
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write audit record: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not sync audit journal: %w", err)
+	}
+
+	return file.Close()
+}
+
+func (j *Journal) rotateIfNeeded(size int64) error {
+	info, err := os.Stat(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Size()+size <= j.maxSize {
+		return nil
+	}
+
+	backups := j.maxBackups
+	if backups == 0 {
+		// keep all rotated files by shifting all of them
+		backups = j.countBackups() + 1
+	}
+
+	for i := backups - 1; i >= 1; i-- {
+		err := os.Rename(j.backupPath(i), j.backupPath(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("could not rotate audit journal: %w", err)
+		}
+	}
+
+	if err := os.Rename(j.path, j.backupPath(1)); err != nil {
+		return fmt.Errorf("could not rotate audit journal: %w", err)
+	}
+
+	return nil
+}
+
+func (j *Journal) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", j.path, index)
+}
+
+// countBackups returns the number of consecutive rotated files, starting at '.1'.
+func (j *Journal) countBackups() int {
+	count := 0
+	for {
+		if _, err := os.Stat(j.backupPath(count + 1)); err != nil {
+			return count
+		}
+		count++
+	}
+}
+
+// Query returns all records, including the ones of rotated files, that match the filter in chronological order.
+func (j *Journal) Query(filter Filter) ([]Record, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	backups := j.maxBackups
+	if backups == 0 {
+		backups = j.countBackups()
+	}
+
+	files := []string{j.path}
+	for i := 1; i <= backups; i++ {
+		files = append(files, j.backupPath(i))
+	}
+	slices.Reverse(files)
+
+	var ret []Record
+	for _, file := range files {
+		records, err := readRecords(file, filter)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, records...)
+	}
+
+	return ret, nil
+}
+
+func readRecords(path string, filter Filter) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ret []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("could not parse record %s:%d: %w", path, lineNumber, err)
+		}
+		if filter.Matches(record) {
+			ret = append(ret, record)
+		}
+	}
+
+	return ret, scanner.Err()
+}
+
+// Filter selects records of the journal. Empty fields match all records.
+type Filter struct {
+	CommonName string
+	Serial     string
+	Since      time.Time
+	Until      time.Time
+}
+
+func (f Filter) Matches(record Record) bool {
+	if len(f.CommonName) > 0 && record.CommonName != f.CommonName {
+		return false
+	}
+
+	if len(f.Serial) > 0 && !strings.EqualFold(record.Serial, f.Serial) {
+		return false
+	}
+
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && record.Time.After(f.Until) {
+		return false
+	}
+
+	return true
+}
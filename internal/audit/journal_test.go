@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal_Query(t *testing.T) {
+	journal, err := NewJournal(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	records := []Record{
+		{Time: now.Add(-3 * time.Hour), Operation: OperationIssue, CommonName: "a", Serial: "aa:bb", Outcome: OutcomeSuccess},
+		{Time: now.Add(-2 * time.Hour), Operation: OperationIssue, CommonName: "b", Outcome: OutcomeFailure, ErrorLabel: "unknown"},
+		{Time: now.Add(-1 * time.Hour), Operation: OperationRevoke, Serial: "aa:bb", Outcome: OutcomeSuccess},
+	}
+	for _, record := range records {
+		if err := journal.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{name: "all", filter: Filter{}, want: 3},
+		{name: "cn", filter: Filter{CommonName: "b"}, want: 1},
+		{name: "serial case insensitive", filter: Filter{Serial: "AA:BB"}, want: 2},
+		{name: "since", filter: Filter{Since: now.Add(-150 * time.Minute)}, want: 2},
+		{name: "until", filter: Filter{Until: now.Add(-150 * time.Minute)}, want: 1},
+		{name: "no match", filter: Filter{CommonName: "c"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := journal.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("Query() returned %d records, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestJournal_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	journal, err := NewJournal(path, WithMaxSize(200), WithMaxBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		record := Record{Time: start.Add(time.Duration(i) * time.Minute), Operation: OperationIssue, CommonName: "example.com", Outcome: OutcomeSuccess}
+		if err := journal.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("expected file %s: %v", file, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("file %s exceeds max size: %d", file, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("expected at most 2 backups")
+	}
+
+	records, err := journal.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || len(records) >= 10 {
+		t.Fatalf("expected old records to be dropped, got %d records", len(records))
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Before(records[i-1].Time) {
+			t.Errorf("records are not in chronological order")
+		}
+	}
+	if !records[len(records)-1].Time.Equal(start.Add(9 * time.Minute)) {
+		t.Errorf("expected most recent record to be last")
+	}
+}
+
+func TestJournal_RotateKeepAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	journal, err := NewJournal(path, WithMaxSize(200), WithMaxBackups(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		record := Record{Time: start.Add(time.Duration(i) * time.Minute), Operation: OperationIssue, CommonName: "example.com", Outcome: OutcomeSuccess}
+		if err := journal.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if journal.countBackups() < 3 {
+		t.Errorf("expected all rotated files to be kept, got %d", journal.countBackups())
+	}
+
+	records, err := journal.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 {
+		t.Fatalf("expected no records to be dropped, got %d records", len(records))
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Before(records[i-1].Time) {
+			t.Errorf("records are not in chronological order")
+		}
+	}
+}
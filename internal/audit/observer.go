@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"crypto/x509"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+)
+
+// Observer writes a record to the journal for every issuance, signature and revocation. Skipped renewals are not
+// recorded. Errors writing the journal are logged but do not fail the operation.
+type Observer struct {
+	journal      *Journal
+	operation    string
+	vaultAddress string
+	role         string
+}
+
+func NewObserver(journal *Journal, operation, vaultAddress, role string) *Observer {
+	return &Observer{
+		journal:      journal,
+		operation:    operation,
+		vaultAddress: vaultAddress,
+		role:         role,
+	}
+}
+
+func (o *Observer) OnEvent(_ context.Context, event pki.Event) error {
+	var record Record
+	switch e := event.(type) {
+	case pki.CertIssued:
+		record = o.success(e.Result.IssuedCert)
+	case pki.IssueFailed:
+		record = o.failure(e.CommonName, e.Err)
+	case pki.CertSigned:
+		record = o.success(e.Cert)
+	case pki.SignFailed:
+		record = o.failure(e.CommonName, e.Err)
+	case pki.CertRevoked:
+		record = o.record(OperationRevoke, OutcomeSuccess)
+		record.Serial = e.Serial
+	case pki.RevokeFailed:
+		record = o.record(OperationRevoke, OutcomeFailure)
+		record.Serial = e.Serial
+		record.ErrorLabel = internal.TranslateErrToPromLabel(e.Err)
+	default:
+		return nil
+	}
+
+	if err := o.journal.Append(record); err != nil {
+		log.Error().Err(err).Str("event", event.EventName()).Msg("Could not write audit record")
+	}
+	return nil
+}
+
+func (o *Observer) record(operation, outcome string) Record {
+	return Record{
+		Operation:    operation,
+		VaultAddress: o.vaultAddress,
+		Role:         o.role,
+		Outcome:      outcome,
+	}
+}
+
+func (o *Observer) success(cert *x509.Certificate) Record {
+	record := o.record(o.operation, OutcomeSuccess)
+	if cert == nil {
+		return record
+	}
+
+	record.CommonName = cert.Subject.CommonName
+	record.Serial = pkg.FormatSerial(cert.SerialNumber)
+	record.NotBefore = &cert.NotBefore
+	record.NotAfter = &cert.NotAfter
+	record.Sans = append(record.Sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		record.Sans = append(record.Sans, ip.String())
+	}
+	record.Sans = append(record.Sans, cert.EmailAddresses...)
+
+	return record
+}
+
+func (o *Observer) failure(commonName string, err error) Record {
+	record := o.record(o.operation, OutcomeFailure)
+	record.CommonName = commonName
+	record.ErrorLabel = internal.TranslateErrToPromLabel(err)
+	return record
+}
@@ -0,0 +1,397 @@
+package cabundle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// LabelManaged marks the ConfigMaps that have been created by the distributor. ConfigMaps without this label are
+	// never modified or deleted.
+	LabelManaged = "vault-pki-cli/ca-bundle"
+	// AnnotationReleased marks ConfigMaps the distributor has removed its bundle from while others still use them.
+	// They are managed again once their namespace matches the selector again.
+	AnnotationReleased = "vault-pki-cli/ca-bundle-released"
+
+	DefaultConfigMapName   = "vault-pki-ca-bundle"
+	DefaultKey             = "ca.crt"
+	DefaultRefreshInterval = time.Hour
+)
+
+// BundleFunc returns the current CA bundle, usually the CA chain read from Vault.
+type BundleFunc func() ([]byte, error)
+
+// Distributor writes the CA bundle into a ConfigMap in each namespace that matches the label selector and removes it
+// from namespaces that do not match (anymore).
+type Distributor struct {
+	client          kubernetes.Interface
+	bundleFunc      BundleFunc
+	selector        labels.Selector
+	configMapName   string
+	key             string
+	refreshInterval time.Duration
+
+	bundle []byte
+	mutex  sync.RWMutex
+
+	factory    informers.SharedInformerFactory
+	namespaces listerscorev1.NamespaceLister
+	informer   cache.SharedIndexInformer
+	queue      workqueue.RateLimitingInterface
+}
+
+type DistributorOpts func(*Distributor) error
+
+// WithNamespaceSelector restricts the namespaces the bundle is distributed to. By default, all namespaces are used.
+func WithNamespaceSelector(selector string) DistributorOpts {
+	return func(d *Distributor) error {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return fmt.Errorf("invalid namespace selector '%s': %w", selector, err)
+		}
+		d.selector = parsed
+		return nil
+	}
+}
+
+func WithConfigMapName(name string) DistributorOpts {
+	return func(d *Distributor) error {
+		if len(name) == 0 {
+			return errors.New("empty configmap name provided")
+		}
+		d.configMapName = name
+		return nil
+	}
+}
+
+// WithKey sets the key in the ConfigMap's data the bundle is stored under.
+func WithKey(key string) DistributorOpts {
+	return func(d *Distributor) error {
+		if len(key) == 0 {
+			return errors.New("empty key provided")
+		}
+		d.key = key
+		return nil
+	}
+}
+
+// WithRefreshInterval sets the interval in daemon mode after which the bundle is read again and all ConfigMaps are
+// checked for drift.
+func WithRefreshInterval(interval time.Duration) DistributorOpts {
+	return func(d *Distributor) error {
+		if interval < time.Minute {
+			return fmt.Errorf("refresh interval must be at least 1m, got %v", interval)
+		}
+		d.refreshInterval = interval
+		return nil
+	}
+}
+
+func NewDistributor(client kubernetes.Interface, bundleFunc BundleFunc, opts ...DistributorOpts) (*Distributor, error) {
+	if client == nil {
+		return nil, errors.New("nil kubernetes client provided")
+	}
+
+	if bundleFunc == nil {
+		return nil, errors.New("nil bundle func provided")
+	}
+
+	ret := &Distributor{
+		client:          client,
+		bundleFunc:      bundleFunc,
+		selector:        labels.Everything(),
+		configMapName:   DefaultConfigMapName,
+		key:             DefaultKey,
+		refreshInterval: DefaultRefreshInterval,
+	}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return ret, nil
+}
+
+// Sync reads the bundle and distributes it to all namespaces once.
+func (d *Distributor) Sync(ctx context.Context) error {
+	if err := d.refreshBundle(); err != nil {
+		return err
+	}
+
+	namespaces, err := d.client.CoreV1().Namespaces().List(ctx, meta.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list namespaces: %w", err)
+	}
+
+	var errs []error
+	for i := range namespaces.Items {
+		if err := d.syncNamespace(ctx, &namespaces.Items[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run watches namespaces and keeps the ConfigMaps up to date until the context is canceled. Namespaces that are
+// created or relabeled are handled right away, the bundle is read again after each refresh interval.
+func (d *Distributor) Run(ctx context.Context) error {
+	if err := d.refreshBundle(); err != nil {
+		return err
+	}
+
+	d.queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	d.factory = informers.NewSharedInformerFactory(d.client, 0)
+	d.informer = d.factory.Core().V1().Namespaces().Informer()
+	d.namespaces = d.factory.Core().V1().Namespaces().Lister()
+	_, err := d.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: d.enqueue,
+		UpdateFunc: func(oldObj, newObj any) {
+			oldNs, okOld := oldObj.(*corev1.Namespace)
+			newNs, okNew := newObj.(*corev1.Namespace)
+			if okOld && okNew && !reflect.DeepEqual(oldNs.Labels, newNs.Labels) {
+				d.enqueue(newObj)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not add event handler for namespaces: %w", err)
+	}
+
+	d.factory.Start(ctx.Done())
+	defer d.factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), d.informer.HasSynced) {
+		d.queue.ShutDown()
+		return errors.New("could not sync caches")
+	}
+
+	log.Info().Msgf("Distributing ca bundle to configmap '%s' in namespaces matching '%s'", d.configMapName, d.selector)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for d.processNextItem(ctx) {
+		}
+	}()
+
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			d.queue.ShutDown()
+			<-done
+			return nil
+		case <-ticker.C:
+			if err := d.refreshBundle(); err != nil {
+				log.Error().Err(err).Msg("Could not refresh ca bundle, keeping the current bundle")
+			}
+			// also enqueue all namespaces if the bundle did not change, to revert changes made by others
+			for _, obj := range d.informer.GetStore().List() {
+				d.enqueue(obj)
+			}
+		}
+	}
+}
+
+func (d *Distributor) enqueue(obj any) {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	d.queue.Add(namespace.Name)
+}
+
+func (d *Distributor) processNextItem(ctx context.Context) bool {
+	item, shutdown := d.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer d.queue.Done(item)
+
+	name := item.(string)
+	namespace, err := d.namespaces.Get(name)
+	if err != nil {
+		// the namespace has been deleted in the meantime, its configmap is gone as well
+		d.queue.Forget(item)
+		return true
+	}
+
+	if err := d.syncNamespace(ctx, namespace); err != nil {
+		log.Error().Err(err).Str("namespace", name).Msg("Distributing ca bundle failed, retrying")
+		d.queue.AddRateLimited(item)
+		return true
+	}
+
+	d.queue.Forget(item)
+	return true
+}
+
+func (d *Distributor) refreshBundle() error {
+	bundle, err := d.bundleFunc()
+	if err != nil {
+		return fmt.Errorf("could not read ca bundle: %w", err)
+	}
+	if len(bundle) == 0 {
+		return errors.New("empty ca bundle")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !bytes.Equal(d.bundle, bundle) && d.bundle != nil {
+		log.Info().Msg("Ca bundle has changed")
+	}
+	d.bundle = bundle
+	return nil
+}
+
+func (d *Distributor) currentBundle() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return string(d.bundle)
+}
+
+func (d *Distributor) syncNamespace(ctx context.Context, namespace *corev1.Namespace) error {
+	if namespace.Status.Phase == corev1.NamespaceTerminating {
+		return nil
+	}
+
+	if d.selector.Matches(labels.Set(namespace.Labels)) {
+		return d.ensure(ctx, namespace.Name)
+	}
+	return d.remove(ctx, namespace.Name)
+}
+
+// ensure creates or updates the ConfigMap in the namespace. ConfigMaps are only updated if their content differs.
+func (d *Distributor) ensure(ctx context.Context, namespace string) error {
+	bundle := d.currentBundle()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := d.client.CoreV1().ConfigMaps(namespace).Get(ctx, d.configMapName, meta.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: meta.ObjectMeta{
+					Name:      d.configMapName,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"app":        "k8s-cli-pki",
+						LabelManaged: "true",
+					},
+				},
+				Data: map[string]string{
+					d.key: bundle,
+				},
+			}
+			_, err = d.client.CoreV1().ConfigMaps(namespace).Create(ctx, configMap, meta.CreateOptions{})
+			if err == nil {
+				log.Info().Msgf("Created ca bundle configmap '%s/%s'", namespace, d.configMapName)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		released := existing.Annotations[AnnotationReleased] == "true"
+		if existing.Labels[LabelManaged] != "true" && !released {
+			return fmt.Errorf("configmap exists but is not managed, missing label '%s'", LabelManaged)
+		}
+
+		if existing.Data[d.key] == bundle && !released {
+			return nil
+		}
+
+		configMap := existing.DeepCopy()
+		if released {
+			delete(configMap.Annotations, AnnotationReleased)
+			if configMap.Labels == nil {
+				configMap.Labels = map[string]string{}
+			}
+			configMap.Labels[LabelManaged] = "true"
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[d.key] = bundle
+		_, err = d.client.CoreV1().ConfigMaps(namespace).Update(ctx, configMap, meta.UpdateOptions{})
+		if err == nil {
+			log.Info().Msgf("Updated ca bundle configmap '%s/%s'", namespace, d.configMapName)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write ca bundle configmap '%s/%s': %w", namespace, d.configMapName, err)
+	}
+
+	return nil
+}
+
+// remove removes the bundle from a managed ConfigMap in the namespace. The ConfigMap is deleted if the bundle was its
+// only content.
+func (d *Distributor) remove(ctx context.Context, namespace string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := d.client.CoreV1().ConfigMaps(namespace).Get(ctx, d.configMapName, meta.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if existing.Labels[LabelManaged] != "true" {
+			return nil
+		}
+
+		if _, ok := existing.Data[d.key]; ok && len(existing.Data) == 1 && len(existing.BinaryData) == 0 {
+			err = d.client.CoreV1().ConfigMaps(namespace).Delete(ctx, d.configMapName, meta.DeleteOptions{
+				Preconditions: &meta.Preconditions{ResourceVersion: &existing.ResourceVersion},
+			})
+			if err == nil || k8sErrors.IsNotFound(err) {
+				log.Info().Msgf("Deleted ca bundle configmap '%s/%s'", namespace, d.configMapName)
+				return nil
+			}
+			return err
+		}
+
+		// others have added data to the configmap, only remove the bundle and stop managing it until the namespace
+		// matches again
+		configMap := existing.DeepCopy()
+		delete(configMap.Data, d.key)
+		delete(configMap.Labels, LabelManaged)
+		if configMap.Annotations == nil {
+			configMap.Annotations = map[string]string{}
+		}
+		configMap.Annotations[AnnotationReleased] = "true"
+		_, err = d.client.CoreV1().ConfigMaps(namespace).Update(ctx, configMap, meta.UpdateOptions{})
+		if err == nil {
+			log.Info().Msgf("Removed ca bundle from configmap '%s/%s'", namespace, d.configMapName)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not remove ca bundle from configmap '%s/%s': %w", namespace, d.configMapName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package cabundle
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const bundle = "-----BEGIN CERTIFICATE-----\nca\n-----END CERTIFICATE-----\n"
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: meta.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func managedConfigMap(namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      DefaultConfigMapName,
+			Namespace: namespace,
+			Labels:    map[string]string{LabelManaged: "true"},
+		},
+		Data: data,
+	}
+}
+
+func staticBundle() ([]byte, error) {
+	return []byte(bundle), nil
+}
+
+func countActions(client *fake.Clientset, verb string) int {
+	count := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == verb && action.GetResource().Resource == "configmaps" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDistributor_Sync(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		namespace("team-a", map[string]string{"trust": "internal"}),
+		namespace("team-b", map[string]string{"trust": "internal"}),
+		namespace("former", nil),
+		namespace("shared", nil),
+		namespace("foreign", nil),
+		managedConfigMap("former", map[string]string{DefaultKey: "old"}),
+		managedConfigMap("shared", map[string]string{DefaultKey: "old", "other": "data"}),
+		&corev1.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{Name: DefaultConfigMapName, Namespace: "foreign"},
+			Data:       map[string]string{DefaultKey: "foreign"},
+		},
+	)
+
+	distributor, err := NewDistributor(client, staticBundle, WithNamespaceSelector("trust=internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := distributor.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, ns := range []string{"team-a", "team-b"} {
+		configMap, err := client.CoreV1().ConfigMaps(ns).Get(context.Background(), DefaultConfigMapName, meta.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected configmap in namespace %s: %v", ns, err)
+		}
+		if configMap.Data[DefaultKey] != bundle {
+			t.Errorf("unexpected bundle in namespace %s: %q", ns, configMap.Data[DefaultKey])
+		}
+	}
+
+	if _, err := client.CoreV1().ConfigMaps("former").Get(context.Background(), DefaultConfigMapName, meta.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Errorf("expected configmap in namespace 'former' to be deleted, got %v", err)
+	}
+
+	shared, err := client.CoreV1().ConfigMaps("shared").Get(context.Background(), DefaultConfigMapName, meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shared.Data[DefaultKey]; ok || shared.Data["other"] != "data" {
+		t.Errorf("expected only the bundle to be removed from shared configmap, got %v", shared.Data)
+	}
+
+	foreign, err := client.CoreV1().ConfigMaps("foreign").Get(context.Background(), DefaultConfigMapName, meta.GetOptions{})
+	if err != nil || foreign.Data[DefaultKey] != "foreign" {
+		t.Errorf("unmanaged configmap must not be modified, got %v, %v", foreign, err)
+	}
+
+	// nothing changed, no further writes
+	updates, creates := countActions(client, "update"), countActions(client, "create")
+	if err := distributor.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if countActions(client, "update") != updates || countActions(client, "create") != creates {
+		t.Errorf("expected no writes if the content did not change")
+	}
+}
+
+func TestDistributor_SyncReleased(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		namespace("shared", nil),
+		managedConfigMap("shared", map[string]string{DefaultKey: "old", "other": "data"}),
+	)
+
+	distributor, err := NewDistributor(client, staticBundle, WithNamespaceSelector("trust=internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := distributor.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	// the namespace matches again, the released configmap is taken over
+	if _, err := client.CoreV1().Namespaces().Update(context.Background(), namespace("shared", map[string]string{"trust": "internal"}), meta.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := distributor.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	shared, err := client.CoreV1().ConfigMaps("shared").Get(context.Background(), DefaultConfigMapName, meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.Data[DefaultKey] != bundle || shared.Data["other"] != "data" {
+		t.Errorf("expected bundle to be added to shared configmap, got %v", shared.Data)
+	}
+	if shared.Labels[LabelManaged] != "true" || len(shared.Annotations[AnnotationReleased]) > 0 {
+		t.Errorf("expected configmap to be managed again, got %v, %v", shared.Labels, shared.Annotations)
+	}
+}
+
+func TestDistributor_SyncUnmanagedConflict(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		namespace("team-a", nil),
+		&corev1.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{Name: DefaultConfigMapName, Namespace: "team-a"},
+			Data:       map[string]string{"other": "data"},
+		},
+	)
+
+	distributor, err := NewDistributor(client, staticBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := distributor.Sync(context.Background()); err == nil {
+		t.Error("expected error writing to unmanaged configmap")
+	}
+}
+
+func TestDistributor_Run(t *testing.T) {
+	client := fake.NewSimpleClientset(namespace("team-a", map[string]string{"trust": "internal"}))
+
+	distributor, err := NewDistributor(client, staticBundle, WithNamespaceSelector("trust=internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- distributor.Run(ctx)
+	}()
+
+	waitFor := func(ns string, exists bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			_, err := client.CoreV1().ConfigMaps(ns).Get(context.Background(), DefaultConfigMapName, meta.GetOptions{})
+			if (err == nil) == exists {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for configmap in namespace %s, exists=%t", ns, exists)
+	}
+
+	waitFor("team-a", true)
+
+	// namespaces created later receive the bundle as well
+	if _, err := client.CoreV1().Namespaces().Create(context.Background(), namespace("team-b", map[string]string{"trust": "internal"}), meta.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("team-b", true)
+
+	// namespaces that stop matching lose the bundle
+	if _, err := client.CoreV1().Namespaces().Update(context.Background(), namespace("team-a", nil), meta.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("team-a", false)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestNewDistributor(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	if _, err := NewDistributor(client, staticBundle, WithNamespaceSelector("trust in (")); err == nil {
+		t.Error("expected error for invalid selector")
+	}
+	if _, err := NewDistributor(client, staticBundle, WithRefreshInterval(time.Second)); err == nil {
+		t.Error("expected error for too short refresh interval")
+	}
+	if _, err := NewDistributor(client, nil); err == nil {
+		t.Error("expected error for nil bundle func")
+	}
+}
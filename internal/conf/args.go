@@ -20,18 +20,83 @@ const (
 	FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE = "lifetime-threshold-percent"
 	FLAG_ISSUE_PRIVATE_KEY_FILE              = "private-key-file"
 	FLAG_ISSUE_BACKEND_CONFIG                = "backend-config"
+	FLAG_STORAGE_PARALLEL_WRITES             = "storage-parallel-writes"
+	FLAG_ISSUE_CHECK_REVOCATION              = "check-revocation"
+	FLAG_ISSUE_CHECK_REVOCATION_DELTA        = "check-revocation-delta"
+	FLAG_ISSUE_CHECK_REVOCATION_UNIFIED      = "check-revocation-unified"
+	FLAG_ISSUE_REVOCATION_GRACE_PERIOD       = "revocation-grace-period"
+	FLAG_ISSUE_REVOCATION_QUEUE_FILE         = "revocation-queue-file"
+	FLAG_ISSUE_PRE_HOOKS_DELAY_EXIT_CODE     = "pre-issue-hooks-delay-exit-code"
+	FLAG_ISSUE_PRE_HOOKS_RETRY_DELAY         = "pre-issue-hooks-retry-delay"
 	FLAG_READACME_ACME_PREFIX                = "acme-prefix"
 
-	FLAG_ISSUE_TTL          = "ttl"
-	FLAG_RETRIES            = "retries"
-	FLAG_RETRIES_DEFAULT    = 15
-	FLAG_ISSUE_DAEMONIZE    = "daemonize"
-	FLAG_ISSUE_IP_SANS      = "ip-sans"
-	FLAG_ISSUE_COMMON_NAME  = "common-name"
-	FLAG_ISSUE_ALT_NAMES    = "alt-names"
-	FLAG_METRICS_FILE       = "metrics-file"
-	FLAG_ISSUE_METRICS_ADDR = "metrics-addr"
-	FLAG_ISSUE_HOOKS        = "hooks"
+	FLAG_ISSUE_TTL           = "ttl"
+	FLAG_RETRIES             = "retries"
+	FLAG_RETRIES_DEFAULT     = 15
+	FLAG_ISSUE_DAEMONIZE     = "daemonize"
+	FLAG_ISSUE_IP_SANS       = "ip-sans"
+	FLAG_ISSUE_COMMON_NAME   = "common-name"
+	FLAG_ISSUE_ALT_NAMES     = "alt-names"
+	FLAG_METRICS_FILE        = "metrics-file"
+	FLAG_ISSUE_METRICS_ADDR  = "metrics-addr"
+	FLAG_ISSUE_HOOKS         = "hooks"
+	FLAG_ROLLBACK_SKIP_HOOKS = "skip-hooks"
+	FLAG_SYNC_CHECK_ONLY     = "check"
+
+	FLAG_METRICS_TLS_CERT_FILE = "metrics-tls-cert-file"
+	FLAG_METRICS_TLS_KEY_FILE  = "metrics-tls-key-file"
+	FLAG_HEALTH_STALL_TIMEOUT  = "health-stall-timeout"
+
+	FLAG_WATCH_CONFIG = "watch-config"
+
+	FLAG_KUBECONFIG              = "kubeconfig"
+	FLAG_KUBE_CONTEXT            = "kube-context"
+	FLAG_KUBE_IMPERSONATE_USER   = "kube-as"
+	FLAG_KUBE_IMPERSONATE_GROUPS = "kube-as-group"
+
+	FLAG_LEADER_ELECTION                = "leader-election"
+	FLAG_LEADER_ELECTION_NAMESPACE      = "leader-election-namespace"
+	FLAG_LEADER_ELECTION_LEASE_NAME     = "leader-election-lease-name"
+	FLAG_LEADER_ELECTION_LEASE_DURATION = "leader-election-lease-duration"
+	FLAG_LEADER_ELECTION_IDENTITY       = "leader-election-identity"
+
+	FLAG_CONTROLLER_NAMESPACE       = "controller-namespace"
+	FLAG_CONTROLLER_KINDS           = "controller-kinds"
+	FLAG_CONTROLLER_WORKERS         = "controller-workers"
+	FLAG_CONTROLLER_RESYNC_INTERVAL = "controller-resync-interval"
+	FLAG_CONTROLLER_ALLOWED_ROLES   = "controller-allowed-roles"
+
+	FLAG_CA_BUNDLE_NAMESPACE_SELECTOR = "ca-bundle-namespace-selector"
+	FLAG_CA_BUNDLE_CONFIGMAP_NAME     = "ca-bundle-configmap-name"
+	FLAG_CA_BUNDLE_KEY                = "ca-bundle-key"
+	FLAG_CA_BUNDLE_REFRESH_INTERVAL   = "ca-bundle-refresh-interval"
+
+	FLAG_ROLLOUT_RESTART = "rollout-restart"
+	FLAG_ROLLOUT_WAIT    = "rollout-wait"
+	FLAG_ROLLOUT_TIMEOUT = "rollout-timeout"
+
+	FLAG_SIGNER_NAME               = "signer-name"
+	FLAG_SIGNER_AUTO_APPROVE       = "signer-auto-approve"
+	FLAG_SIGNER_ALLOWED_USAGES     = "signer-allowed-usages"
+	FLAG_SIGNER_ALLOWED_NAMES      = "signer-allowed-names"
+	FLAG_SIGNER_ALLOWED_REQUESTERS = "signer-allowed-requesters"
+
+	FLAG_CONTROL_ADDR       = "control-addr"
+	FLAG_CONTROL_TOKEN_FILE = "control-token-file" // #nosec G101
+
+	FLAG_OCSP_RESPONDER = "ocsp-responder"
+	FLAG_OCSP_USE_AIA   = "ocsp-use-aia"
+
+	FLAG_NOTIFY_EXPIRY_THRESHOLD = "notify-expiry-threshold"
+
+	FLAG_AUDIT_JOURNAL     = "audit-journal"
+	FLAG_AUDIT_MAX_SIZE    = "audit-max-size"
+	FLAG_AUDIT_MAX_BACKUPS = "audit-max-backups"
+	FLAG_AUDIT_CN          = "cn"
+	FLAG_AUDIT_SERIAL      = "serial"
+	FLAG_AUDIT_SINCE       = "since"
+	FLAG_AUDIT_UNTIL       = "until"
+	FLAG_AUDIT_JSON        = "json"
 
 	FLAG_OUTPUT_FILE = "output-file"
 	FLAG_DER_ENCODED = "der-encoding"
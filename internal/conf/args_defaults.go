@@ -1,5 +1,7 @@
 package conf
 
+import "time"
+
 const (
 	FLAG_VAULT_PKI_BACKEND_ROLE_DEFAULT              = "my_role"
 	FLAG_VAULT_MOUNT_APPROLE_DEFAULT                 = "approle"
@@ -8,9 +10,27 @@ const (
 	FLAG_ISSUE_TTL_DEFAULT                           = "48h"
 	FLAG_FILE_OWNER_DEFAULT                          = "root"
 	FLAG_ISSUE_DAEMONIZE_DEFAULT                     = false
+	FLAG_ISSUE_CHECK_REVOCATION_DEFAULT              = false
+	FLAG_ISSUE_REVOCATION_GRACE_PERIOD_DEFAULT       = 0 * time.Second
+	FLAG_ISSUE_PRE_HOOKS_DELAY_EXIT_CODE_DEFAULT     = 75
+	FLAG_ISSUE_PRE_HOOKS_RETRY_DELAY_DEFAULT         = 10 * time.Minute
+	FLAG_NOTIFY_EXPIRY_THRESHOLD_DEFAULT             = 72 * time.Hour
+	FLAG_AUDIT_MAX_SIZE_DEFAULT                      = 10 * 1024 * 1024
+	FLAG_AUDIT_MAX_BACKUPS_DEFAULT                   = 5
+	FLAG_HEALTH_STALL_TIMEOUT_DEFAULT                = 15 * time.Minute
+	FLAG_LEADER_ELECTION_LEASE_NAME_DEFAULT          = "vault-pki-cli"
+	FLAG_LEADER_ELECTION_LEASE_DURATION_DEFAULT      = 15 * time.Second
+	FLAG_CONTROLLER_WORKERS_DEFAULT                  = 2
+	FLAG_CONTROLLER_RESYNC_INTERVAL_DEFAULT          = 1 * time.Hour
+	FLAG_ROLLOUT_TIMEOUT_DEFAULT                     = 5 * time.Minute
+	FLAG_CA_BUNDLE_CONFIGMAP_NAME_DEFAULT            = "vault-pki-ca-bundle"
+	FLAG_CA_BUNDLE_KEY_DEFAULT                       = "ca.crt"
+	FLAG_CA_BUNDLE_REFRESH_INTERVAL_DEFAULT          = 1 * time.Hour
 
 	FLAG_READACME_ACME_PREFIX_DEFAULT = "acmevault/prod"
 
 	FLAG_VAULT_MOUNT_PKI_DEFAULT    = "pki_intermediate"
 	FLAG_ISSUE_METRICS_ADDR_DEFAULT = ":9172"
 )
+
+var FLAG_CONTROLLER_KINDS_DEFAULT = []string{"secret"}
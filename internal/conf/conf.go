@@ -8,6 +8,8 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/hooks"
+	"github.com/soerenschneider/vault-pki-cli/internal/notification"
 	"go.uber.org/multierr"
 )
 
@@ -41,14 +43,78 @@ type Config struct {
 
 	AcmePrefix string `mapstructure:"acme-prefix"`
 
+	OcspResponder string `mapstructure:"ocsp-responder"`
+	OcspUseAia    bool   `mapstructure:"ocsp-use-aia"`
+
+	Webhooks              []notification.WebhookConfig `mapstructure:"webhooks" validate:"dive"`
+	Emails                []notification.EmailConfig   `mapstructure:"emails" validate:"dive"`
+	NotifyExpiryThreshold time.Duration                `mapstructure:"notify-expiry-threshold" validate:"gte=0"`
+
+	AuditJournal    string `mapstructure:"audit-journal"`
+	AuditMaxSize    int64  `mapstructure:"audit-max-size" validate:"gte=0"`
+	AuditMaxBackups int    `mapstructure:"audit-max-backups" validate:"gte=0"`
+
 	MetricsFile string `mapstructure:"metrics-file"`
 	MetricsAddr string `mapstructure:"metrics-addr"`
 
-	ForceNewCertificate bool                `mapstructure:"force-new-certificate"`
-	StorageConfig       []map[string]string `mapstructure:"storage"`
+	MetricsTlsCertFile string        `mapstructure:"metrics-tls-cert-file" validate:"required_with=MetricsTlsKeyFile"`
+	MetricsTlsKeyFile  string        `mapstructure:"metrics-tls-key-file" validate:"required_with=MetricsTlsCertFile"`
+	HealthStallTimeout time.Duration `mapstructure:"health-stall-timeout" validate:"gte=0"`
+
+	WatchConfig bool `mapstructure:"watch-config"`
+
+	KubeConfig            string   `mapstructure:"kubeconfig"`
+	KubeContext           string   `mapstructure:"kube-context"`
+	KubeImpersonateUser   string   `mapstructure:"kube-as"`
+	KubeImpersonateGroups []string `mapstructure:"kube-as-group" validate:"omitempty,dive,required"`
+
+	LeaderElection              bool          `mapstructure:"leader-election"`
+	LeaderElectionNamespace     string        `mapstructure:"leader-election-namespace"`
+	LeaderElectionLeaseName     string        `mapstructure:"leader-election-lease-name"`
+	LeaderElectionLeaseDuration time.Duration `mapstructure:"leader-election-lease-duration" validate:"omitempty,gte=1s"`
+	LeaderElectionIdentity      string        `mapstructure:"leader-election-identity"`
+
+	ControllerNamespace      string        `mapstructure:"controller-namespace"`
+	ControllerKinds          []string      `mapstructure:"controller-kinds" validate:"dive,oneof=secret configmap"`
+	ControllerWorkers        int           `mapstructure:"controller-workers" validate:"gte=0"`
+	ControllerResyncInterval time.Duration `mapstructure:"controller-resync-interval" validate:"omitempty,gte=1m"`
+	ControllerAllowedRoles   []string      `mapstructure:"controller-allowed-roles"`
+
+	CaBundleNamespaceSelector string        `mapstructure:"ca-bundle-namespace-selector"`
+	CaBundleConfigMapName     string        `mapstructure:"ca-bundle-configmap-name"`
+	CaBundleKey               string        `mapstructure:"ca-bundle-key"`
+	CaBundleRefreshInterval   time.Duration `mapstructure:"ca-bundle-refresh-interval" validate:"omitempty,gte=1m"`
 
-	PostHooks                              []string `mapstructure:"post-hooks"`
-	CertificateLifetimeThresholdPercentage float32  `mapstructure:"lifetime-threshold-percent"`
+	RolloutRestart []string      `mapstructure:"rollout-restart" validate:"dive,required"`
+	RolloutWait    bool          `mapstructure:"rollout-wait"`
+	RolloutTimeout time.Duration `mapstructure:"rollout-timeout" validate:"gte=0"`
+
+	SignerName              string   `mapstructure:"signer-name"`
+	SignerAutoApprove       bool     `mapstructure:"signer-auto-approve"`
+	SignerAllowedUsages     []string `mapstructure:"signer-allowed-usages"`
+	SignerAllowedNames      []string `mapstructure:"signer-allowed-names"`
+	SignerAllowedRequesters []string `mapstructure:"signer-allowed-requesters"`
+
+	ControlAddr      string `mapstructure:"control-addr"`
+	ControlTokenFile string `mapstructure:"control-token-file" validate:"required_with=ControlAddr"`
+
+	ForceNewCertificate    bool                `mapstructure:"force-new-certificate"`
+	CheckRevocation        bool                `mapstructure:"check-revocation"`
+	CheckRevocationDelta   bool                `mapstructure:"check-revocation-delta"`
+	CheckRevocationUnified bool                `mapstructure:"check-revocation-unified"`
+	StorageConfig          []map[string]string `mapstructure:"storage"`
+	StorageParallelWrites  bool                `mapstructure:"storage-parallel-writes"`
+
+	RevocationGracePeriod time.Duration `mapstructure:"revocation-grace-period" validate:"gte=0"`
+	RevocationQueueFile   string        `mapstructure:"revocation-queue-file"`
+
+	PreIssueHooksDelayExitCode int           `mapstructure:"pre-issue-hooks-delay-exit-code" validate:"gte=0,lte=255"`
+	PreIssueHooksRetryDelay    time.Duration `mapstructure:"pre-issue-hooks-retry-delay" validate:"gte=0"`
+
+	PostHooks                              []string     `mapstructure:"post-hooks"`
+	Hooks                                  []hooks.Hook `mapstructure:"post-issue-hooks" validate:"dive"`
+	PreIssueHooks                          []hooks.Hook `mapstructure:"pre-issue-hooks" validate:"dive"`
+	CertificateLifetimeThresholdPercentage float32      `mapstructure:"lifetime-threshold-percent"`
 
 	DerEncoded bool
 }
@@ -99,9 +165,98 @@ func (c *Config) ValidateIssue() error {
 		err = multierr.Append(err, fmt.Errorf("'%s' must be [5, 90]", FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE))
 	}
 
+	// consecutive failures are only counted in memory, so a single run never sees more than one
+	if !c.Daemonize {
+		for index, webhook := range c.Webhooks {
+			if webhook.MinFailures > 1 {
+				err = multierr.Append(err, fmt.Errorf("min-failures of webhook %d requires '%s'", index, FLAG_ISSUE_DAEMONIZE))
+			}
+		}
+	}
+
+	// superseded certificates are queued until the grace period has passed, which requires a persistent queue unless
+	// the process keeps running
+	if c.RevocationGracePeriod > 0 && len(c.RevocationQueueFile) == 0 && !c.Daemonize {
+		err = multierr.Append(err, fmt.Errorf("'%s' requires '%s' if not running with '%s'", FLAG_ISSUE_REVOCATION_GRACE_PERIOD, FLAG_ISSUE_REVOCATION_QUEUE_FILE, FLAG_ISSUE_DAEMONIZE))
+	}
+
+	return err
+}
+
+// ValidateController validates the config of the controller mode, which reads the certificate requests from
+// annotations instead of the config.
+func (c *Config) ValidateController() error {
+	err := c.Validate()
+
+	if c.CertificateLifetimeThresholdPercentage < 5 || c.CertificateLifetimeThresholdPercentage > 90 {
+		err = multierr.Append(err, fmt.Errorf("'%s' must be [5, 90]", FLAG_ISSUE_LIFETIME_THRESHOLD_PERCENTAGE))
+	}
+
+	if len(c.ControllerKinds) == 0 {
+		err = multierr.Append(err, fmt.Errorf("empty '%s' provided", FLAG_CONTROLLER_KINDS))
+	}
+
 	return err
 }
 
+// ValidateSigner validates the config of the CSR signer mode.
+func (c *Config) ValidateSigner() error {
+	err := c.Validate()
+
+	if len(c.SignerName) == 0 {
+		err = multierr.Append(err, fmt.Errorf("empty '%s' provided", FLAG_SIGNER_NAME))
+	}
+
+	if c.SignerAutoApprove && len(c.SignerAllowedNames) == 0 && len(c.SignerAllowedRequesters) == 0 {
+		err = multierr.Append(err, fmt.Errorf("'%s' requires '%s' or '%s' to be set", FLAG_SIGNER_AUTO_APPROVE, FLAG_SIGNER_ALLOWED_NAMES, FLAG_SIGNER_ALLOWED_REQUESTERS))
+	}
+
+	return err
+}
+
+// ValidateCaBundle validates the config of the ca bundle distribution mode. Reading the ca chain requires no
+// authentication, therefore the vault auth config is not validated.
+func (c *Config) ValidateCaBundle() error {
+	var err error
+
+	if len(c.VaultAddress) == 0 {
+		err = multierr.Append(err, fmt.Errorf("empty '%s' provided", FLAG_VAULT_ADDRESS))
+	}
+
+	if len(c.CaBundleConfigMapName) == 0 {
+		err = multierr.Append(err, fmt.Errorf("empty '%s' provided", FLAG_CA_BUNDLE_CONFIGMAP_NAME))
+	}
+
+	if len(c.CaBundleKey) == 0 {
+		err = multierr.Append(err, fmt.Errorf("empty '%s' provided", FLAG_CA_BUNDLE_KEY))
+	}
+
+	if c.CaBundleRefreshInterval > 0 && c.CaBundleRefreshInterval < time.Minute {
+		err = multierr.Append(err, fmt.Errorf("'%s' must be at least 1m", FLAG_CA_BUNDLE_REFRESH_INTERVAL))
+	}
+
+	return err
+}
+
+// PostIssueHooks returns the structured hooks followed by the hooks that are defined as plain command lines. Plain
+// command lines always continue on failure to keep the previous behaviour.
+func (c *Config) PostIssueHooks() ([]hooks.Hook, error) {
+	ret := make([]hooks.Hook, 0, len(c.Hooks)+len(c.PostHooks))
+	ret = append(ret, c.Hooks...)
+
+	var errs error
+	for _, cmd := range c.PostHooks {
+		hook, err := hooks.FromCommandLine(cmd)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		ret = append(ret, hook)
+	}
+
+	return ret, errs
+}
+
 func validateTtl(fl validator.FieldLevel) bool {
 	// Get the field value and check if it's a slice
 	field := fl.Field()
@@ -0,0 +1,113 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Client talks to the control API of a running daemon.
+type Client struct {
+	baseUrl    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(addr, token string) (*Client, error) {
+	network, addr, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(token) == 0 {
+		return nil, errors.New("empty token provided")
+	}
+
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	baseUrl := "http://" + addr
+	if network == "unix" {
+		baseUrl = "http://localhost"
+	}
+
+	return &Client{
+		baseUrl: baseUrl,
+		token:   token,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   runTimeout + 10*time.Second,
+		},
+	}, nil
+}
+
+func (c *Client) Renew(ctx context.Context, commonName string) (Result, error) {
+	var ret Result
+	err := c.do(ctx, http.MethodPost, PathRenew+"?cn="+url.QueryEscape(commonName), &ret)
+	return ret, err
+}
+
+func (c *Client) RefreshCrl(ctx context.Context) (Result, error) {
+	var ret Result
+	err := c.do(ctx, http.MethodPost, PathRefreshCrl, &ret)
+	return ret, err
+}
+
+func (c *Client) Pause(ctx context.Context) (Queue, error) {
+	var ret Queue
+	err := c.do(ctx, http.MethodPost, PathPause, &ret)
+	return ret, err
+}
+
+func (c *Client) Resume(ctx context.Context) (Queue, error) {
+	var ret Queue
+	err := c.do(ctx, http.MethodPost, PathResume, &ret)
+	return ret, err
+}
+
+func (c *Client) Queue(ctx context.Context) (Queue, error) {
+	var ret Queue
+	err := c.do(ctx, http.MethodGet, PathQueue, &ret)
+	return ret, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s", ErrUnknownCert, body.Error)
+		case http.StatusNotImplemented:
+			return ErrNotSupported
+		case http.StatusServiceUnavailable:
+			return ErrNotLeader
+		default:
+			return fmt.Errorf("daemon returned status %d: %s", resp.StatusCode, body.Error)
+		}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
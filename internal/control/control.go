@@ -0,0 +1,142 @@
+package control
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	PathRenew      = "/v1/renew"
+	PathRefreshCrl = "/v1/crl/refresh"
+	PathPause      = "/v1/pause"
+	PathResume     = "/v1/resume"
+	PathQueue      = "/v1/queue"
+
+	unixPrefix = "unix:"
+	tokenBytes = 32
+)
+
+var (
+	ErrUnknownCert  = errors.New("certificate is not managed by this daemon")
+	ErrNotSupported = errors.New("operation not supported by this daemon")
+	ErrNotLeader    = errors.New("this replica is not the leader")
+)
+
+// Controller is implemented by the daemon that is controlled via the API.
+type Controller interface {
+	// Renew forces the renewal of the certificate with the given common name and returns the outcome.
+	Renew(ctx context.Context, commonName string) (Result, error)
+	// RefreshCrl checks the certificates against a freshly fetched CRL.
+	RefreshCrl(ctx context.Context) (Result, error)
+	Pause() error
+	Resume() error
+	Queue() (Queue, error)
+}
+
+// Result is the outcome of a run that has been triggered via the API.
+type Result struct {
+	CommonName string     `json:"common_name,omitempty"`
+	Status     string     `json:"status"`
+	Serial     string     `json:"serial,omitempty"`
+	NotAfter   *time.Time `json:"not_after,omitempty"`
+	RetryAfter string     `json:"retry_after,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Queue describes the scheduled work of the daemon.
+type Queue struct {
+	Paused      bool         `json:"paused"`
+	Jobs        []Job        `json:"jobs"`
+	Revocations []Revocation `json:"revocations"`
+}
+
+type Job struct {
+	CommonName string     `json:"common_name"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+}
+
+type Revocation struct {
+	Serial      string    `json:"serial"`
+	CommonName  string    `json:"common_name"`
+	RevokeAfter time.Time `json:"revoke_after"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// parseAddr splits the address into the network and the address to listen on. Addresses prefixed with 'unix:' denote
+// a unix socket, all other addresses must be bound to the loopback interface.
+func parseAddr(addr string) (string, string, error) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		path := strings.TrimPrefix(strings.TrimPrefix(addr, unixPrefix), "//")
+		if len(path) == 0 {
+			return "", "", errors.New("empty unix socket path")
+		}
+		return "unix", path, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid address '%s': %w", addr, err)
+	}
+
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("refusing to serve control api on non-loopback address '%s'", addr)
+		}
+	}
+
+	return "tcp", addr, nil
+}
+
+// ReadToken reads the token that authenticates requests against the control API.
+func ReadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read control token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if len(token) == 0 {
+		return "", fmt.Errorf("empty control token in '%s'", path)
+	}
+
+	return token, nil
+}
+
+// ReadOrCreateToken reads the token or, if the file does not exist, creates a random token that is only readable by
+// the current user.
+func ReadOrCreateToken(path string) (string, error) {
+	token, err := ReadToken(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return token, err
+	}
+
+	data := make([]byte, tokenBytes)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("could not generate control token: %w", err)
+	}
+	token = hex.EncodeToString(data)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("could not create directory for control token: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("could not write control token: %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,161 @@
+package control
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type controllerMock struct {
+	paused  bool
+	renewed []string
+}
+
+func (m *controllerMock) Renew(_ context.Context, commonName string) (Result, error) {
+	if commonName != "example.com" {
+		return Result{}, ErrUnknownCert
+	}
+	m.renewed = append(m.renewed, commonName)
+	return Result{CommonName: commonName, Status: "issued"}, nil
+}
+
+func (m *controllerMock) RefreshCrl(_ context.Context) (Result, error) {
+	return Result{}, ErrNotSupported
+}
+
+func (m *controllerMock) Pause() error {
+	m.paused = true
+	return nil
+}
+
+func (m *controllerMock) Resume() error {
+	m.paused = false
+	return nil
+}
+
+func (m *controllerMock) Queue() (Queue, error) {
+	return Queue{Paused: m.paused}, nil
+}
+
+func Test_parseAddr(t *testing.T) {
+	tests := []struct {
+		addr        string
+		wantNetwork string
+		wantAddr    string
+		wantErr     bool
+	}{
+		{addr: "unix:/run/vault-pki-cli.sock", wantNetwork: "unix", wantAddr: "/run/vault-pki-cli.sock"},
+		{addr: "unix:///run/vault-pki-cli.sock", wantNetwork: "unix", wantAddr: "/run/vault-pki-cli.sock"},
+		{addr: "127.0.0.1:9173", wantNetwork: "tcp", wantAddr: "127.0.0.1:9173"},
+		{addr: "[::1]:9173", wantNetwork: "tcp", wantAddr: "[::1]:9173"},
+		{addr: "localhost:9173", wantNetwork: "tcp", wantAddr: "localhost:9173"},
+		{addr: "0.0.0.0:9173", wantErr: true},
+		{addr: ":9173", wantErr: true},
+		{addr: "unix:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			network, addr, err := parseAddr(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAddr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if network != tt.wantNetwork || addr != tt.wantAddr {
+				t.Errorf("parseAddr() = %s %s, want %s %s", network, addr, tt.wantNetwork, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestReadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control", "token")
+	token, err := ReadOrCreateToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 2*tokenBytes {
+		t.Errorf("unexpected token length %d", len(token))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected token file to be only readable by the owner, got %v", info.Mode().Perm())
+	}
+
+	again, err := ReadOrCreateToken(path)
+	if err != nil || again != token {
+		t.Errorf("expected existing token to be read, got %s, %v", again, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	// unix socket paths are limited in length, the test's temp dir might exceed it
+	dir, err := os.MkdirTemp("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	addr := "unix:" + filepath.Join(dir, "control.sock")
+
+	controller := &controllerMock{}
+	server, err := NewServer(addr, "secret", controller)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = server.Serve(ctx)
+	}()
+
+	client, err := NewClient(addr, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the server to listen
+	for i := 0; i < 50; i++ {
+		if _, err = client.Queue(ctx); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unauthenticated, _ := NewClient(addr, "wrong")
+	if _, err := unauthenticated.Pause(ctx); err == nil || controller.paused {
+		t.Errorf("expected unauthenticated request to be rejected")
+	}
+
+	result, err := client.Renew(ctx, "example.com")
+	if err != nil || result.Status != "issued" || len(controller.renewed) != 1 {
+		t.Errorf("unexpected renew result %+v, %v", result, err)
+	}
+
+	if _, err := client.Renew(ctx, "other.example.com"); !errors.Is(err, ErrUnknownCert) {
+		t.Errorf("expected ErrUnknownCert, got %v", err)
+	}
+
+	if _, err := client.RefreshCrl(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+
+	queue, err := client.Pause(ctx)
+	if err != nil || !queue.Paused {
+		t.Errorf("expected renewals to be paused, got %+v, %v", queue, err)
+	}
+
+	queue, err = client.Resume(ctx)
+	if err != nil || queue.Paused {
+		t.Errorf("expected renewals to be resumed, got %+v, %v", queue, err)
+	}
+}
@@ -0,0 +1,188 @@
+package control
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/context"
+)
+
+// runTimeout limits how long a synchronous run, including retries and hooks, may take.
+const runTimeout = 10 * time.Minute
+
+// Server serves the control API. Every request must be authenticated using the bearer token.
+type Server struct {
+	network    string
+	addr       string
+	token      string
+	controller Controller
+}
+
+func NewServer(addr, token string, controller Controller) (*Server, error) {
+	network, addr, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(token) == 0 {
+		return nil, errors.New("empty token provided")
+	}
+
+	if controller == nil {
+		return nil, errors.New("nil controller provided")
+	}
+
+	return &Server{
+		network:    network,
+		addr:       addr,
+		token:      token,
+		controller: controller,
+	}, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+PathRenew, s.renew)
+	mux.HandleFunc("POST "+PathRefreshCrl, s.refreshCrl)
+	mux.HandleFunc("POST "+PathPause, s.pause)
+	mux.HandleFunc("POST "+PathResume, s.resume)
+	mux.HandleFunc("GET "+PathQueue, s.queue)
+	return s.authenticate(mux)
+}
+
+// Serve listens until the context is canceled.
+func (s *Server) Serve(ctx context.Context) error {
+	if s.network == "unix" {
+		// remove a stale socket of a previous run
+		if err := os.Remove(s.addr); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on '%s': %w", s.addr, err)
+	}
+
+	if s.network == "unix" {
+		if err := os.Chmod(s.addr, 0600); err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("could not restrict permissions of socket: %w", err)
+		}
+	}
+
+	server := http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 3 * time.Second,
+		ReadTimeout:       3 * time.Second,
+		WriteTimeout:      runTimeout + 5*time.Second,
+		IdleTimeout:       90 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			log.Warn().Str("path", r.URL.Path).Msg("Rejected unauthenticated control request")
+			writeJson(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) renew(w http.ResponseWriter, r *http.Request) {
+	commonName := r.URL.Query().Get("cn")
+	if len(commonName) == 0 {
+		writeJson(w, http.StatusBadRequest, errorResponse{Error: "missing parameter 'cn'"})
+		return
+	}
+
+	log.Info().Str("cn", commonName).Msg("Forced renewal requested via control api")
+	// a run that has been started must not be aborted if the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	s.writeResult(w, func() (any, error) {
+		return s.controller.Renew(ctx, commonName)
+	})
+}
+
+func (s *Server) refreshCrl(w http.ResponseWriter, _ *http.Request) {
+	log.Info().Msg("CRL refresh requested via control api")
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	s.writeResult(w, func() (any, error) {
+		return s.controller.RefreshCrl(ctx)
+	})
+}
+
+func (s *Server) pause(w http.ResponseWriter, _ *http.Request) {
+	log.Info().Msg("Pausing renewals via control api")
+	s.writeResult(w, func() (any, error) {
+		if err := s.controller.Pause(); err != nil {
+			return nil, err
+		}
+		return s.controller.Queue()
+	})
+}
+
+func (s *Server) resume(w http.ResponseWriter, _ *http.Request) {
+	log.Info().Msg("Resuming renewals via control api")
+	s.writeResult(w, func() (any, error) {
+		if err := s.controller.Resume(); err != nil {
+			return nil, err
+		}
+		return s.controller.Queue()
+	})
+}
+
+func (s *Server) queue(w http.ResponseWriter, _ *http.Request) {
+	s.writeResult(w, func() (any, error) {
+		return s.controller.Queue()
+	})
+}
+
+func (s *Server) writeResult(w http.ResponseWriter, fn func() (any, error)) {
+	result, err := fn()
+	switch {
+	case err == nil:
+		writeJson(w, http.StatusOK, result)
+	case errors.Is(err, ErrUnknownCert):
+		writeJson(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, ErrNotSupported):
+		writeJson(w, http.StatusNotImplemented, errorResponse{Error: err.Error()})
+	case errors.Is(err, ErrNotLeader):
+		writeJson(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+	default:
+		writeJson(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+	}
+}
+
+func writeJson(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warn().Err(err).Msg("could not write control api response")
+	}
+}
@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	KindSecret    = "secret"
+	KindConfigMap = "configmap"
+
+	DefaultResyncInterval = time.Hour
+	DefaultWorkers        = 2
+
+	eventComponent = "vault-pki-cli"
+)
+
+// ServiceFactory returns the PkiService that issues certificates for the given Vault PKI role. An empty role denotes
+// the default role.
+type ServiceFactory func(role string) (*pki.PkiService, error)
+
+// Controller watches Secrets and ConfigMaps that are annotated with a common name and issues and renews the
+// certificates stored in them.
+type Controller struct {
+	client         kubernetes.Interface
+	services       ServiceFactory
+	namespace      string
+	kinds          []string
+	workers        int
+	resyncInterval time.Duration
+	allowedRoles   map[string]struct{}
+	isLeader       func() bool
+
+	recorder    record.EventRecorder
+	broadcaster record.EventBroadcaster
+	factory     informers.SharedInformerFactory
+	informers   map[string]cache.SharedIndexInformer
+	queue       workqueue.RateLimitingInterface
+
+	cachedServices map[string]*pki.PkiService
+	mutex          sync.Mutex
+}
+
+type ControllerOpts func(*Controller) error
+
+// WithNamespace restricts the controller to a single namespace. By default, all namespaces are watched.
+func WithNamespace(namespace string) ControllerOpts {
+	return func(c *Controller) error {
+		c.namespace = namespace
+		return nil
+	}
+}
+
+// WithKinds sets the kinds of objects to watch, either KindSecret, KindConfigMap or both.
+func WithKinds(kinds ...string) ControllerOpts {
+	return func(c *Controller) error {
+		if len(kinds) == 0 {
+			return errors.New("no kinds provided")
+		}
+		for _, kind := range kinds {
+			if kind != KindSecret && kind != KindConfigMap {
+				return fmt.Errorf("unknown kind '%s'", kind)
+			}
+		}
+		c.kinds = kinds
+		return nil
+	}
+}
+
+func WithWorkers(workers int) ControllerOpts {
+	return func(c *Controller) error {
+		if workers < 1 {
+			return fmt.Errorf("invalid number of workers %d", workers)
+		}
+		c.workers = workers
+		return nil
+	}
+}
+
+// WithResyncInterval sets the interval after which each certificate is checked for renewal again.
+func WithResyncInterval(interval time.Duration) ControllerOpts {
+	return func(c *Controller) error {
+		if interval < time.Minute {
+			return fmt.Errorf("resync interval must be at least 1m, got %v", interval)
+		}
+		c.resyncInterval = interval
+		return nil
+	}
+}
+
+// WithAllowedRoles restricts the roles that can be requested using the role annotation. By default, all roles are
+// allowed.
+func WithAllowedRoles(roles ...string) ControllerOpts {
+	return func(c *Controller) error {
+		c.allowedRoles = map[string]struct{}{}
+		for _, role := range roles {
+			c.allowedRoles[role] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithLeaderCheck only reconciles objects while the check returns true. Call Resync after becoming the leader.
+func WithLeaderCheck(isLeader func() bool) ControllerOpts {
+	return func(c *Controller) error {
+		if isLeader == nil {
+			return errors.New("nil leader check provided")
+		}
+		c.isLeader = isLeader
+		return nil
+	}
+}
+
+// WithRecorder replaces the recorder that emits Kubernetes Events.
+func WithRecorder(recorder record.EventRecorder) ControllerOpts {
+	return func(c *Controller) error {
+		if recorder == nil {
+			return errors.New("nil recorder provided")
+		}
+		c.recorder = recorder
+		return nil
+	}
+}
+
+func NewController(client kubernetes.Interface, services ServiceFactory, opts ...ControllerOpts) (*Controller, error) {
+	if client == nil {
+		return nil, errors.New("nil kubernetes client provided")
+	}
+
+	if services == nil {
+		return nil, errors.New("nil service factory provided")
+	}
+
+	ret := &Controller{
+		client:         client,
+		services:       services,
+		kinds:          []string{KindSecret},
+		workers:        DefaultWorkers,
+		resyncInterval: DefaultResyncInterval,
+		informers:      map[string]cache.SharedIndexInformer{},
+		queue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		cachedServices: map[string]*pki.PkiService{},
+	}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if ret.recorder == nil {
+		ret.broadcaster = record.NewBroadcaster()
+		ret.recorder = ret.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+	}
+
+	ret.factory = informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(ret.namespace))
+	for _, kind := range ret.kinds {
+		var informer cache.SharedIndexInformer
+		switch kind {
+		case KindSecret:
+			informer = ret.factory.Core().V1().Secrets().Informer()
+		case KindConfigMap:
+			informer = ret.factory.Core().V1().ConfigMaps().Informer()
+		}
+
+		if _, err := informer.AddEventHandler(ret.eventHandler(kind)); err != nil {
+			return nil, fmt.Errorf("could not add event handler for %ss: %w", kind, err)
+		}
+		ret.informers[kind] = informer
+	}
+
+	return ret, nil
+}
+
+func (c *Controller) eventHandler(kind string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			c.enqueue(kind, obj)
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			// changes to the status annotations must not trigger another reconciliation
+			if !reflect.DeepEqual(requestAnnotations(oldObj), requestAnnotations(newObj)) ||
+				!reflect.DeepEqual(keyPairData(oldObj), keyPairData(newObj)) {
+				c.enqueue(kind, newObj)
+			}
+		},
+		// deleted objects need no action, the certificate simply expires
+	}
+}
+
+func (c *Controller) enqueue(kind string, obj any) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not access object metadata")
+		return
+	}
+
+	if len(accessor.GetAnnotations()[AnnotationCommonName]) == 0 {
+		return
+	}
+
+	c.queue.Add(buildKey(kind, accessor.GetNamespace(), accessor.GetName()))
+}
+
+// Resync enqueues all annotated objects, e.g. after becoming the leader.
+func (c *Controller) Resync() {
+	for kind, informer := range c.informers {
+		for _, obj := range informer.GetStore().List() {
+			c.enqueue(kind, obj)
+		}
+	}
+}
+
+// Run starts watching objects and reconciles them until the context is canceled.
+func (c *Controller) Run(ctx context.Context) error {
+	if c.broadcaster != nil {
+		c.broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.client.CoreV1().Events("")})
+		defer c.broadcaster.Shutdown()
+	}
+
+	c.factory.Start(ctx.Done())
+	defer c.factory.Shutdown()
+
+	synced := make([]cache.InformerSynced, 0, len(c.informers))
+	for _, informer := range c.informers {
+		synced = append(synced, informer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		c.queue.ShutDown()
+		return errors.New("could not sync caches")
+	}
+
+	log.Info().Msgf("Watching %s for annotation '%s'", strings.Join(c.kinds, ", "), AnnotationCommonName)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNextItem(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	c.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key := item.(string)
+	requeueAfter, err := c.Reconcile(ctx, key)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Reconciling failed, retrying")
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	if requeueAfter > 0 {
+		c.queue.AddAfter(key, requeueAfter)
+	}
+	return true
+}
+
+func (c *Controller) service(role string) (*pki.PkiService, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if service, ok := c.cachedServices[role]; ok {
+		return service, nil
+	}
+
+	service, err := c.services(role)
+	if err != nil {
+		return nil, fmt.Errorf("could not build pki service for role '%s': %w", role, err)
+	}
+	c.cachedServices[role] = service
+	return service, nil
+}
+
+func (c *Controller) isRoleAllowed(role string) bool {
+	if len(role) == 0 || c.allowedRoles == nil {
+		return true
+	}
+
+	_, ok := c.allowedRoles[role]
+	return ok
+}
+
+func buildKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func splitKey(key string) (kind, namespace, name string, err error) {
+	split := strings.Split(key, "/")
+	if len(split) != 3 {
+		return "", "", "", fmt.Errorf("invalid key '%s'", key)
+	}
+
+	return split[0], split[1], split[2], nil
+}
@@ -0,0 +1,325 @@
+package controller
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/status"
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/soerenschneider/vault-pki-cli/pkg/renew_strategy"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func annotatedSecret(annotations map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "app-tls",
+			Labels:      map[string]string{"app": "app"},
+			Annotations: annotations,
+		},
+		Data: map[string][]byte{
+			"unrelated": []byte("keep me"),
+		},
+	}
+}
+
+func buildController(t *testing.T, ctx context.Context, client *fake.Clientset, pkiClient *testutil.PkiClientMock, opts ...ControllerOpts) (*Controller, *record.FakeRecorder) {
+	t.Helper()
+
+	recorder := record.NewFakeRecorder(10)
+	services := func(role string) (*pki.PkiService, error) {
+		return pki.NewPkiService(pkiClient, &renew_strategy.StaticRenewal{Decision: false})
+	}
+
+	opts = append(opts, WithRecorder(recorder))
+	c, err := NewController(client, services, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.factory.Start(ctx.Done())
+	c.factory.WaitForCacheSync(ctx.Done())
+	return c, recorder
+}
+
+func nextEvent(recorder *record.FakeRecorder) string {
+	select {
+	case event := <-recorder.Events:
+		return event
+	default:
+		return ""
+	}
+}
+
+func TestController_Reconcile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := testutil.NewCa(t)
+	certData := testutil.NewCertWithSerial(t, 4711, time.Time{}, time.Time{}, ca).CertData(t, ca)
+	pkiClient := &testutil.PkiClientMock{CaChain: ca.CertPem(), Issued: certData}
+	client := fake.NewSimpleClientset(annotatedSecret(map[string]string{
+		AnnotationCommonName: "app.example.com",
+		AnnotationAltNames:   "a.example.com, b.example.com",
+		AnnotationTtl:        "24h",
+	}))
+	c, recorder := buildController(t, ctx, client, pkiClient)
+
+	requeue, err := c.Reconcile(ctx, buildKey(KindSecret, "default", "app-tls"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requeue != DefaultResyncInterval {
+		t.Errorf("expected requeue after %v, got %v", DefaultResyncInterval, requeue)
+	}
+
+	if len(pkiClient.IssueArgs()) != 1 {
+		t.Fatalf("expected 1 issue request, got %d", len(pkiClient.IssueArgs()))
+	}
+	args := pkiClient.IssueArgs()[0]
+	if args.CommonName != "app.example.com" || args.Ttl != "24h" || len(args.AltNames) != 2 || args.AltNames[1] != "b.example.com" {
+		t.Errorf("unexpected issue args %+v", args)
+	}
+
+	secret, err := client.CoreV1().Secrets("default").Get(ctx, "app-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{KeyCert, KeyPrivateKey, KeyCa} {
+		if len(secret.Data[key]) == 0 {
+			t.Errorf("expected key '%s' to be written", key)
+		}
+	}
+	if string(secret.Data["unrelated"]) != "keep me" || secret.Labels["app"] != "app" {
+		t.Errorf("expected unrelated data and labels to be preserved")
+	}
+	if secret.Annotations[AnnotationStatus] != status.StatusIssued {
+		t.Errorf("expected status '%s', got '%s'", status.StatusIssued, secret.Annotations[AnnotationStatus])
+	}
+	if secret.Annotations[AnnotationSerial] != pkg.FormatSerial(big.NewInt(4711)) {
+		t.Errorf("unexpected serial annotation '%s'", secret.Annotations[AnnotationSerial])
+	}
+	if len(secret.Annotations[AnnotationNotAfter]) == 0 || len(secret.Annotations[AnnotationLastIssued]) == 0 {
+		t.Errorf("expected not-after and last-issued annotations")
+	}
+	if event := nextEvent(recorder); !strings.HasPrefix(event, corev1.EventTypeNormal+" "+EventReasonIssued) {
+		t.Errorf("expected issued event, got '%s'", event)
+	}
+
+	// the existing certificate is still valid, nothing to do
+	if _, err := c.Reconcile(ctx, buildKey(KindSecret, "default", "app-tls")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pkiClient.IssueArgs()) != 1 {
+		t.Errorf("expected no further issue request, got %d", len(pkiClient.IssueArgs()))
+	}
+	secret, _ = client.CoreV1().Secrets("default").Get(ctx, "app-tls", metav1.GetOptions{})
+	if secret.Annotations[AnnotationStatus] != status.StatusNoop {
+		t.Errorf("expected status '%s', got '%s'", status.StatusNoop, secret.Annotations[AnnotationStatus])
+	}
+	if event := nextEvent(recorder); len(event) > 0 {
+		t.Errorf("expected no event, got '%s'", event)
+	}
+}
+
+func TestController_ReconcileFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := &testutil.PkiClientMock{IssueErr: errors.New("permission denied")}
+	client := fake.NewSimpleClientset(annotatedSecret(map[string]string{
+		AnnotationCommonName: "app.example.com",
+	}))
+	c, recorder := buildController(t, ctx, client, pkiClient)
+
+	if _, err := c.Reconcile(ctx, buildKey(KindSecret, "default", "app-tls")); err == nil {
+		t.Fatal("expected error")
+	}
+
+	secret, _ := client.CoreV1().Secrets("default").Get(ctx, "app-tls", metav1.GetOptions{})
+	if secret.Annotations[AnnotationStatus] != status.StatusFailed {
+		t.Errorf("expected status '%s', got '%s'", status.StatusFailed, secret.Annotations[AnnotationStatus])
+	}
+	if !strings.Contains(secret.Annotations[AnnotationLastError], "permission denied") {
+		t.Errorf("unexpected last error '%s'", secret.Annotations[AnnotationLastError])
+	}
+	if event := nextEvent(recorder); !strings.HasPrefix(event, corev1.EventTypeWarning+" "+EventReasonIssueFailed) {
+		t.Errorf("expected failure event, got '%s'", event)
+	}
+}
+
+func TestController_ReconcileRoleNotAllowed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := &testutil.PkiClientMock{}
+	client := fake.NewSimpleClientset(annotatedSecret(map[string]string{
+		AnnotationCommonName: "app.example.com",
+		AnnotationRole:       "admin",
+	}))
+	c, recorder := buildController(t, ctx, client, pkiClient, WithAllowedRoles("apps"))
+
+	requeue, err := c.Reconcile(ctx, buildKey(KindSecret, "default", "app-tls"))
+	if err != nil || requeue != 0 {
+		t.Fatalf("expected no retry, got %v, %v", requeue, err)
+	}
+	if len(pkiClient.IssueArgs()) != 0 {
+		t.Errorf("expected no issue request")
+	}
+	if event := nextEvent(recorder); !strings.Contains(event, "role 'admin' is not allowed") {
+		t.Errorf("expected failure event, got '%s'", event)
+	}
+}
+
+func TestController_ReconcileConfigMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := testutil.NewCa(t)
+	certData := testutil.NewCertWithSerial(t, 4711, time.Time{}, time.Time{}, ca).CertData(t, ca)
+	pkiClient := &testutil.PkiClientMock{CaChain: ca.CertPem(), Issued: certData}
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "app-tls",
+			UID:       "4711",
+			Annotations: map[string]string{
+				AnnotationCommonName:       "app.example.com",
+				AnnotationPrivateKeySecret: "app-tls-key",
+			},
+		},
+	})
+	c, _ := buildController(t, ctx, client, pkiClient, WithKinds(KindConfigMap))
+
+	if _, err := c.Reconcile(ctx, buildKey(KindConfigMap, "default", "app-tls")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configMap, _ := client.CoreV1().ConfigMaps("default").Get(ctx, "app-tls", metav1.GetOptions{})
+	if len(configMap.Data[KeyCert]) == 0 || configMap.Annotations[AnnotationStatus] != status.StatusIssued {
+		t.Errorf("expected certificate and status to be written, got %v", configMap.Annotations)
+	}
+	if _, ok := configMap.Data[KeyPrivateKey]; ok {
+		t.Errorf("expected private key not to be written to the configmap")
+	}
+
+	secret, err := client.CoreV1().Secrets("default").Get(ctx, "app-tls-key", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected secret to be created: %v", err)
+	}
+	if string(secret.Data[KeyPrivateKey]) != string(certData.PrivateKey) {
+		t.Errorf("expected private key to be written to the secret")
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].UID != configMap.UID {
+		t.Errorf("expected secret to be owned by the configmap, got %v", secret.OwnerReferences)
+	}
+}
+
+func TestController_ReconcileConfigMapForeignSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := testutil.NewCa(t)
+	pkiClient := &testutil.PkiClientMock{CaChain: ca.CertPem(), Issued: testutil.NewCertWithSerial(t, 4711, time.Time{}, time.Time{}, ca).CertData(t, ca)}
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "app-tls",
+				UID:       "4711",
+				Annotations: map[string]string{
+					AnnotationCommonName:       "app.example.com",
+					AnnotationPrivateKeySecret: "db-credentials",
+				},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-credentials"},
+			Data:       map[string][]byte{KeyPrivateKey: []byte("foreign")},
+		},
+	)
+	c, recorder := buildController(t, ctx, client, pkiClient, WithKinds(KindConfigMap))
+
+	requeue, err := c.Reconcile(ctx, buildKey(KindConfigMap, "default", "app-tls"))
+	if err != nil || requeue != 0 {
+		t.Fatalf("expected no retry, got %v, %v", requeue, err)
+	}
+	if len(pkiClient.IssueArgs()) != 0 {
+		t.Errorf("expected no issue request")
+	}
+	if event := nextEvent(recorder); !strings.Contains(event, "not owned by the configmap") {
+		t.Errorf("expected failure event, got '%s'", event)
+	}
+
+	secret, _ := client.CoreV1().Secrets("default").Get(ctx, "db-credentials", metav1.GetOptions{})
+	if string(secret.Data[KeyPrivateKey]) != "foreign" {
+		t.Errorf("expected foreign secret not to be modified")
+	}
+	configMap, _ := client.CoreV1().ConfigMaps("default").Get(ctx, "app-tls", metav1.GetOptions{})
+	if len(configMap.Data[KeyCert]) > 0 || len(configMap.Annotations[AnnotationLastError]) == 0 {
+		t.Errorf("expected no certificate and an error in the status, got %v", configMap.Annotations)
+	}
+
+	// writing is refused as well, e.g. if the secret has been created after the check
+	storage := c.privateKeyStorage(configMap)
+	if err := storage.Write([]byte("key")); !errors.Is(err, errForeignSecret) {
+		t.Errorf("expected write to be refused, got %v", err)
+	}
+	if err := storage.Clear(); !errors.Is(err, errForeignSecret) {
+		t.Errorf("expected clear to be refused, got %v", err)
+	}
+}
+
+func TestController_ReconcileConfigMapWithoutSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := &testutil.PkiClientMock{}
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "app-tls",
+			Annotations: map[string]string{AnnotationCommonName: "app.example.com"},
+		},
+	})
+	c, recorder := buildController(t, ctx, client, pkiClient, WithKinds(KindConfigMap))
+
+	requeue, err := c.Reconcile(ctx, buildKey(KindConfigMap, "default", "app-tls"))
+	if err != nil || requeue != 0 {
+		t.Fatalf("expected no retry, got %v, %v", requeue, err)
+	}
+	if len(pkiClient.IssueArgs()) != 0 {
+		t.Errorf("expected no issue request")
+	}
+	if event := nextEvent(recorder); !strings.Contains(event, AnnotationPrivateKeySecret) {
+		t.Errorf("expected failure event, got '%s'", event)
+	}
+
+	configMap, _ := client.CoreV1().ConfigMaps("default").Get(ctx, "app-tls", metav1.GetOptions{})
+	if len(configMap.Annotations[AnnotationLastError]) == 0 {
+		t.Errorf("expected error to be written to the status, got %v", configMap.Annotations)
+	}
+}
+
+func TestSetAnnotations(t *testing.T) {
+	obj := &metav1.ObjectMeta{Annotations: map[string]string{AnnotationLastError: "boom"}}
+	if !setAnnotations(obj, map[string]string{AnnotationLastError: "", AnnotationStatus: "noop"}) {
+		t.Error("expected annotations to change")
+	}
+	if _, ok := obj.Annotations[AnnotationLastError]; ok {
+		t.Error("expected empty annotation to be removed")
+	}
+	if setAnnotations(obj, map[string]string{AnnotationLastError: "", AnnotationStatus: "noop"}) {
+		t.Error("expected annotations to be unchanged")
+	}
+}
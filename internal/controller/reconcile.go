@@ -0,0 +1,331 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal/status"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/soerenschneider/vault-pki-cli/pkg/storage/shape"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+)
+
+// Annotations that request a certificate.
+const (
+	AnnotationPrefix = "vault-pki-cli/"
+
+	AnnotationCommonName = AnnotationPrefix + "common-name"
+	AnnotationAltNames   = AnnotationPrefix + "alt-names"
+	AnnotationIpSans     = AnnotationPrefix + "ip-sans"
+	AnnotationTtl        = AnnotationPrefix + "ttl"
+	AnnotationRole       = AnnotationPrefix + "role"
+	// AnnotationPrivateKeySecret names the Secret in the namespace of an annotated ConfigMap that receives the private
+	// key. ConfigMaps are readable with ordinary view permissions and are not encrypted at rest, so they only receive
+	// the certificate and the CA.
+	AnnotationPrivateKeySecret = AnnotationPrefix + "private-key-secret"
+)
+
+// Annotations that reflect the state of the certificate, written by the controller.
+const (
+	AnnotationSerial     = AnnotationPrefix + "serial"
+	AnnotationNotAfter   = AnnotationPrefix + "not-after"
+	AnnotationStatus     = AnnotationPrefix + "status"
+	AnnotationLastError  = AnnotationPrefix + "last-error"
+	AnnotationLastIssued = AnnotationPrefix + "last-issued"
+)
+
+// Keys the keypair is stored under, compatible with Secrets of type kubernetes.io/tls.
+const (
+	KeyCert       = corev1.TLSCertKey
+	KeyPrivateKey = corev1.TLSPrivateKeyKey
+	KeyCa         = "ca.crt"
+)
+
+const (
+	EventReasonIssued         = "Issued"
+	EventReasonIssueFailed    = "IssueFailed"
+	EventReasonRenewalVetoed  = "RenewalVetoed"
+	EventReasonRenewalDelayed = "RenewalDelayed"
+)
+
+var requestKeys = []string{AnnotationCommonName, AnnotationAltNames, AnnotationIpSans, AnnotationTtl, AnnotationRole, AnnotationPrivateKeySecret}
+
+// Reconcile issues or renews the certificate of the object identified by the key and returns the duration after
+// which the object should be reconciled again.
+func (c *Controller) Reconcile(ctx context.Context, key string) (time.Duration, error) {
+	kind, namespace, name, err := splitKey(key)
+	if err != nil {
+		log.Error().Err(err).Msg("Dropping invalid key")
+		return 0, nil
+	}
+
+	if c.isLeader != nil && !c.isLeader() {
+		log.Debug().Str("key", key).Msg("Not the leader, skipping reconciliation")
+		return 0, nil
+	}
+
+	obj, err := c.get(kind, namespace, name)
+	if err != nil || obj == nil {
+		return 0, err
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return 0, err
+	}
+	annotations := accessor.GetAnnotations()
+	if len(annotations[AnnotationCommonName]) == 0 {
+		return 0, nil
+	}
+
+	role := annotations[AnnotationRole]
+	if !c.isRoleAllowed(role) {
+		return 0, c.reject(ctx, obj, kind, namespace, name, fmt.Errorf("role '%s' is not allowed", role))
+	}
+
+	if kind == KindConfigMap && len(annotations[AnnotationPrivateKeySecret]) == 0 {
+		return 0, c.reject(ctx, obj, kind, namespace, name, fmt.Errorf("configmaps can not hold private keys, annotation '%s' must name the secret to store the private key in", AnnotationPrivateKeySecret))
+	}
+
+	service, err := c.service(role)
+	if err != nil {
+		c.recorder.Event(obj, corev1.EventTypeWarning, EventReasonIssueFailed, err.Error())
+		return 0, err
+	}
+
+	if kind == KindConfigMap {
+		err := c.privateKeyStorage(accessor).verifyOwner(ctx)
+		if errors.Is(err, errForeignSecret) {
+			return 0, c.reject(ctx, obj, kind, namespace, name, err)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	keyPair, err := c.keyPairStorage(accessor, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	args := issueArgs(annotations)
+	result, issueErr := service.Issue(ctx, keyPair, args)
+	c.recordEvent(obj, args.CommonName, result, issueErr)
+
+	if err := c.updateStatus(ctx, kind, namespace, name, statusAnnotations(result, issueErr)); err != nil {
+		return 0, fmt.Errorf("could not update status of %s '%s/%s': %w", kind, namespace, name, err)
+	}
+
+	if errors.Is(issueErr, errForeignSecret) {
+		// the secret has been taken over by someone else in the meantime, retrying does not help
+		return 0, nil
+	}
+	if issueErr != nil {
+		return 0, issueErr
+	}
+
+	if result.Status == pkg.Delayed && result.RetryAfter > 0 {
+		return min(result.RetryAfter, c.resyncInterval), nil
+	}
+
+	return c.resyncInterval, nil
+}
+
+func (c *Controller) get(kind, namespace, name string) (runtime.Object, error) {
+	informer, ok := c.informers[kind]
+	if !ok {
+		return nil, fmt.Errorf("kind '%s' is not watched", kind)
+	}
+
+	obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return obj.(runtime.Object), nil
+}
+
+func (c *Controller) keyPairStorage(obj metav1.Object, kind string) (*shape.KeyPairStorage, error) {
+	build := func(key string) pki.StorageImplementation {
+		return &objectStorage{client: c.client, kind: kind, namespace: obj.GetNamespace(), name: obj.GetName(), key: key}
+	}
+
+	privateKey := build(KeyPrivateKey)
+	if kind == KindConfigMap {
+		privateKey = c.privateKeyStorage(obj)
+	}
+
+	return shape.NewKeyPairStorage(build(KeyCert), privateKey, build(KeyCa))
+}
+
+// privateKeyStorage returns the storage of the Secret that receives the private key of a ConfigMap. The secret is
+// created if it does not exist yet and is deleted together with the ConfigMap. An existing secret is only written to if
+// it is owned by the ConfigMap.
+func (c *Controller) privateKeyStorage(obj metav1.Object) *objectStorage {
+	return &objectStorage{
+		client:    c.client,
+		kind:      KindSecret,
+		namespace: obj.GetNamespace(),
+		name:      obj.GetAnnotations()[AnnotationPrivateKeySecret],
+		key:       KeyPrivateKey,
+		owner: &metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Name:       obj.GetName(),
+			UID:        obj.GetUID(),
+		},
+	}
+}
+
+// reject records a request that can not be fulfilled until the annotations of the object are changed, so there is no
+// need to retry.
+func (c *Controller) reject(ctx context.Context, obj runtime.Object, kind, namespace, name string, err error) error {
+	c.recorder.Event(obj, corev1.EventTypeWarning, EventReasonIssueFailed, err.Error())
+	return c.updateStatus(ctx, kind, namespace, name, statusAnnotations(pkg.IssueResult{Status: pkg.Unknown}, err))
+}
+
+func (c *Controller) recordEvent(obj runtime.Object, commonName string, result pkg.IssueResult, err error) {
+	switch {
+	case err != nil:
+		c.recorder.Event(obj, corev1.EventTypeWarning, EventReasonIssueFailed, err.Error())
+	case result.Status == pkg.Issued:
+		c.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonIssued, "Issued certificate for '%s' with serial %s, valid until %s",
+			commonName, pkg.FormatSerial(result.IssuedCert.SerialNumber), result.IssuedCert.NotAfter.Format(time.RFC3339))
+	case result.Status == pkg.Vetoed:
+		c.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonRenewalVetoed, "Renewal of certificate for '%s' vetoed by pre-issue hook", commonName)
+	case result.Status == pkg.Delayed:
+		c.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonRenewalDelayed, "Renewal of certificate for '%s' delayed by pre-issue hook, retrying in %v", commonName, result.RetryAfter)
+	}
+}
+
+// updateStatus writes the status annotations. The object is only updated if the annotations changed, otherwise each
+// resync would create a new revision of the object.
+func (c *Controller) updateStatus(ctx context.Context, kind, namespace, name string, annotations map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch kind {
+		case KindConfigMap:
+			configMap, err := c.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !setAnnotations(&configMap.ObjectMeta, annotations) {
+				return nil
+			}
+			_, err = c.client.CoreV1().ConfigMaps(namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+			return err
+		default:
+			secret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !setAnnotations(&secret.ObjectMeta, annotations) {
+				return nil
+			}
+			_, err = c.client.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
+			return err
+		}
+	})
+}
+
+// setAnnotations sets the given annotations, empty values remove the annotation. Returns whether the annotations
+// changed.
+func setAnnotations(obj *metav1.ObjectMeta, annotations map[string]string) bool {
+	changed := false
+	for key, val := range annotations {
+		existing, ok := obj.Annotations[key]
+		switch {
+		case len(val) == 0 && ok:
+			delete(obj.Annotations, key)
+			changed = true
+		case len(val) > 0 && existing != val:
+			if obj.Annotations == nil {
+				obj.Annotations = map[string]string{}
+			}
+			obj.Annotations[key] = val
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func statusAnnotations(result pkg.IssueResult, err error) map[string]string {
+	ret := map[string]string{
+		AnnotationStatus:    status.IssueStatusName(result.Status),
+		AnnotationLastError: "",
+	}
+
+	if err != nil {
+		ret[AnnotationStatus] = status.StatusFailed
+		ret[AnnotationLastError] = err.Error()
+	}
+
+	cert := result.IssuedCert
+	if cert == nil {
+		cert = result.ExistingCert
+	}
+	if cert != nil {
+		ret[AnnotationSerial] = pkg.FormatSerial(cert.SerialNumber)
+		ret[AnnotationNotAfter] = cert.NotAfter.UTC().Format(time.RFC3339)
+	}
+
+	if result.Status == pkg.Issued {
+		ret[AnnotationLastIssued] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	return ret
+}
+
+func issueArgs(annotations map[string]string) pkg.IssueArgs {
+	return pkg.IssueArgs{
+		CommonName: annotations[AnnotationCommonName],
+		Ttl:        annotations[AnnotationTtl],
+		AltNames:   splitList(annotations[AnnotationAltNames]),
+		IpSans:     splitList(annotations[AnnotationIpSans]),
+	}
+}
+
+func splitList(val string) []string {
+	var ret []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func requestAnnotations(obj any) map[string]string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+
+	ret := map[string]string{}
+	for _, key := range requestKeys {
+		ret[key] = accessor.GetAnnotations()[key]
+	}
+	return ret
+}
+
+func keyPairData(obj any) map[string]string {
+	ret := map[string]string{}
+	for _, key := range []string{KeyCert, KeyPrivateKey, KeyCa} {
+		switch o := obj.(type) {
+		case *corev1.Secret:
+			ret[key] = string(o.Data[key])
+		case *corev1.ConfigMap:
+			ret[key] = o.Data[key]
+		}
+	}
+	return ret
+}
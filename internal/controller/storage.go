@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// errForeignSecret is returned for an existing secret that is supposed to receive the private key of a ConfigMap, but
+// is not owned by it. Such secrets belong to someone else and are never written to.
+var errForeignSecret = errors.New("secret is not owned by the configmap")
+
+// objectStorage reads and writes a single key of an annotated Secret or ConfigMap. The object is owned by the user,
+// so its metadata and all other keys are kept when writing.
+type objectStorage struct {
+	client    kubernetes.Interface
+	kind      string
+	namespace string
+	name      string
+	key       string
+	// owner is set for secrets that are created on demand, otherwise the object must exist
+	owner *metav1.OwnerReference
+}
+
+func (s *objectStorage) Read() ([]byte, error) {
+	data, err := s.read(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	val, ok := data[s.key]
+	if !ok {
+		return nil, fmt.Errorf("%s '%s/%s' does not contain key '%s': %w", s.kind, s.namespace, s.name, s.key, pkg.ErrNoCertFound)
+	}
+	return val, nil
+}
+
+func (s *objectStorage) CanRead() error {
+	_, err := s.read(context.TODO())
+	return err
+}
+
+func (s *objectStorage) Write(data []byte) error {
+	ctx := context.TODO()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch s.kind {
+		case KindConfigMap:
+			configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if configMap.Data == nil {
+				configMap.Data = map[string]string{}
+			}
+			configMap.Data[s.key] = string(data)
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+			return err
+		default:
+			secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+			if k8sErrors.IsNotFound(err) && s.owner != nil {
+				return s.createSecret(ctx, data)
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.checkOwner(secret); err != nil {
+				return err
+			}
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[s.key] = data
+			_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+			return err
+		}
+	})
+}
+
+func (s *objectStorage) createSecret(ctx context.Context, data []byte) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            s.name,
+			Namespace:       s.namespace,
+			OwnerReferences: []metav1.OwnerReference{*s.owner},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{s.key: data},
+	}
+
+	_, err := s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if k8sErrors.IsAlreadyExists(err) {
+		// created concurrently, retry updating it
+		return k8sErrors.NewConflict(corev1.Resource("secrets"), s.name, err)
+	}
+	return err
+}
+
+// Clear removes the key from the object, e.g. when rolling back the first certificate written to it.
+func (s *objectStorage) Clear() error {
+	ctx := context.TODO()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch s.kind {
+		case KindConfigMap:
+			configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+			if err != nil {
+				return ignoreNotFound(err)
+			}
+			if _, ok := configMap.Data[s.key]; !ok {
+				return nil
+			}
+			delete(configMap.Data, s.key)
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+			return err
+		default:
+			secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+			if err != nil {
+				return ignoreNotFound(err)
+			}
+			if err := s.checkOwner(secret); err != nil {
+				return err
+			}
+			if _, ok := secret.Data[s.key]; !ok {
+				return nil
+			}
+			delete(secret.Data, s.key)
+			_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+			return err
+		}
+	})
+}
+
+// checkOwner returns errForeignSecret if the secret is supposed to be owned but the owner is missing from its owner
+// references.
+func (s *objectStorage) checkOwner(secret *corev1.Secret) error {
+	if s.owner == nil {
+		return nil
+	}
+	for _, ref := range secret.OwnerReferences {
+		if ref.UID == s.owner.UID {
+			return nil
+		}
+	}
+	return fmt.Errorf("secret '%s/%s': %w", s.namespace, s.name, errForeignSecret)
+}
+
+// verifyOwner checks that the secret, if it exists already, is owned.
+func (s *objectStorage) verifyOwner(ctx context.Context) error {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	return s.checkOwner(secret)
+}
+
+func (s *objectStorage) CanWrite() error {
+	return nil
+}
+
+func (s *objectStorage) read(ctx context.Context) (map[string][]byte, error) {
+	if s.kind == KindConfigMap {
+		configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, notFound(err)
+		}
+		data := make(map[string][]byte, len(configMap.Data))
+		for key, val := range configMap.Data {
+			data[key] = []byte(val)
+		}
+		return data, nil
+	}
+
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return secret.Data, nil
+}
+
+func ignoreNotFound(err error) error {
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func notFound(err error) error {
+	if k8sErrors.IsNotFound(err) {
+		return pkg.ErrNoCertFound
+	}
+	return err
+}
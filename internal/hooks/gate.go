@@ -0,0 +1,103 @@
+package hooks
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultDelayExitCode is the exit code a pre-issue hook uses to delay the renewal. It defaults to EX_TEMPFAIL.
+	DefaultDelayExitCode = 75
+	DefaultRetryDelay    = 10 * time.Minute
+)
+
+// EnvFunc builds the environment that is passed to the hooks for the given certificate.
+type EnvFunc func(cert *x509.Certificate) map[string]string
+
+// Gate runs pre-issue hooks before a certificate is renewed. A hook exiting with the delay exit code postpones the
+// renewal, any other failure vetoes it.
+type Gate struct {
+	hooks         []Hook
+	env           EnvFunc
+	delayExitCode int
+	retryDelay    time.Duration
+}
+
+type GateOpts func(gate *Gate) error
+
+func NewGate(hooks []Hook, env EnvFunc, opts ...GateOpts) (*Gate, error) {
+	if len(hooks) == 0 {
+		return nil, errors.New("no hooks provided")
+	}
+
+	ret := &Gate{
+		hooks:         hooks,
+		env:           env,
+		delayExitCode: DefaultDelayExitCode,
+		retryDelay:    DefaultRetryDelay,
+	}
+
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func WithDelayExitCode(code int) GateOpts {
+	return func(g *Gate) error {
+		if code <= 0 || code > 255 {
+			return fmt.Errorf("invalid delay exit code %d", code)
+		}
+		g.delayExitCode = code
+		return nil
+	}
+}
+
+func WithRetryDelay(delay time.Duration) GateOpts {
+	return func(g *Gate) error {
+		if delay <= 0 {
+			return fmt.Errorf("invalid retry delay %v", delay)
+		}
+		g.retryDelay = delay
+		return nil
+	}
+}
+
+func (g *Gate) Permit(ctx context.Context, cert *x509.Certificate) error {
+	var env map[string]string
+	if g.env != nil {
+		env = g.env(cert)
+	}
+
+	log.Info().Msgf("Running %d pre-issue hooks", len(g.hooks))
+	for _, hook := range g.hooks {
+		err := runHook(ctx, hook, env)
+		if err == nil {
+			continue
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == g.delayExitCode {
+			return &pkg.DelayError{RetryAfter: g.retryDelay, Err: err}
+		}
+
+		if hook.ContinueOnFailure {
+			log.Warn().Err(err).Str("hook", hook.GetName()).Msg("Pre-issue hook failed, continuing")
+			continue
+		}
+
+		return fmt.Errorf("%w: %w", pkg.ErrIssueVetoed, err)
+	}
+
+	return nil
+}
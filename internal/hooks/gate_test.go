@@ -0,0 +1,57 @@
+package hooks
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"golang.org/x/net/context"
+)
+
+func TestGate_Permit(t *testing.T) {
+	tests := []struct {
+		name           string
+		hooks          []Hook
+		wantErr        error
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:  "permitted",
+			hooks: []Hook{{Shell: "exit 0"}},
+		},
+		{
+			name:    "vetoed",
+			hooks:   []Hook{{Shell: "exit 1"}, {Shell: "exit 0"}},
+			wantErr: pkg.ErrIssueVetoed,
+		},
+		{
+			name:           "delayed",
+			hooks:          []Hook{{Shell: "exit 0"}, {Shell: "exit 75"}},
+			wantErr:        pkg.ErrIssueDelayed,
+			wantRetryAfter: time.Minute,
+		},
+		{
+			name:  "continue on failure",
+			hooks: []Hook{{Shell: "exit 1", ContinueOnFailure: true}, {Shell: "exit 0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate, err := NewGate(tt.hooks, nil, WithRetryDelay(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = gate.Permit(context.Background(), nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Permit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var delayErr *pkg.DelayError
+			if errors.As(err, &delayErr) && delayErr.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("Permit() retryAfter = %v, want %v", delayErr.RetryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
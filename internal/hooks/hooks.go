@@ -0,0 +1,223 @@
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+const (
+	DefaultTimeout = 15 * time.Second
+	defaultShell   = "/bin/sh"
+	waitDelay      = time.Second
+
+	// maxOutputSize limits the amount of output of a hook that is captured
+	maxOutputSize = 64 * 1024
+)
+
+// Hook is a command that is run after a certificate (or CRL) has been written. Either Argv or Shell must be set.
+type Hook struct {
+	Name              string        `mapstructure:"name"`
+	Argv              []string      `mapstructure:"argv" validate:"required_without=Shell,excluded_with=Shell"`
+	Shell             string        `mapstructure:"shell" validate:"required_without=Argv,excluded_with=Argv"`
+	WorkingDir        string        `mapstructure:"working-dir"`
+	Timeout           time.Duration `mapstructure:"timeout" validate:"gte=0"`
+	RunAs             string        `mapstructure:"run-as"`
+	ContinueOnFailure bool          `mapstructure:"continue-on-failure"`
+}
+
+// FromCommandLine builds a hook from a plain command line. The command line is split into its arguments like a shell
+// would do it, but it is not executed by a shell.
+func FromCommandLine(cmd string) (Hook, error) {
+	argv, err := SplitCommand(cmd)
+	if err != nil {
+		return Hook{}, fmt.Errorf("could not parse hook '%s': %w", cmd, err)
+	}
+
+	if len(argv) == 0 {
+		return Hook{}, errors.New("empty hook provided")
+	}
+
+	return Hook{
+		Argv:              argv,
+		ContinueOnFailure: true,
+	}, nil
+}
+
+func (h *Hook) GetName() string {
+	if len(h.Name) > 0 {
+		return h.Name
+	}
+
+	if len(h.Argv) > 0 {
+		return h.Argv[0]
+	}
+
+	return "shell"
+}
+
+func (h *Hook) command(ctx context.Context) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	switch {
+	case len(h.Argv) > 0:
+		cmd = exec.CommandContext(ctx, h.Argv[0], h.Argv[1:]...) //#nosec G204
+	case len(h.Shell) > 0:
+		cmd = exec.CommandContext(ctx, defaultShell, "-c", h.Shell) //#nosec G204
+	default:
+		return nil, errors.New("neither argv nor shell defined")
+	}
+
+	cmd.Dir = h.WorkingDir
+	// children of the killed process may keep the output pipes open, don't wait for them forever
+	cmd.WaitDelay = waitDelay
+
+	if len(h.RunAs) > 0 {
+		credential, err := lookupCredential(h.RunAs)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+
+	return cmd, nil
+}
+
+func lookupCredential(username string) (*syscall.Credential, error) {
+	localUser, err := user.Lookup(username)
+	if err != nil {
+		return nil, fmt.Errorf("could not lookup user '%s': %v", username, err)
+	}
+
+	uid, err := strconv.ParseUint(localUser.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("was expecting a numerical uid, got '%s'", localUser.Uid)
+	}
+
+	gid, err := strconv.ParseUint(localUser.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("was expecting a numerical gid, got '%s'", localUser.Gid)
+	}
+
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// Runner runs hooks sequentially.
+type Runner struct {
+	hooks []Hook
+}
+
+func NewRunner(hooks []Hook) *Runner {
+	return &Runner{hooks: hooks}
+}
+
+func (r *Runner) Len() int {
+	return len(r.hooks)
+}
+
+// Run runs all hooks and passes the given variables as additional environment. Unless a failing hook is configured to
+// continue on failure, the remaining hooks are skipped.
+func (r *Runner) Run(ctx context.Context, env map[string]string) error {
+	if len(r.hooks) > 0 {
+		log.Info().Msgf("Running %d hooks", len(r.hooks))
+	}
+
+	var errs error
+	for _, hook := range r.hooks {
+		err := runHook(ctx, hook, env)
+		if err == nil {
+			continue
+		}
+
+		errs = multierr.Append(errs, err)
+		if !hook.ContinueOnFailure {
+			log.Warn().Str("hook", hook.GetName()).Msg("Hook failed, skipping remaining hooks")
+			break
+		}
+	}
+
+	return errs
+}
+
+func runHook(ctx context.Context, hook Hook, env map[string]string) error {
+	name := hook.GetName()
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd, err := hook.command(ctx)
+	if err != nil {
+		internal.MetricHookFailures.WithLabelValues(name).Inc()
+		return fmt.Errorf("%w: hook '%s': %v", pkg.ErrRunHook, name, err)
+	}
+
+	cmd.Env = os.Environ()
+	for key, val := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, val))
+	}
+
+	stdout := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxOutputSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	log.Info().Str("hook", name).Msg("Running hook")
+	start := time.Now()
+	err = cmd.Run()
+	internal.MetricHookDuration.WithLabelValues(name).Set(time.Since(start).Seconds())
+
+	logOutput(name, "stdout", stdout.Bytes())
+	logOutput(name, "stderr", stderr.Bytes())
+
+	if err != nil {
+		internal.MetricHookFailures.WithLabelValues(name).Inc()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: hook '%s' timed out after %v", pkg.ErrRunHook, name, timeout)
+		}
+		return fmt.Errorf("%w: hook '%s' failed: %w", pkg.ErrRunHook, name, err)
+	}
+
+	return nil
+}
+
+func logOutput(hook, stream string, output []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		log.Info().Str("hook", hook).Str("stream", stream).Msg(scanner.Text())
+	}
+}
+
+// limitedBuffer captures output up to a limit and discards the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.Len()
+	if remaining > 0 {
+		if len(p) > remaining {
+			b.Buffer.Write(p[:remaining])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+
+	return len(p), nil
+}
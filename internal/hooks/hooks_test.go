@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"golang.org/x/net/context"
+)
+
+func TestRunner_Run(t *testing.T) {
+	tests := []struct {
+		name     string
+		hooks    []Hook
+		wantErr  bool
+		wantFile string
+	}{
+		{
+			name: "argv",
+			hooks: []Hook{
+				{Argv: []string{"/bin/sh", "-c", `echo "$VAULT_PKI_CLI_SERIAL" > out`}},
+			},
+			wantFile: "aa:bb\n",
+		},
+		{
+			name: "shell",
+			hooks: []Hook{
+				{Shell: `echo "$VAULT_PKI_CLI_SERIAL" > out`},
+			},
+			wantFile: "aa:bb\n",
+		},
+		{
+			name: "failure stops remaining hooks",
+			hooks: []Hook{
+				{Shell: "exit 1"},
+				{Shell: "echo ran > out"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "continue on failure",
+			hooks: []Hook{
+				{Shell: "exit 1", ContinueOnFailure: true},
+				{Shell: "echo ran > out"},
+			},
+			wantErr:  true,
+			wantFile: "ran\n",
+		},
+		{
+			name: "timeout",
+			hooks: []Hook{
+				{Shell: "sleep 5", Timeout: 50 * time.Millisecond},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i := range tt.hooks {
+				tt.hooks[i].WorkingDir = dir
+			}
+
+			err := NewRunner(tt.hooks).Run(context.Background(), map[string]string{"VAULT_PKI_CLI_SERIAL": "aa:bb"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, pkg.ErrRunHook) {
+				t.Errorf("Run() error = %v, want %v", err, pkg.ErrRunHook)
+			}
+
+			got, _ := os.ReadFile(filepath.Join(dir, "out"))
+			if string(got) != tt.wantFile {
+				t.Errorf("Run() output = %q, want %q", got, tt.wantFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+)
+
+// Observer runs the post-issue hooks after a new certificate has been issued.
+type Observer struct {
+	runner *Runner
+	env    EnvFunc
+}
+
+func NewObserver(hooks []Hook, env EnvFunc) *Observer {
+	return &Observer{
+		runner: NewRunner(hooks),
+		env:    env,
+	}
+}
+
+func (o *Observer) OnEvent(ctx context.Context, event pki.Event) error {
+	issued, ok := event.(pki.CertIssued)
+	if !ok {
+		return nil
+	}
+
+	var env map[string]string
+	if o.env != nil {
+		env = o.env(issued.Result.IssuedCert)
+	}
+
+	return o.runner.Run(ctx, env)
+}
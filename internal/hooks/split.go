@@ -0,0 +1,71 @@
+package hooks
+
+import (
+	"errors"
+	"strings"
+)
+
+// SplitCommand splits a command line into its arguments, honoring single quotes, double quotes and backslash escapes
+// the same way a POSIX shell does. Variables and globs are not expanded.
+func SplitCommand(cmd string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var inArg, escaped bool
+	var quote rune
+
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			// within double quotes, the backslash only escapes characters with a special meaning
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", r) {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("unterminated escape sequence")
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
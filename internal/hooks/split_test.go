@@ -0,0 +1,73 @@
+package hooks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "simple",
+			cmd:  "systemctl reload nginx",
+			want: []string{"systemctl", "reload", "nginx"},
+		},
+		{
+			name: "multiple spaces",
+			cmd:  "  systemctl   reload\tnginx ",
+			want: []string{"systemctl", "reload", "nginx"},
+		},
+		{
+			name: "single quotes",
+			cmd:  `echo 'hello world' "\$HOME"`,
+			want: []string{"echo", "hello world", "$HOME"},
+		},
+		{
+			name: "double quotes with escapes",
+			cmd:  `echo "say \"hi\" \n"`,
+			want: []string{"echo", `say "hi" \n`},
+		},
+		{
+			name: "escaped space",
+			cmd:  `cat my\ file`,
+			want: []string{"cat", "my file"},
+		},
+		{
+			name: "empty quoted argument",
+			cmd:  `echo ''`,
+			want: []string{"echo", ""},
+		},
+		{
+			name: "empty",
+			cmd:  "",
+			want: nil,
+		},
+		{
+			name:    "unterminated quote",
+			cmd:     `echo "hello`,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated escape",
+			cmd:     `echo hello\`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitCommand(tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SplitCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitCommand() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
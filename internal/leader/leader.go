@@ -0,0 +1,233 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	DefaultLeaseName     = "vault-pki-cli"
+	DefaultLeaseDuration = 15 * time.Second
+
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Elector takes part in a Lease based leader election. Only the leader is supposed to issue and revoke certificates,
+// all other replicas are on standby and take over if the leader does not renew the lease anymore.
+type Elector struct {
+	client        kubernetes.Interface
+	namespace     string
+	leaseName     string
+	identity      string
+	leaseDuration time.Duration
+
+	leading atomic.Bool
+	// leaderCtx is canceled as soon as the lease is lost, nil while this replica is a follower
+	leaderCtx   context.Context
+	leaderMutex sync.Mutex
+	// elected receives a value each time this replica becomes the leader
+	elected chan struct{}
+}
+
+type ElectorOpts func(*Elector) error
+
+func WithNamespace(namespace string) ElectorOpts {
+	return func(e *Elector) error {
+		if len(namespace) == 0 {
+			return errors.New("empty namespace provided")
+		}
+		e.namespace = namespace
+		return nil
+	}
+}
+
+func WithLeaseName(name string) ElectorOpts {
+	return func(e *Elector) error {
+		if len(name) == 0 {
+			return errors.New("empty lease name provided")
+		}
+		e.leaseName = name
+		return nil
+	}
+}
+
+func WithIdentity(identity string) ElectorOpts {
+	return func(e *Elector) error {
+		if len(identity) == 0 {
+			return errors.New("empty identity provided")
+		}
+		e.identity = identity
+		return nil
+	}
+}
+
+// WithLeaseDuration sets the time a follower waits before taking over a lease that has not been renewed. The leader
+// renews the lease within two thirds of this duration.
+func WithLeaseDuration(duration time.Duration) ElectorOpts {
+	return func(e *Elector) error {
+		if duration < time.Second {
+			return fmt.Errorf("lease duration must be at least 1s, got %v", duration)
+		}
+		e.leaseDuration = duration
+		return nil
+	}
+}
+
+func NewElector(client kubernetes.Interface, opts ...ElectorOpts) (*Elector, error) {
+	if client == nil {
+		return nil, errors.New("nil kubernetes client provided")
+	}
+
+	ret := &Elector{
+		client:        client,
+		leaseName:     DefaultLeaseName,
+		leaseDuration: DefaultLeaseDuration,
+		elected:       make(chan struct{}, 1),
+	}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if len(ret.namespace) == 0 {
+		namespace, err := os.ReadFile(namespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("no namespace provided and could not detect namespace: %w", err)
+		}
+		ret.namespace = strings.TrimSpace(string(namespace))
+	}
+
+	if len(ret.identity) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("no identity provided and could not detect hostname: %w", err)
+		}
+		ret.identity = hostname
+	}
+
+	internal.MetricLeader.WithLabelValues(ret.leaseName, ret.identity).Set(0)
+	return ret, nil
+}
+
+// IsLeader returns whether this replica currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// LeaderContext returns a context derived from ctx that is canceled as soon as this replica loses the lease. Work that
+// must only be done by the leader, e.g. writing and revoking certificates, should run under this context, so it is
+// aborted instead of racing with the new leader. If this replica is not the leader, ok is false.
+func (e *Elector) LeaderContext(ctx context.Context) (leaderCtx context.Context, cancel context.CancelFunc, ok bool) {
+	e.leaderMutex.Lock()
+	leading := e.leaderCtx
+	e.leaderMutex.Unlock()
+
+	if leading == nil || leading.Err() != nil {
+		return ctx, func() {}, false
+	}
+
+	leaderCtx, cancel = context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-leading.Done():
+			cancel()
+		case <-leaderCtx.Done():
+		}
+	}()
+
+	return leaderCtx, cancel, true
+}
+
+// Elected returns a channel that receives a value each time this replica becomes the leader.
+func (e *Elector) Elected() <-chan struct{} {
+	return e.elected
+}
+
+// Run takes part in the leader election until the context is canceled. After losing the lease, the replica becomes a
+// follower and tries to acquire the lease again.
+func (e *Elector) Run(ctx context.Context) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: e.namespace,
+			Name:      e.leaseName,
+		},
+		Client: e.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: e.identity,
+		},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   e.leaseDuration,
+		RenewDeadline:   e.leaseDuration * 2 / 3,
+		RetryPeriod:     e.leaseDuration / 5,
+		ReleaseOnCancel: true,
+		Name:            e.leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				log.Info().Str("lease", e.leaseName).Str("identity", e.identity).Msg("Acquired lease, became leader")
+				e.leaderMutex.Lock()
+				e.leaderCtx = leaderCtx
+				e.leaderMutex.Unlock()
+				e.setLeading(true)
+				select {
+				case e.elected <- struct{}{}:
+				default:
+				}
+			},
+			OnStoppedLeading: func() {
+				if e.leading.Load() {
+					log.Warn().Str("lease", e.leaseName).Str("identity", e.identity).Msg("Lost lease, became follower")
+				}
+				e.setLeading(false)
+				e.leaderMutex.Lock()
+				e.leaderCtx = nil
+				e.leaderMutex.Unlock()
+			},
+			OnNewLeader: func(identity string) {
+				if identity != e.identity {
+					log.Info().Str("lease", e.leaseName).Msgf("Replica '%s' is the leader", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not build leader election: %w", err)
+	}
+
+	for ctx.Err() == nil {
+		// Run returns as soon as the lease is lost
+		elector.Run(ctx)
+	}
+
+	return nil
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.leading.Store(leading)
+	val := 0.
+	if leading {
+		val = 1
+	}
+	internal.MetricLeader.WithLabelValues(e.leaseName, e.identity).Set(val)
+}
@@ -0,0 +1,103 @@
+package leader
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestElector_Failover(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	build := func(identity string) *Elector {
+		elector, err := NewElector(client, WithNamespace("default"), WithIdentity(identity), WithLeaseDuration(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return elector
+	}
+
+	first := build("first")
+	second := build("second")
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		_ = first.Run(firstCtx)
+	}()
+
+	waitFor(t, first.IsLeader, "first replica did not become leader")
+	select {
+	case <-first.Elected():
+	default:
+		t.Error("expected election to be signaled")
+	}
+
+	leaderCtx, cancelLeaderCtx, ok := first.LeaderContext(context.Background())
+	defer cancelLeaderCtx()
+	if !ok {
+		t.Fatal("expected leader context for the leader")
+	}
+	if _, _, ok := second.LeaderContext(context.Background()); ok {
+		t.Error("expected no leader context for a follower")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = second.Run(ctx)
+	}()
+
+	time.Sleep(1500 * time.Millisecond)
+	if second.IsLeader() {
+		t.Fatal("second replica became leader while the lease is held")
+	}
+
+	cancelFirst()
+	<-firstDone
+	if first.IsLeader() {
+		t.Error("expected first replica to step down")
+	}
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(time.Second):
+		t.Error("expected leader context to be canceled after losing the lease")
+	}
+
+	waitFor(t, second.IsLeader, "second replica did not take over")
+}
+
+func TestNewElector(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	if _, err := NewElector(nil, WithNamespace("default"), WithIdentity("a")); err == nil {
+		t.Error("expected error for nil client")
+	}
+
+	if _, err := NewElector(client, WithNamespace("default"), WithIdentity("a"), WithLeaseDuration(time.Millisecond)); err == nil {
+		t.Error("expected error for too short lease duration")
+	}
+
+	elector, err := NewElector(client, WithNamespace("default"), WithIdentity("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elector.leaseName != DefaultLeaseName || elector.leaseDuration != DefaultLeaseDuration {
+		t.Errorf("unexpected defaults: %s %v", elector.leaseName, elector.leaseDuration)
+	}
+}
@@ -5,17 +5,17 @@ import (
 	"crypto/x509"
 	"errors"
 	"math"
-	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/expfmt"
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/storage/shape"
 )
 
 const (
@@ -23,6 +23,9 @@ const (
 
 	MetricCertErrorsLabelCn    = "cn"
 	MetricCertErrorsLabelError = "error"
+
+	MetricCrlLabelIssuer = "issuer"
+	MetricCrlLabelKind   = "kind"
 )
 
 var (
@@ -56,6 +59,120 @@ var (
 		Help:      "The passed lifetime of the certificate in percent",
 	}, []string{"cn"})
 
+	MetricCertRevoked = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cert_revoked_bool",
+		Help:      "Boolean that reflects whether the existing cert has been found on the CRL",
+	}, []string{"cn"})
+
+	MetricOcspStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "ocsp_status",
+		Help:      "The OCSP status of the certificate (0 = good, 1 = revoked, 2 = unknown)",
+	}, []string{"cn"})
+
+	MetricOcspNextUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "ocsp_next_update_seconds",
+		Help:      "The time when the OCSP response will be outdated",
+	}, []string{"cn"})
+
+	MetricCrlThisUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "crl_this_update_seconds",
+		Help:      "The time the CRL has been issued",
+	}, []string{MetricCrlLabelIssuer, MetricCrlLabelKind})
+
+	MetricCrlNextUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "crl_next_update_seconds",
+		Help:      "The time the next CRL will be issued",
+	}, []string{MetricCrlLabelIssuer, MetricCrlLabelKind})
+
+	MetricCrlExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "crl_expiry_seconds",
+		Help:      "The number of seconds until the CRL expires",
+	}, []string{MetricCrlLabelIssuer, MetricCrlLabelKind})
+
+	MetricCrlRevokedEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "crl_revoked_entries",
+		Help:      "The number of revoked certificates listed in the CRL",
+	}, []string{MetricCrlLabelIssuer, MetricCrlLabelKind})
+
+	MetricCrlErrors = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "crl_errors_total",
+		Help:      "The total number of errors while handling the CRL",
+	}, []string{MetricCrlLabelKind, MetricCertErrorsLabelError})
+
+	MetricRevocationQueueSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "revocation_queue_size",
+		Help:      "The number of superseded certificates waiting to be revoked",
+	}, []string{"cn"})
+
+	MetricRenewalDeferred = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "renewal_deferred_total",
+		Help:      "The total number of renewals that have been vetoed or delayed by pre-issue hooks",
+	}, []string{"cn", "reason"})
+
+	MetricNotificationErrors = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "notification_errors_total",
+		Help:      "The total number of notifications that could not be delivered",
+	}, []string{"notifier"})
+
+	MetricLeader = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader_bool",
+		Help:      "Boolean that reflects whether this replica is the leader that issues certificates",
+	}, []string{"lease", "identity"})
+
+	MetricConfigReloads = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_reloads_total",
+		Help:      "The total number of config reloads by their outcome",
+	}, []string{"outcome"})
+
+	MetricHookDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "hook_duration_seconds",
+		Help:      "The duration of the last run of a hook",
+	}, []string{"hook"})
+
+	MetricHookFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "hook_failures_total",
+		Help:      "The total number of failed hook runs",
+	}, []string{"hook"})
+
+	MetricSinkCertExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_cert_expiry_seconds",
+		Help:      "The date after the cert stored in the sink is not valid anymore",
+	}, []string{"sink"})
+
+	MetricSinkCertNotBefore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_cert_not_before_seconds",
+		Help:      "The date the cert stored in the sink has been issued",
+	}, []string{"sink"})
+
+	MetricSinkStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_stale_bool",
+		Help:      "Boolean that reflects whether the sink does not contain the newest valid keypair of all sinks",
+	}, []string{"sink"})
+
+	MetricSinkKeyMatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_key_matches_bool",
+		Help:      "Boolean that reflects whether the private key stored in the sink belongs to its cert",
+	}, []string{"sink"})
+
 	MetricRunTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: metricsNamespace,
 		Name:      "run_timestamp_seconds",
@@ -74,25 +191,6 @@ func WriteMetrics(path string) error {
 	return os.WriteFile(path, []byte(metrics), 0644) // #nosec G306
 }
 
-func StartMetricsServer(addr string) error {
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-
-	server := http.Server{
-		Addr:              addr,
-		ReadTimeout:       3 * time.Second,
-		WriteTimeout:      3 * time.Second,
-		ReadHeaderTimeout: 3 * time.Second,
-		IdleTimeout:       90 * time.Second,
-	}
-
-	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-		return err
-	}
-
-	return nil
-}
-
 func UpdateCertificateMetrics(cert *x509.Certificate) {
 	if cert == nil {
 		log.Warn().Msg("can not update cert metrics, nil cert passed")
@@ -109,6 +207,42 @@ func UpdateCertificateMetrics(cert *x509.Certificate) {
 	MetricCertLifetimePercent.WithLabelValues(cert.Subject.CommonName).Set(percentage)
 }
 
+// UpdateSinkMetrics updates the freshness metrics of each sink. The expiry metrics of unreadable sinks are removed.
+func UpdateSinkMetrics(statuses []shape.SinkStatus) {
+	for _, status := range statuses {
+		sink := strconv.Itoa(status.Index)
+		if status.Cert != nil {
+			MetricSinkCertExpiry.WithLabelValues(sink).Set(float64(status.Cert.NotAfter.Unix()))
+			MetricSinkCertNotBefore.WithLabelValues(sink).Set(float64(status.Cert.NotBefore.Unix()))
+		} else {
+			MetricSinkCertExpiry.DeleteLabelValues(sink)
+			MetricSinkCertNotBefore.DeleteLabelValues(sink)
+		}
+		MetricSinkStale.WithLabelValues(sink).Set(boolToFloat(status.Stale))
+		MetricSinkKeyMatches.WithLabelValues(sink).Set(boolToFloat(status.KeyMatches))
+	}
+}
+
+func boolToFloat(val bool) float64 {
+	if val {
+		return 1
+	}
+	return 0
+}
+
+func UpdateCrlMetrics(crl *x509.RevocationList, kind string) {
+	if crl == nil {
+		log.Warn().Msg("can not update crl metrics, nil crl passed")
+		return
+	}
+
+	issuer := crl.Issuer.CommonName
+	MetricCrlThisUpdate.WithLabelValues(issuer, kind).Set(float64(crl.ThisUpdate.Unix()))
+	MetricCrlNextUpdate.WithLabelValues(issuer, kind).Set(float64(crl.NextUpdate.Unix()))
+	MetricCrlExpiry.WithLabelValues(issuer, kind).Set(time.Until(crl.NextUpdate).Seconds())
+	MetricCrlRevokedEntries.WithLabelValues(issuer, kind).Set(float64(len(crl.RevokedCertificateEntries)))
+}
+
 func TranslateErrToPromLabel(err error) string {
 	if errors.Is(err, pkg.ErrWriteCert) {
 		return "write_issued_cert"
@@ -122,6 +256,18 @@ func TranslateErrToPromLabel(err error) string {
 	if errors.Is(err, pkg.ErrCertInvalidData) {
 		return "issued_cert_invalid_data"
 	}
+	if errors.Is(err, pkg.ErrRevokeCert) {
+		return "revoke_error"
+	}
+	if errors.Is(err, pkg.ErrFetchCrl) {
+		return "fetch_crl"
+	}
+	if errors.Is(err, pkg.ErrCrlInvalid) {
+		return "crl_invalid"
+	}
+	if errors.Is(err, pkg.ErrCrlOutdated) {
+		return "crl_outdated"
+	}
 	return "unknown"
 }
 
@@ -0,0 +1,274 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultSmtpPort    = 587
+	defaultDedupWindow = 24 * time.Hour
+)
+
+// EmailConfig configures an email notifier.
+type EmailConfig struct {
+	Name        string        `mapstructure:"name"`
+	Host        string        `mapstructure:"host" validate:"required"`
+	Port        int           `mapstructure:"port" validate:"omitempty,gte=1,lte=65535"`
+	StartTls    bool          `mapstructure:"starttls"`
+	Username    string        `mapstructure:"username"`
+	Password    string        `mapstructure:"password" validate:"required_with=Username"`
+	From        string        `mapstructure:"from" validate:"required,email"`
+	To          []string      `mapstructure:"to" validate:"required,min=1,dive,email"`
+	Template    string        `mapstructure:"template"`
+	DedupWindow time.Duration `mapstructure:"dedup-window" validate:"gte=0"`
+	Filter      `mapstructure:",squash"`
+}
+
+func (c EmailConfig) String() string {
+	return fmt.Sprintf("{host=%s port=%d from=%s to=%v}", c.Host, c.Port, c.From, c.To)
+}
+
+// Email sends events as mails via SMTP. Mails for the same event type and common name are only sent once within the
+// deduplication window.
+type Email struct {
+	host        string
+	port        int
+	startTls    bool
+	tlsConfig   *tls.Config
+	auth        smtp.Auth
+	from        string
+	to          []string
+	renderer    *MessageRenderer
+	dedupWindow time.Duration
+
+	sent  map[string]time.Time
+	mutex sync.Mutex
+}
+
+type EmailOpt func(e *Email) error
+
+func WithPort(port int) EmailOpt {
+	return func(e *Email) error {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+		e.port = port
+		return nil
+	}
+}
+
+func WithStartTls(tlsConfig *tls.Config) EmailOpt {
+	return func(e *Email) error {
+		e.startTls = true
+		if tlsConfig != nil {
+			e.tlsConfig = tlsConfig
+		}
+		return nil
+	}
+}
+
+func WithCredentials(username, password string) EmailOpt {
+	return func(e *Email) error {
+		if len(username) == 0 {
+			return errors.New("empty username")
+		}
+		e.auth = smtp.PlainAuth("", username, password, e.host)
+		return nil
+	}
+}
+
+func WithDedupWindow(window time.Duration) EmailOpt {
+	return func(e *Email) error {
+		if window < 0 {
+			return fmt.Errorf("invalid dedup window %v", window)
+		}
+		e.dedupWindow = window
+		return nil
+	}
+}
+
+func WithEmailTemplate(customTemplate string) EmailOpt {
+	return func(e *Email) error {
+		renderer, err := NewMessageRenderer(customTemplate)
+		if err != nil {
+			return err
+		}
+		e.renderer = renderer
+		return nil
+	}
+}
+
+func NewEmail(host, from string, to []string, opts ...EmailOpt) (*Email, error) {
+	if len(host) == 0 {
+		return nil, errors.New("empty smtp host")
+	}
+	if len(from) == 0 {
+		return nil, errors.New("empty sender")
+	}
+	if len(to) == 0 {
+		return nil, errors.New("no recipients")
+	}
+
+	renderer, err := NewMessageRenderer("")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Email{
+		host:        host,
+		port:        defaultSmtpPort,
+		tlsConfig:   &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+		from:        from,
+		to:          to,
+		renderer:    renderer,
+		dedupWindow: defaultDedupWindow,
+		sent:        map[string]time.Time{},
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	return ret, errs
+}
+
+func NewEmailFromConfig(conf EmailConfig) (*Email, error) {
+	opts := []EmailOpt{
+		WithEmailTemplate(conf.Template),
+	}
+	if conf.Port > 0 {
+		opts = append(opts, WithPort(conf.Port))
+	}
+	if conf.StartTls {
+		opts = append(opts, WithStartTls(nil))
+	}
+	if len(conf.Username) > 0 {
+		opts = append(opts, WithCredentials(conf.Username, conf.Password))
+	}
+	if conf.DedupWindow > 0 {
+		opts = append(opts, WithDedupWindow(conf.DedupWindow))
+	}
+
+	return NewEmail(conf.Host, conf.From, conf.To, opts...)
+}
+
+// EmailDefaultFilter only passes renewal failures and approaching expiry if no events have been configured.
+func EmailDefaultFilter(filter Filter) Filter {
+	if len(filter.Events) == 0 {
+		filter.Events = []EventType{IssueFailed, CertExpiring}
+	}
+	return filter
+}
+
+func (e *Email) Notify(ctx context.Context, event Event) error {
+	key := fmt.Sprintf("%s/%s", event.Type, event.CommonName)
+
+	e.mutex.Lock()
+	lastSent, found := e.sent[key]
+	e.mutex.Unlock()
+	if found && time.Since(lastSent) < e.dedupWindow {
+		log.Debug().Str("event", string(event.Type)).Str("cn", event.CommonName).Msg("Not sending mail, already sent within dedup window")
+		return nil
+	}
+
+	msg, err := e.renderer.Render(event)
+	if err != nil {
+		return err
+	}
+
+	if err := e.send(ctx, subject(event), msg); err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	e.sent[key] = time.Now()
+	e.mutex.Unlock()
+	return nil
+}
+
+func subject(event Event) string {
+	return fmt.Sprintf("[vault-pki-cli] %s: %s", strings.ReplaceAll(string(event.Type), "_", " "), event.CommonName)
+}
+
+func (e *Email) send(ctx context.Context, subject, body string) error {
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("could not build smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if e.startTls {
+		if err := client.StartTLS(e.tlsConfig); err != nil {
+			return fmt.Errorf("starttls failed: %w", err)
+		}
+	}
+
+	if e.auth != nil {
+		if err := client.Auth(e.auth); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, rcpt := range e.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient '%s' rejected: %w", rcpt, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(e.buildMessage(subject, body)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (e *Email) buildMessage(subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
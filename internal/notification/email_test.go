@@ -0,0 +1,192 @@
+package notification
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts all mails and records them.
+type smtpStandIn struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	mails    []string
+	rcpts    []string
+}
+
+func newSmtpStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &smtpStandIn{listener: listener}
+	go server.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return server
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mutex.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			s.mutex.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mutex.Lock()
+			s.mails = append(s.mails, data.String())
+			s.mutex.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStandIn) received() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.mails...)
+}
+
+func TestEmail_Notify(t *testing.T) {
+	server := newSmtpStandIn(t)
+
+	email, err := NewEmail("127.0.0.1", "pki@example.com", []string{"ops@example.com", "sec@example.com"}, WithPort(server.port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := Event{Type: IssueFailed, CommonName: "example.com", Error: "vault sealed", Failures: 3, Hostname: "host"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := email.Notify(ctx, event); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	mails := server.received()
+	if len(mails) != 1 {
+		t.Fatalf("Notify() sent %d mails, want 1", len(mails))
+	}
+	for _, want := range []string{
+		"Subject: [vault-pki-cli] issue failed: example.com",
+		"To: ops@example.com, sec@example.com",
+		"Renewing certificate for example.com on host failed 3 time(s): vault sealed",
+	} {
+		if !strings.Contains(mails[0], want) {
+			t.Errorf("Notify() mail = %q, does not contain %q", mails[0], want)
+		}
+	}
+	if len(server.rcpts) != 2 {
+		t.Errorf("Notify() recipients = %v, want 2", server.rcpts)
+	}
+}
+
+func TestEmail_NotifyDedup(t *testing.T) {
+	server := newSmtpStandIn(t)
+
+	email, err := NewEmail("127.0.0.1", "pki@example.com", []string{"ops@example.com"}, WithPort(server.port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []Event{
+		{Type: CertExpiring, CommonName: "a.example.com"},
+		{Type: CertExpiring, CommonName: "a.example.com"},
+		{Type: CertExpiring, CommonName: "b.example.com"},
+		{Type: IssueFailed, CommonName: "a.example.com"},
+	}
+	for _, event := range events {
+		if err := email.Notify(context.Background(), event); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	if got := len(server.received()); got != 3 {
+		t.Errorf("Notify() sent %d mails, want 3", got)
+	}
+}
+
+func TestEmail_NotifyUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	email, err := NewEmail("127.0.0.1", "pki@example.com", []string{"ops@example.com"}, WithPort(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := Event{Type: IssueFailed, CommonName: "example.com"}
+	if err := email.Notify(context.Background(), event); err == nil {
+		t.Fatal("Notify() expected error for unreachable server")
+	}
+
+	// failed deliveries must not be deduplicated
+	server := newSmtpStandIn(t)
+	email.port = server.port()
+	if err := email.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got := len(server.received()); got != 1 {
+		t.Errorf("Notify() sent %d mails, want 1", got)
+	}
+}
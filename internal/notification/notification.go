@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+type EventType string
+
+const (
+	CertIssued   EventType = "cert_issued"
+	IssueFailed  EventType = "issue_failed"
+	CertExpiring EventType = "cert_expiring"
+	CertSigned   EventType = "cert_signed"
+	SignFailed   EventType = "sign_failed"
+	CertRevoked  EventType = "cert_revoked"
+	RevokeFailed EventType = "revoke_failed"
+)
+
+var EventTypes = []EventType{CertIssued, IssueFailed, CertExpiring, CertSigned, SignFailed, CertRevoked, RevokeFailed}
+
+// Event describes something noteworthy that happened to a certificate.
+type Event struct {
+	Type       EventType `json:"type"`
+	CommonName string    `json:"common_name"`
+	Serial     string    `json:"serial,omitempty"`
+	NotAfter   time.Time `json:"not_after,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Failures is the number of consecutive failures for the common name
+	Failures int       `json:"failures,omitempty"`
+	Hostname string    `json:"hostname"`
+	Time     time.Time `json:"time"`
+}
+
+func (e Event) IsFailure() bool {
+	return e.Type == IssueFailed || e.Type == SignFailed || e.Type == RevokeFailed
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Filter restricts the events that are passed to a notifier.
+type Filter struct {
+	// Events the notifier is interested in, all events if empty
+	Events []EventType `mapstructure:"events" validate:"dive,oneof=cert_issued issue_failed cert_expiring cert_signed sign_failed cert_revoked revoke_failed"`
+	// MinFailures is the number of consecutive failures that need to happen before a failure is reported
+	MinFailures int `mapstructure:"min-failures" validate:"gte=0"`
+}
+
+func (f Filter) Accepts(event Event) bool {
+	if len(f.Events) > 0 && !slices.Contains(f.Events, event.Type) {
+		return false
+	}
+
+	if event.IsFailure() && event.Failures < f.MinFailures {
+		return false
+	}
+
+	return true
+}
+
+type filteredNotifier struct {
+	name     string
+	notifier Notifier
+	filter   Filter
+}
+
+// Dispatcher passes events to all registered notifiers whose filter accepts the event. It keeps track of consecutive
+// failures per common name.
+type Dispatcher struct {
+	notifiers []filteredNotifier
+	failures  map[string]int
+	hostname  string
+	mutex     sync.Mutex
+}
+
+func NewDispatcher() *Dispatcher {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not determine hostname")
+	}
+
+	return &Dispatcher{
+		failures: map[string]int{},
+		hostname: hostname,
+	}
+}
+
+func (d *Dispatcher) Add(name string, notifier Notifier, filter Filter) {
+	d.notifiers = append(d.notifiers, filteredNotifier{
+		name:     name,
+		notifier: notifier,
+		filter:   filter,
+	})
+}
+
+func (d *Dispatcher) Len() int {
+	return len(d.notifiers)
+}
+
+// ResetFailures resets the number of consecutive failures for the common name.
+func (d *Dispatcher) ResetFailures(commonName string) {
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.failures, commonName)
+}
+
+// Notify enriches the event and sends it to all interested notifiers. A nil dispatcher discards all events.
+func (d *Dispatcher) Notify(ctx context.Context, event Event) error {
+	if d == nil {
+		return nil
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if len(event.Hostname) == 0 {
+		event.Hostname = d.hostname
+	}
+
+	d.mutex.Lock()
+	switch {
+	case event.IsFailure():
+		d.failures[event.CommonName]++
+		event.Failures = d.failures[event.CommonName]
+	case event.Type != CertExpiring:
+		delete(d.failures, event.CommonName)
+	}
+	d.mutex.Unlock()
+
+	var errs error
+	for _, n := range d.notifiers {
+		if !n.filter.Accepts(event) {
+			continue
+		}
+
+		if err := n.notifier.Notify(ctx, event); err != nil {
+			internal.MetricNotificationErrors.WithLabelValues(n.name).Inc()
+			errs = multierr.Append(errs, fmt.Errorf("notifier '%s' failed: %w", n.name, err))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+type notifierMock struct {
+	events []Event
+}
+
+func (m *notifierMock) Notify(_ context.Context, event Event) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestDispatcher_Notify(t *testing.T) {
+	dispatcher := NewDispatcher()
+
+	all := &notifierMock{}
+	dispatcher.Add("all", all, Filter{})
+
+	repeatedFailures := &notifierMock{}
+	dispatcher.Add("failures", repeatedFailures, Filter{Events: []EventType{IssueFailed}, MinFailures: 2})
+
+	events := []Event{
+		{Type: IssueFailed, CommonName: "a"},
+		{Type: IssueFailed, CommonName: "b"},
+		{Type: IssueFailed, CommonName: "a"},
+		{Type: CertIssued, CommonName: "a"},
+		{Type: IssueFailed, CommonName: "a"},
+	}
+	for _, event := range events {
+		if err := dispatcher.Notify(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(all.events) != len(events) {
+		t.Errorf("Notify() got %d events, want %d", len(all.events), len(events))
+	}
+
+	if len(repeatedFailures.events) != 1 || repeatedFailures.events[0].Failures != 2 {
+		t.Errorf("Notify() got %v, want a single event with 2 failures", repeatedFailures.events)
+	}
+
+	if all.events[4].Failures != 1 {
+		t.Errorf("Notify() failures = %d after success, want 1", all.events[4].Failures)
+	}
+
+	for _, event := range all.events {
+		if event.Time.IsZero() {
+			t.Errorf("Notify() did not set time")
+		}
+	}
+}
+
+func TestDispatcher_NotifyNil(t *testing.T) {
+	var dispatcher *Dispatcher
+	if err := dispatcher.Notify(context.Background(), Event{Type: CertIssued}); err != nil {
+		t.Errorf("Notify() error = %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package notification
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+// Observer translates the events of a PkiService into notifications. Notifications are best effort, so errors are
+// only logged and never let an operation fail.
+type Observer struct {
+	dispatcher      *Dispatcher
+	expiryThreshold time.Duration
+}
+
+// NewObserver builds an observer that also warns about certificates that expire within the threshold. A threshold
+// of zero disables expiry warnings.
+func NewObserver(dispatcher *Dispatcher, expiryThreshold time.Duration) *Observer {
+	return &Observer{
+		dispatcher:      dispatcher,
+		expiryThreshold: expiryThreshold,
+	}
+}
+
+func (o *Observer) OnEvent(ctx context.Context, event pki.Event) error {
+	if err := o.notify(ctx, event); err != nil {
+		log.Warn().Err(err).Str("event", event.EventName()).Msg("Could not send notification")
+	}
+	return nil
+}
+
+func (o *Observer) notify(ctx context.Context, event pki.Event) error {
+	switch e := event.(type) {
+	case pki.CertIssued:
+		return o.dispatcher.Notify(ctx, certEvent(CertIssued, e.Result.IssuedCert))
+	case pki.RenewalSkipped:
+		o.dispatcher.ResetFailures(e.CommonName)
+		return o.notifyExpiry(ctx, e.Result.ExistingCert)
+	case pki.IssueFailed:
+		err := o.dispatcher.Notify(ctx, Event{Type: IssueFailed, CommonName: e.CommonName, Error: e.Err.Error()})
+		return multierr.Append(err, o.notifyExpiry(ctx, e.Result.ExistingCert))
+	case pki.CertSigned:
+		return o.dispatcher.Notify(ctx, certEvent(CertSigned, e.Cert))
+	case pki.SignFailed:
+		return o.dispatcher.Notify(ctx, Event{Type: SignFailed, CommonName: e.CommonName, Error: e.Err.Error()})
+	case pki.CertRevoked:
+		return o.dispatcher.Notify(ctx, Event{Type: CertRevoked, Serial: e.Serial})
+	case pki.RevokeFailed:
+		return o.dispatcher.Notify(ctx, Event{Type: RevokeFailed, Serial: e.Serial, Error: e.Err.Error()})
+	}
+
+	return nil
+}
+
+func (o *Observer) notifyExpiry(ctx context.Context, cert *x509.Certificate) error {
+	if cert == nil || o.expiryThreshold <= 0 || time.Until(cert.NotAfter) >= o.expiryThreshold {
+		return nil
+	}
+
+	return o.dispatcher.Notify(ctx, certEvent(CertExpiring, cert))
+}
+
+func certEvent(eventType EventType, cert *x509.Certificate) Event {
+	return Event{
+		Type:       eventType,
+		CommonName: cert.Subject.CommonName,
+		Serial:     pkg.FormatSerial(cert.SerialNumber),
+		NotAfter:   cert.NotAfter,
+	}
+}
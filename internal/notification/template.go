@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+var defaultMessages = map[EventType]string{
+	CertIssued:   `Issued new certificate for {{ .CommonName }} on {{ .Hostname }}, serial {{ .Serial }}, valid until {{ .NotAfter.Format "2006-01-02T15:04:05Z07:00" }}`,
+	IssueFailed:  `Renewing certificate for {{ .CommonName }} on {{ .Hostname }} failed {{ .Failures }} time(s): {{ .Error }}`,
+	CertExpiring: `Certificate for {{ .CommonName }} on {{ .Hostname }} expires at {{ .NotAfter.Format "2006-01-02T15:04:05Z07:00" }}`,
+	CertSigned:   `Signed certificate for {{ .CommonName }} on {{ .Hostname }}`,
+	SignFailed:   `Signing certificate for {{ .CommonName }} on {{ .Hostname }} failed {{ .Failures }} time(s): {{ .Error }}`,
+	CertRevoked:  `Revoked certificate with serial {{ .Serial }} on {{ .Hostname }}`,
+	RevokeFailed: `Revoking certificate with serial {{ .Serial }} on {{ .Hostname }} failed {{ .Failures }} time(s): {{ .Error }}`,
+}
+
+// MessageRenderer renders human-readable messages for events. Custom templates have access to all fields of Event.
+type MessageRenderer struct {
+	custom   *template.Template
+	defaults map[EventType]*template.Template
+}
+
+func NewMessageRenderer(customTemplate string) (*MessageRenderer, error) {
+	ret := &MessageRenderer{
+		defaults: map[EventType]*template.Template{},
+	}
+
+	if len(customTemplate) > 0 {
+		tmpl, err := template.New("custom").Parse(customTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse template: %w", err)
+		}
+		ret.custom = tmpl
+	}
+
+	for eventType, text := range defaultMessages {
+		ret.defaults[eventType] = template.Must(template.New(string(eventType)).Parse(text))
+	}
+
+	return ret, nil
+}
+
+func (r *MessageRenderer) Render(event Event) (string, error) {
+	tmpl := r.custom
+	if tmpl == nil {
+		var ok bool
+		tmpl, ok = r.defaults[event.Type]
+		if !ok {
+			return fmt.Sprintf("%s: %s", event.Type, event.CommonName), nil
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", fmt.Errorf("could not render template: %w", err)
+	}
+
+	return buf.String(), nil
+}
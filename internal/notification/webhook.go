@@ -0,0 +1,202 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+const (
+	FormatJson  = "json"
+	FormatSlack = "slack"
+
+	defaultWebhookRetries = 3
+)
+
+// WebhookConfig configures a webhook notifier.
+type WebhookConfig struct {
+	Name     string            `mapstructure:"name"`
+	Url      string            `mapstructure:"url" validate:"required,url"`
+	Format   string            `mapstructure:"format" validate:"omitempty,oneof=json slack"`
+	Template string            `mapstructure:"template"`
+	Retries  *uint64           `mapstructure:"retries" validate:"omitempty,lte=10"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Filter   `mapstructure:",squash"`
+}
+
+// String omits the url and headers as they usually contain secrets.
+func (c WebhookConfig) String() string {
+	return fmt.Sprintf("{name=%s format=%s events=%v}", c.Name, c.Format, c.Events)
+}
+
+// Webhook posts events to an HTTP endpoint, either as generic JSON payload or as payload of a Slack-compatible
+// incoming webhook.
+type Webhook struct {
+	url        string
+	format     string
+	headers    map[string]string
+	retries    uint64
+	renderer   *MessageRenderer
+	httpClient *http.Client
+}
+
+type WebhookOpt func(w *Webhook) error
+
+func WithFormat(format string) WebhookOpt {
+	return func(w *Webhook) error {
+		if format != FormatJson && format != FormatSlack {
+			return fmt.Errorf("unknown webhook format '%s'", format)
+		}
+		w.format = format
+		return nil
+	}
+}
+
+func WithTemplate(customTemplate string) WebhookOpt {
+	return func(w *Webhook) error {
+		renderer, err := NewMessageRenderer(customTemplate)
+		if err != nil {
+			return err
+		}
+		w.renderer = renderer
+		return nil
+	}
+}
+
+func WithRetries(retries uint64) WebhookOpt {
+	return func(w *Webhook) error {
+		w.retries = retries
+		return nil
+	}
+}
+
+func WithHeaders(headers map[string]string) WebhookOpt {
+	return func(w *Webhook) error {
+		w.headers = headers
+		return nil
+	}
+}
+
+func WithHttpClient(client *http.Client) WebhookOpt {
+	return func(w *Webhook) error {
+		if client == nil {
+			return errors.New("nil http client")
+		}
+		w.httpClient = client
+		return nil
+	}
+}
+
+func NewWebhook(url string, opts ...WebhookOpt) (*Webhook, error) {
+	if len(url) == 0 {
+		return nil, errors.New("empty webhook url")
+	}
+
+	renderer, err := NewMessageRenderer("")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Webhook{
+		url:        url,
+		format:     FormatJson,
+		retries:    defaultWebhookRetries,
+		renderer:   renderer,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	return ret, errs
+}
+
+func NewWebhookFromConfig(conf WebhookConfig) (*Webhook, error) {
+	opts := []WebhookOpt{
+		WithTemplate(conf.Template),
+		WithHeaders(conf.Headers),
+	}
+	if len(conf.Format) > 0 {
+		opts = append(opts, WithFormat(conf.Format))
+	}
+	if conf.Retries != nil {
+		opts = append(opts, WithRetries(*conf.Retries))
+	}
+
+	return NewWebhook(conf.Url, opts...)
+}
+
+type jsonPayload struct {
+	Event
+	Message string `json:"message"`
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	msg, err := w.renderer.Render(event)
+	if err != nil {
+		return err
+	}
+
+	var payload any = jsonPayload{Event: event, Message: msg}
+	if w.format == FormatSlack {
+		payload = slackPayload{Text: msg}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not marshal payload: %w", err)
+	}
+
+	op := func() error {
+		return w.post(ctx, body)
+	}
+
+	backoffImpl := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), w.retries), ctx)
+	return backoff.Retry(op, backoffImpl)
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range w.headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return backoff.Permanent(err)
+	}
+
+	return err
+}
@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	event := Event{
+		Type:       CertIssued,
+		CommonName: "example.com",
+		Serial:     "aa:bb",
+		NotAfter:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Hostname:   "host",
+	}
+
+	tests := []struct {
+		name     string
+		opts     []WebhookOpt
+		wantKey  string
+		wantText string
+	}{
+		{
+			name:     "json",
+			wantKey:  "message",
+			wantText: "Issued new certificate for example.com on host, serial aa:bb, valid until 2030-01-01T00:00:00Z",
+		},
+		{
+			name:     "slack",
+			opts:     []WebhookOpt{WithFormat(FormatSlack)},
+			wantKey:  "text",
+			wantText: "Issued new certificate for example.com on host, serial aa:bb, valid until 2030-01-01T00:00:00Z",
+		},
+		{
+			name:     "custom template",
+			opts:     []WebhookOpt{WithFormat(FormatSlack), WithTemplate("{{ .Type }} {{ .CommonName }}")},
+			wantKey:  "text",
+			wantText: "cert_issued example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Error(err)
+				}
+			}))
+			defer server.Close()
+
+			webhook, err := NewWebhook(server.URL, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := webhook.Notify(context.Background(), event); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if payload[tt.wantKey] != tt.wantText {
+				t.Errorf("Notify() payload = %v, want %s=%q", payload, tt.wantKey, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestWebhook_NotifyRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name:         "retry server errors",
+			statusCodes:  []int{http.StatusBadGateway, http.StatusOK},
+			wantRequests: 2,
+		},
+		{
+			name:         "client errors are permanent",
+			statusCodes:  []int{http.StatusNotFound, http.StatusOK},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:         "give up after retries",
+			statusCodes:  []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantErr:      true,
+			wantRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count := requests.Add(1)
+				w.WriteHeader(tt.statusCodes[count-1])
+			}))
+			defer server.Close()
+
+			webhook, err := NewWebhook(server.URL, WithRetries(1), WithHeaders(map[string]string{"Authorization": "Bearer token"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = webhook.Notify(context.Background(), Event{Type: IssueFailed, CommonName: "example.com", Error: "boom"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests.Load() != tt.wantRequests {
+				t.Errorf("Notify() requests = %d, want %d", requests.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestNewWebhook_InvalidTemplate(t *testing.T) {
+	_, err := NewWebhook("http://localhost", WithTemplate("{{ .Type "))
+	if err == nil || !strings.Contains(err.Error(), "template") {
+		t.Errorf("NewWebhook() error = %v, want template error", err)
+	}
+}
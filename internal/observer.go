@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+)
+
+// MetricsObserver updates the metrics according to the events of a PkiService.
+type MetricsObserver struct{}
+
+func (o *MetricsObserver) OnEvent(_ context.Context, event pki.Event) error {
+	switch e := event.(type) {
+	case pki.CertIssued:
+		UpdateCertificateMetrics(e.Result.IssuedCert)
+		MetricSuccess.WithLabelValues(e.CommonName).Set(1)
+		MetricCertRevoked.WithLabelValues(e.CommonName).Set(0)
+	case pki.RenewalSkipped:
+		UpdateCertificateMetrics(e.Result.ExistingCert)
+		MetricSuccess.WithLabelValues(e.CommonName).Set(1)
+		switch e.Result.Status {
+		case pkg.Vetoed:
+			MetricRenewalDeferred.WithLabelValues(e.CommonName, "veto").Inc()
+		case pkg.Delayed:
+			MetricRenewalDeferred.WithLabelValues(e.CommonName, "delay").Inc()
+		}
+	case pki.IssueFailed:
+		labels := prometheus.Labels{
+			MetricCertErrorsLabelCn:    e.CommonName,
+			MetricCertErrorsLabelError: TranslateErrToPromLabel(e.Err),
+		}
+		MetricCertErrors.With(labels).Inc()
+	case pki.CrlFetched:
+		if e.Err != nil {
+			MetricCrlErrors.WithLabelValues(string(e.Kind), TranslateErrToPromLabel(e.Err)).Inc()
+			if e.Result.ExistingCrl != nil {
+				UpdateCrlMetrics(e.Result.ExistingCrl, string(e.Kind))
+			}
+			return nil
+		}
+		UpdateCrlMetrics(e.Result.FetchedCrl, string(e.Kind))
+	}
+
+	return nil
+}
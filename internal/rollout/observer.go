@@ -0,0 +1,25 @@
+package rollout
+
+import (
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+)
+
+// Observer restarts the workloads after a new certificate has been issued.
+type Observer struct {
+	restarter *Restarter
+}
+
+func NewObserver(restarter *Restarter) *Observer {
+	return &Observer{
+		restarter: restarter,
+	}
+}
+
+func (o *Observer) OnEvent(ctx context.Context, event pki.Event) error {
+	if _, ok := event.(pki.CertIssued); !ok {
+		return nil
+	}
+
+	return o.restarter.Restart(ctx)
+}
@@ -0,0 +1,264 @@
+package rollout
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/context"
+	appsv1 "k8s.io/api/apps/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationRestartedAt is the annotation of the pod template that is also set by 'kubectl rollout restart'.
+	AnnotationRestartedAt = "kubectl.kubernetes.io/restartedAt"
+
+	DefaultTimeout      = 5 * time.Minute
+	defaultPollInterval = 2 * time.Second
+)
+
+// Restarter triggers a rolling restart of workloads, so their pods pick up the certificates that have been written to
+// Secrets and ConfigMaps.
+type Restarter struct {
+	client       kubernetes.Interface
+	targets      []Target
+	wait         bool
+	timeout      time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+type RestarterOpts func(*Restarter) error
+
+// WithWait waits for the rollout of all restarted workloads to finish, failing after the timeout has passed.
+func WithWait(timeout time.Duration) RestarterOpts {
+	return func(r *Restarter) error {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive, got %v", timeout)
+		}
+		r.wait = true
+		r.timeout = timeout
+		return nil
+	}
+}
+
+func WithPollInterval(interval time.Duration) RestarterOpts {
+	return func(r *Restarter) error {
+		if interval <= 0 {
+			return fmt.Errorf("poll interval must be positive, got %v", interval)
+		}
+		r.pollInterval = interval
+		return nil
+	}
+}
+
+func NewRestarter(client kubernetes.Interface, targets []Target, opts ...RestarterOpts) (*Restarter, error) {
+	if client == nil {
+		return nil, errors.New("nil kubernetes client provided")
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no targets provided")
+	}
+
+	ret := &Restarter{
+		client:       client,
+		targets:      targets,
+		timeout:      DefaultTimeout,
+		pollInterval: defaultPollInterval,
+		now:          time.Now,
+	}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return ret, nil
+}
+
+// Restart restarts all workloads denoted by the targets. A failing target does not prevent the other targets from
+// being restarted, all errors are returned.
+func (r *Restarter) Restart(ctx context.Context) error {
+	restartedAt := r.now().Format(time.RFC3339)
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, AnnotationRestartedAt, restartedAt))
+
+	var errs []error
+	var restarted []Target
+	for _, target := range r.targets {
+		names, err := r.resolve(ctx, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not resolve workloads of target '%s': %w", target, err))
+			continue
+		}
+
+		if len(names) == 0 {
+			log.Warn().Msgf("No workloads match rollout target '%s'", target)
+		}
+
+		for _, name := range names {
+			workload := Target{Kind: target.Kind, Namespace: target.Namespace, Name: name}
+			if err := r.patch(ctx, workload, patch); err != nil {
+				errs = append(errs, fmt.Errorf("could not restart %s: %w", workload, err))
+				continue
+			}
+			log.Info().Msgf("Restarted %s", workload)
+			restarted = append(restarted, workload)
+		}
+	}
+
+	if r.wait {
+		for _, workload := range restarted {
+			if err := r.waitForRollout(ctx, workload); err != nil {
+				errs = append(errs, fmt.Errorf("rollout of %s did not finish: %w", workload, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// resolve returns the names of the workloads denoted by the target.
+func (r *Restarter) resolve(ctx context.Context, target Target) ([]string, error) {
+	if len(target.Selector) == 0 {
+		return []string{target.Name}, nil
+	}
+
+	opts := meta.ListOptions{LabelSelector: target.Selector}
+	var names []string
+	switch target.Kind {
+	case KindDeployment:
+		list, err := r.client.AppsV1().Deployments(target.Namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			names = append(names, item.Name)
+		}
+	case KindStatefulSet:
+		list, err := r.client.AppsV1().StatefulSets(target.Namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			names = append(names, item.Name)
+		}
+	case KindDaemonSet:
+		list, err := r.client.AppsV1().DaemonSets(target.Namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			names = append(names, item.Name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind '%s'", target.Kind)
+	}
+
+	return names, nil
+}
+
+func (r *Restarter) patch(ctx context.Context, workload Target, patch []byte) error {
+	var err error
+	switch workload.Kind {
+	case KindDeployment:
+		_, err = r.client.AppsV1().Deployments(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, patch, meta.PatchOptions{})
+	case KindStatefulSet:
+		_, err = r.client.AppsV1().StatefulSets(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, patch, meta.PatchOptions{})
+	case KindDaemonSet:
+		_, err = r.client.AppsV1().DaemonSets(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, patch, meta.PatchOptions{})
+	default:
+		err = fmt.Errorf("unsupported kind '%s'", workload.Kind)
+	}
+	return err
+}
+
+func (r *Restarter) waitForRollout(ctx context.Context, workload Target) error {
+	return wait.PollUntilContextTimeout(ctx, r.pollInterval, r.timeout, true, func(ctx context.Context) (bool, error) {
+		return r.rolledOut(ctx, workload)
+	})
+}
+
+// rolledOut checks whether the rollout of the workload has finished, using the same conditions as
+// 'kubectl rollout status'.
+func (r *Restarter) rolledOut(ctx context.Context, workload Target) (bool, error) {
+	switch workload.Kind {
+	case KindDeployment:
+		deployment, err := r.client.AppsV1().Deployments(workload.Namespace).Get(ctx, workload.Name, meta.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return deploymentRolledOut(deployment), nil
+	case KindStatefulSet:
+		statefulSet, err := r.client.AppsV1().StatefulSets(workload.Namespace).Get(ctx, workload.Name, meta.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return statefulSetRolledOut(statefulSet), nil
+	case KindDaemonSet:
+		daemonSet, err := r.client.AppsV1().DaemonSets(workload.Namespace).Get(ctx, workload.Name, meta.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return daemonSetRolledOut(daemonSet), nil
+	default:
+		return false, fmt.Errorf("unsupported kind '%s'", workload.Kind)
+	}
+}
+
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.UpdatedReplicas >= replicas &&
+		deployment.Status.Replicas == deployment.Status.UpdatedReplicas &&
+		deployment.Status.AvailableReplicas >= deployment.Status.UpdatedReplicas
+}
+
+func statefulSetRolledOut(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	if statefulSet.Status.ReadyReplicas < replicas {
+		return false
+	}
+
+	// partitioned rolling updates only update a part of the pods
+	strategy := statefulSet.Spec.UpdateStrategy
+	if strategy.Type == appsv1.RollingUpdateStatefulSetStrategyType && strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil {
+		return statefulSet.Status.UpdatedReplicas >= replicas-*strategy.RollingUpdate.Partition
+	}
+
+	return statefulSet.Status.UpdateRevision == statefulSet.Status.CurrentRevision
+}
+
+func daemonSetRolledOut(daemonSet *appsv1.DaemonSet) bool {
+	if daemonSet.Status.ObservedGeneration < daemonSet.Generation {
+		return false
+	}
+
+	return daemonSet.Status.UpdatedNumberScheduled >= daemonSet.Status.DesiredNumberScheduled &&
+		daemonSet.Status.NumberAvailable >= daemonSet.Status.DesiredNumberScheduled
+}
@@ -0,0 +1,175 @@
+package rollout
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	appsv1 "k8s.io/api/apps/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		val     string
+		want    Target
+		wantErr bool
+	}{
+		{
+			name: "name",
+			val:  "deployment/default/web",
+			want: Target{Kind: KindDeployment, Namespace: "default", Name: "web"},
+		},
+		{
+			name: "alias",
+			val:  "sts/db/postgres",
+			want: Target{Kind: KindStatefulSet, Namespace: "db", Name: "postgres"},
+		},
+		{
+			name: "selector",
+			val:  "ds/kube-system?app=proxy,tier!=cache",
+			want: Target{Kind: KindDaemonSet, Namespace: "kube-system", Selector: "app=proxy,tier!=cache"},
+		},
+		{
+			name:    "unknown kind",
+			val:     "pod/default/web",
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			val:     "deployment/default",
+			wantErr: true,
+		},
+		{
+			name:    "empty namespace",
+			val:     "deployment//web",
+			wantErr: true,
+		},
+		{
+			name:    "invalid selector",
+			val:     "deployment/default?app==,",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTarget(tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseTarget() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func deployment(name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+	}
+}
+
+func restartedAt(t *testing.T, client *fake.Clientset, name string) string {
+	t.Helper()
+	deployment, err := client.AppsV1().Deployments("default").Get(context.Background(), name, meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deployment.Spec.Template.Annotations[AnnotationRestartedAt]
+}
+
+func TestRestarter_Restart(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		deployment("web", map[string]string{"app": "web"}),
+		deployment("api", map[string]string{"app": "web"}),
+		deployment("db", map[string]string{"app": "db"}),
+		&appsv1.StatefulSet{ObjectMeta: meta.ObjectMeta{Name: "cache", Namespace: "default"}},
+	)
+
+	targets := []Target{
+		{Kind: KindDeployment, Namespace: "default", Selector: "app=web"},
+		{Kind: KindStatefulSet, Namespace: "default", Name: "cache"},
+	}
+	restarter, err := NewRestarter(client, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	restarter.now = func() time.Time { return now }
+
+	if err := restarter.Restart(context.Background()); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+
+	want := now.Format(time.RFC3339)
+	for _, name := range []string{"web", "api"} {
+		if got := restartedAt(t, client, name); got != want {
+			t.Errorf("deployment %s restartedAt = %q, want %q", name, got, want)
+		}
+	}
+	if got := restartedAt(t, client, "db"); got != "" {
+		t.Errorf("deployment db should not have been restarted, restartedAt = %q", got)
+	}
+
+	statefulSet, err := client.AppsV1().StatefulSets("default").Get(context.Background(), "cache", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statefulSet.Spec.Template.Annotations[AnnotationRestartedAt]; got != want {
+		t.Errorf("statefulset restartedAt = %q, want %q", got, want)
+	}
+}
+
+func TestRestarter_RestartMissingWorkload(t *testing.T) {
+	client := fake.NewSimpleClientset(deployment("web", nil))
+
+	targets := []Target{
+		{Kind: KindDeployment, Namespace: "default", Name: "missing"},
+		{Kind: KindDeployment, Namespace: "default", Name: "web"},
+	}
+	restarter, err := NewRestarter(client, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restarter.Restart(context.Background()); err == nil {
+		t.Fatal("expected error restarting missing deployment")
+	}
+	if got := restartedAt(t, client, "web"); got == "" {
+		t.Error("deployment web should have been restarted regardless of the failing target")
+	}
+}
+
+func TestRestarter_Wait(t *testing.T) {
+	replicas := int32(2)
+	rolledOut := deployment("web", nil)
+	rolledOut.Spec.Replicas = &replicas
+	rolledOut.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+
+	stuck := deployment("api", nil)
+	stuck.Spec.Replicas = &replicas
+	stuck.Status = appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2}
+
+	client := fake.NewSimpleClientset(rolledOut, stuck)
+
+	restarter, err := NewRestarter(client, []Target{{Kind: KindDeployment, Namespace: "default", Name: "web"}},
+		WithWait(time.Second), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarter.Restart(context.Background()); err != nil {
+		t.Errorf("Restart() error = %v", err)
+	}
+
+	restarter, err = NewRestarter(client, []Target{{Kind: KindDeployment, Namespace: "default", Name: "api"}},
+		WithWait(50*time.Millisecond), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarter.Restart(context.Background()); err == nil {
+		t.Error("expected error waiting for stuck rollout")
+	}
+}
@@ -0,0 +1,78 @@
+package rollout
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	KindDeployment  = "deployment"
+	KindStatefulSet = "statefulset"
+	KindDaemonSet   = "daemonset"
+)
+
+var kindAliases = map[string]string{
+	"deployment":   KindDeployment,
+	"deployments":  KindDeployment,
+	"deploy":       KindDeployment,
+	"statefulset":  KindStatefulSet,
+	"statefulsets": KindStatefulSet,
+	"sts":          KindStatefulSet,
+	"daemonset":    KindDaemonSet,
+	"daemonsets":   KindDaemonSet,
+	"ds":           KindDaemonSet,
+}
+
+// Target denotes the workloads to restart, either a single workload identified by its name or all workloads of the
+// kind in the namespace that match the label selector.
+type Target struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Selector  string
+}
+
+// ParseTarget parses targets of the form 'kind/namespace/name' or 'kind/namespace?selector', e.g.
+// 'deployment/default/web' or 'sts/default?app=db,tier!=cache'.
+func ParseTarget(val string) (Target, error) {
+	ret := Target{}
+
+	path, selector, hasSelector := strings.Cut(val, "?")
+	split := strings.Split(path, "/")
+	if hasSelector {
+		if len(split) != 2 {
+			return ret, fmt.Errorf("invalid target '%s', expected 'kind/namespace?selector'", val)
+		}
+		if _, err := labels.Parse(selector); err != nil || len(selector) == 0 {
+			return ret, fmt.Errorf("invalid label selector in target '%s': %v", val, err)
+		}
+		ret.Selector = selector
+	} else {
+		if len(split) != 3 || len(split[2]) == 0 {
+			return ret, fmt.Errorf("invalid target '%s', expected 'kind/namespace/name'", val)
+		}
+		ret.Name = split[2]
+	}
+
+	kind, ok := kindAliases[strings.ToLower(split[0])]
+	if !ok {
+		return ret, fmt.Errorf("invalid target '%s', unsupported kind '%s'", val, split[0])
+	}
+	ret.Kind = kind
+
+	if len(split[1]) == 0 {
+		return ret, fmt.Errorf("invalid target '%s', empty namespace", val)
+	}
+	ret.Namespace = split[1]
+
+	return ret, nil
+}
+
+func (t Target) String() string {
+	if len(t.Selector) > 0 {
+		return t.Kind + "/" + t.Namespace + "?" + t.Selector
+	}
+	return t.Kind + "/" + t.Namespace + "/" + t.Name
+}
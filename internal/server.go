@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/multierr"
+)
+
+type metricsServer struct {
+	mux         *http.ServeMux
+	listener    net.Listener
+	tlsCertFile string
+	tlsKeyFile  string
+}
+
+type MetricsServerOpts func(*metricsServer) error
+
+// WithHandler registers an additional handler next to '/metrics'.
+func WithHandler(pattern string, handler http.Handler) MetricsServerOpts {
+	return func(s *metricsServer) error {
+		if handler == nil {
+			return fmt.Errorf("nil handler for pattern '%s'", pattern)
+		}
+		s.mux.Handle(pattern, handler)
+		return nil
+	}
+}
+
+// WithListener serves on the given listener instead of listening on the address, e.g. a socket passed by systemd.
+func WithListener(listener net.Listener) MetricsServerOpts {
+	return func(s *metricsServer) error {
+		if listener == nil {
+			return errors.New("nil listener provided")
+		}
+		s.listener = listener
+		return nil
+	}
+}
+
+// WithTls serves via TLS. The key pair is read on each handshake so renewed certificates are picked up without
+// restarting the server.
+func WithTls(certFile, keyFile string) MetricsServerOpts {
+	return func(s *metricsServer) error {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			return errors.New("both certificate and key file must be provided")
+		}
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+		return nil
+	}
+}
+
+func (s *metricsServer) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(s.tlsCertFile, s.tlsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load key pair: %w", err)
+	}
+	return &cert, nil
+}
+
+func StartMetricsServer(addr string, opts ...MetricsServerOpts) error {
+	s := &metricsServer{
+		mux: http.NewServeMux(),
+	}
+	s.mux.Handle("/metrics", promhttp.Handler())
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	server := http.Server{
+		Addr:              addr,
+		Handler:           s.mux,
+		ReadTimeout:       3 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		ReadHeaderTimeout: 3 * time.Second,
+		IdleTimeout:       90 * time.Second,
+	}
+
+	listener := s.listener
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if len(s.tlsCertFile) > 0 {
+		// fail early instead of on the first handshake
+		if _, err := s.getCertificate(nil); err != nil {
+			_ = listener.Close()
+			return err
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.getCertificate,
+		}
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
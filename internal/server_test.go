@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestStartMetricsServer_WithListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	go func() {
+		_ = StartMetricsServer("", WithListener(listener), WithHandler("/healthz", handler))
+	}()
+
+	for _, path := range []string{"/metrics", "/healthz"} {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %s to return %d, got %d", path, http.StatusOK, resp.StatusCode)
+		}
+	}
+}
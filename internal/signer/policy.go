@@ -0,0 +1,119 @@
+package signer
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+)
+
+// Policy decides whether a CertificateSigningRequest may be signed. Empty lists do not restrict the request.
+type Policy struct {
+	// AllowedUsages contains all usages a CSR may request.
+	AllowedUsages []certificatesv1.KeyUsage
+	// AllowedNames contains glob patterns the common name and all SANs of the CSR must match. Patterns are matched label
+	// by label (see path.Match), so '*.example.com' matches 'app.example.com' but neither 'example.com' nor
+	// 'a.app.example.com'.
+	AllowedNames []string
+	// AllowedRequesters contains glob patterns (see path.Match) the user that created the CSR must match, e.g.
+	// 'system:serviceaccount:my-namespace:*'.
+	AllowedRequesters []string
+}
+
+// DefaultAllowedUsages are the usages of TLS server and client certificates.
+var DefaultAllowedUsages = []certificatesv1.KeyUsage{
+	certificatesv1.UsageDigitalSignature,
+	certificatesv1.UsageKeyEncipherment,
+	certificatesv1.UsageServerAuth,
+	certificatesv1.UsageClientAuth,
+}
+
+// Validate checks the glob patterns of the policy.
+func (p *Policy) Validate() error {
+	var errs []error
+	for _, pattern := range append(slices.Clone(p.AllowedNames), p.AllowedRequesters...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern '%s': %w", pattern, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check returns an error describing all violations of the policy.
+func (p *Policy) Check(csr *certificatesv1.CertificateSigningRequest, req *x509.CertificateRequest) error {
+	var errs []error
+
+	if len(p.AllowedRequesters) > 0 && !matchesAny(p.AllowedRequesters, csr.Spec.Username) {
+		errs = append(errs, fmt.Errorf("requester '%s' is not allowed", csr.Spec.Username))
+	}
+
+	if len(p.AllowedUsages) > 0 {
+		for _, usage := range csr.Spec.Usages {
+			if !slices.Contains(p.AllowedUsages, usage) {
+				errs = append(errs, fmt.Errorf("usage '%s' is not allowed", usage))
+			}
+		}
+	}
+
+	if len(p.AllowedNames) > 0 {
+		for _, name := range requestedNames(req) {
+			if !matchesAnyName(p.AllowedNames, name) {
+				errs = append(errs, fmt.Errorf("name '%s' is not allowed", name))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func requestedNames(req *x509.CertificateRequest) []string {
+	var ret []string
+	if len(req.Subject.CommonName) > 0 {
+		ret = append(ret, req.Subject.CommonName)
+	}
+	ret = append(ret, req.DNSNames...)
+	ret = append(ret, req.EmailAddresses...)
+	for _, ip := range req.IPAddresses {
+		ret = append(ret, ip.String())
+	}
+	for _, uri := range req.URIs {
+		ret = append(ret, uri.String())
+	}
+	return ret
+}
+
+func matchesAny(patterns []string, val string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, val); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyName matches the name against the patterns label by label, so a wildcard never spans multiple labels.
+func matchesAnyName(patterns []string, name string) bool {
+	labels := strings.Split(name, ".")
+	for _, pattern := range patterns {
+		if matchesLabels(strings.Split(pattern, "."), labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesLabels(patterns, labels []string) bool {
+	if len(patterns) != len(labels) {
+		return false
+	}
+	for i := range patterns {
+		if ok, _ := path.Match(patterns[i], labels[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,508 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	DefaultWorkers = 2
+
+	ReasonApproved         = "VaultPkiCliApproved"
+	ReasonDenied           = "VaultPkiCliDenied"
+	ReasonInvalidRequest   = "InvalidRequest"
+	ReasonPolicyViolation  = "PolicyViolation"
+	EventReasonSigned      = "Signed"
+	EventReasonSignFailed  = "SignFailed"
+	EventReasonCsrRejected = "Rejected"
+
+	eventComponent = "vault-pki-cli"
+)
+
+// Signer signs CertificateSigningRequests of the certificates.k8s.io API that are addressed to its signer name
+// using Vault.
+type Signer struct {
+	client      kubernetes.Interface
+	service     *pki.PkiService
+	signerName  string
+	policy      Policy
+	autoApprove bool
+	workers     int
+	isLeader    func() bool
+
+	recorder    record.EventRecorder
+	broadcaster record.EventBroadcaster
+	factory     informers.SharedInformerFactory
+	informer    cache.SharedIndexInformer
+	queue       workqueue.RateLimitingInterface
+
+	// signed keeps signatures that could not be written to their CSR yet, so a retry does not sign again
+	signed      map[types.UID]*csrStorage
+	signedMutex sync.Mutex
+}
+
+type SignerOpts func(*Signer) error
+
+func WithPolicy(policy Policy) SignerOpts {
+	return func(s *Signer) error {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		s.policy = policy
+		return nil
+	}
+}
+
+// WithAutoApprove approves pending CSRs that comply with the policy and denies all others. By default, CSRs need to
+// be approved by someone else before they are signed.
+func WithAutoApprove(autoApprove bool) SignerOpts {
+	return func(s *Signer) error {
+		s.autoApprove = autoApprove
+		return nil
+	}
+}
+
+func WithWorkers(workers int) SignerOpts {
+	return func(s *Signer) error {
+		if workers < 1 {
+			return fmt.Errorf("invalid number of workers %d", workers)
+		}
+		s.workers = workers
+		return nil
+	}
+}
+
+// WithLeaderCheck only handles CSRs while the check returns true. Call Resync after becoming the leader.
+func WithLeaderCheck(isLeader func() bool) SignerOpts {
+	return func(s *Signer) error {
+		if isLeader == nil {
+			return errors.New("nil leader check provided")
+		}
+		s.isLeader = isLeader
+		return nil
+	}
+}
+
+// WithRecorder replaces the recorder that emits Kubernetes Events.
+func WithRecorder(recorder record.EventRecorder) SignerOpts {
+	return func(s *Signer) error {
+		if recorder == nil {
+			return errors.New("nil recorder provided")
+		}
+		s.recorder = recorder
+		return nil
+	}
+}
+
+func NewSigner(client kubernetes.Interface, service *pki.PkiService, signerName string, opts ...SignerOpts) (*Signer, error) {
+	if client == nil {
+		return nil, errors.New("nil kubernetes client provided")
+	}
+
+	if service == nil {
+		return nil, errors.New("nil pki service provided")
+	}
+
+	if len(signerName) == 0 {
+		return nil, errors.New("empty signer name provided")
+	}
+
+	ret := &Signer{
+		client:     client,
+		service:    service,
+		signerName: signerName,
+		workers:    DefaultWorkers,
+		queue:      workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		signed:     map[types.UID]*csrStorage{},
+	}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if ret.recorder == nil {
+		ret.broadcaster = record.NewBroadcaster()
+		ret.recorder = ret.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+	}
+
+	ret.factory = informers.NewSharedInformerFactory(client, 0)
+	ret.informer = ret.factory.Certificates().V1().CertificateSigningRequests().Informer()
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: ret.enqueue,
+		UpdateFunc: func(_, newObj any) {
+			ret.enqueue(newObj)
+		},
+	}
+	if _, err := ret.informer.AddEventHandler(handler); err != nil {
+		return nil, fmt.Errorf("could not add event handler: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (s *Signer) enqueue(obj any) {
+	csr, ok := obj.(*certificatesv1.CertificateSigningRequest)
+	if !ok || csr.Spec.SignerName != s.signerName || isFinished(csr) {
+		return
+	}
+
+	s.queue.Add(csr.Name)
+}
+
+// Resync enqueues all pending CSRs, e.g. after becoming the leader.
+func (s *Signer) Resync() {
+	for _, obj := range s.informer.GetStore().List() {
+		s.enqueue(obj)
+	}
+}
+
+// Run watches CSRs and signs them until the context is canceled.
+func (s *Signer) Run(ctx context.Context) error {
+	if s.broadcaster != nil {
+		s.broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: s.client.CoreV1().Events("")})
+		defer s.broadcaster.Shutdown()
+	}
+
+	s.factory.Start(ctx.Done())
+	defer s.factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), s.informer.HasSynced) {
+		s.queue.ShutDown()
+		return errors.New("could not sync caches")
+	}
+
+	log.Info().Msgf("Signing CSRs for signer '%s'", s.signerName)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s.processNextItem(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	s.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+func (s *Signer) processNextItem(ctx context.Context) bool {
+	item, shutdown := s.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer s.queue.Done(item)
+
+	name := item.(string)
+	if err := s.Reconcile(ctx, name); err != nil {
+		log.Error().Err(err).Str("csr", name).Msg("Handling CSR failed, retrying")
+		s.queue.AddRateLimited(name)
+		return true
+	}
+
+	s.queue.Forget(name)
+	return true
+}
+
+// Reconcile approves or denies the CSR with the given name if configured and signs it once it is approved.
+func (s *Signer) Reconcile(ctx context.Context, name string) error {
+	if s.isLeader != nil && !s.isLeader() {
+		log.Debug().Str("csr", name).Msg("Not the leader, skipping CSR")
+		return nil
+	}
+
+	obj, exists, err := s.informer.GetStore().GetByKey(name)
+	if err != nil || !exists {
+		return err
+	}
+	csr := obj.(*certificatesv1.CertificateSigningRequest)
+	if csr.Spec.SignerName != s.signerName || isFinished(csr) {
+		return nil
+	}
+
+	// the cache may lag behind our own updates, make sure not to sign the same CSR twice
+	uid := csr.UID
+	csr, err = s.client.CertificatesV1().CertificateSigningRequests().Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		s.forgetSignature(uid)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get csr '%s': %w", name, err)
+	}
+	if isFinished(csr) {
+		s.forgetSignature(csr.UID)
+		return nil
+	}
+
+	req, err := parseRequest(csr.Spec.Request)
+	if err != nil {
+		return s.fail(ctx, csr, ReasonInvalidRequest, err)
+	}
+
+	policyErr := s.policy.Check(csr, req)
+	if !isApproved(csr) {
+		if !s.autoApprove {
+			return nil
+		}
+		if policyErr != nil {
+			return s.deny(ctx, csr, policyErr)
+		}
+		if csr, err = s.approve(ctx, csr); err != nil {
+			return err
+		}
+	} else if policyErr != nil {
+		return s.fail(ctx, csr, ReasonPolicyViolation, policyErr)
+	}
+
+	return s.sign(ctx, csr, req)
+}
+
+func (s *Signer) sign(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, req *x509.CertificateRequest) error {
+	storage, ok := s.signature(csr.UID)
+	if !ok {
+		storage = &csrStorage{csr: csr.Spec.Request}
+		if err := s.service.Sign(ctx, storage, signatureArgs(csr, req)); err != nil {
+			s.recorder.Event(csr, corev1.EventTypeWarning, EventReasonSignFailed, err.Error())
+			return err
+		}
+		s.keepSignature(csr.UID, storage)
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := s.client.CertificatesV1().CertificateSigningRequests().Get(ctx, csr.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if current.UID != csr.UID || isFinished(current) {
+			return nil
+		}
+		current.Status.Certificate = storage.certificate()
+		_, err = s.client.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		// keep the signature, the retry only writes it to the csr
+		return fmt.Errorf("could not write certificate to csr '%s': %w", csr.Name, err)
+	}
+	s.forgetSignature(csr.UID)
+
+	log.Info().Str("csr", csr.Name).Msgf("Signed CSR, serial %s", storage.signature.Serial)
+	s.recorder.Eventf(csr, corev1.EventTypeNormal, EventReasonSigned, "Signed certificate with serial %s", storage.signature.Serial)
+	return nil
+}
+
+func (s *Signer) signature(uid types.UID) (*csrStorage, bool) {
+	s.signedMutex.Lock()
+	defer s.signedMutex.Unlock()
+	storage, ok := s.signed[uid]
+	return storage, ok
+}
+
+func (s *Signer) keepSignature(uid types.UID, storage *csrStorage) {
+	s.signedMutex.Lock()
+	defer s.signedMutex.Unlock()
+	s.signed[uid] = storage
+}
+
+func (s *Signer) forgetSignature(uid types.UID) {
+	s.signedMutex.Lock()
+	defer s.signedMutex.Unlock()
+	delete(s.signed, uid)
+}
+
+func (s *Signer) approve(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (*certificatesv1.CertificateSigningRequest, error) {
+	updated := csr.DeepCopy()
+	updated.Status.Conditions = append(updated.Status.Conditions, condition(certificatesv1.CertificateApproved, ReasonApproved, "Complies with the policy of the signer"))
+	ret, err := s.client.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not approve csr '%s': %w", csr.Name, err)
+	}
+
+	log.Info().Str("csr", csr.Name).Msg("Approved CSR")
+	return ret, nil
+}
+
+func (s *Signer) deny(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, reason error) error {
+	updated := csr.DeepCopy()
+	updated.Status.Conditions = append(updated.Status.Conditions, condition(certificatesv1.CertificateDenied, ReasonDenied, reason.Error()))
+	if _, err := s.client.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not deny csr '%s': %w", csr.Name, err)
+	}
+
+	log.Warn().Str("csr", csr.Name).Err(reason).Msg("Denied CSR")
+	s.recorder.Event(csr, corev1.EventTypeWarning, EventReasonCsrRejected, reason.Error())
+	return nil
+}
+
+// fail marks the CSR as failed, it will not be signed anymore.
+func (s *Signer) fail(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, reason string, cause error) error {
+	updated := csr.DeepCopy()
+	updated.Status.Conditions = append(updated.Status.Conditions, condition(certificatesv1.CertificateFailed, reason, cause.Error()))
+	if _, err := s.client.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not mark csr '%s' as failed: %w", csr.Name, err)
+	}
+
+	log.Warn().Str("csr", csr.Name).Err(cause).Msg("Refusing to sign CSR")
+	s.recorder.Event(csr, corev1.EventTypeWarning, EventReasonCsrRejected, cause.Error())
+	return nil
+}
+
+func condition(conditionType certificatesv1.RequestConditionType, reason, message string) certificatesv1.CertificateSigningRequestCondition {
+	now := metav1.NewTime(time.Now())
+	return certificatesv1.CertificateSigningRequestCondition{
+		Type:               conditionType,
+		Status:             corev1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+	}
+}
+
+func hasCondition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == conditionType && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func isApproved(csr *certificatesv1.CertificateSigningRequest) bool {
+	return hasCondition(csr, certificatesv1.CertificateApproved)
+}
+
+// isFinished returns whether the CSR has been signed, denied or has failed.
+func isFinished(csr *certificatesv1.CertificateSigningRequest) bool {
+	return len(csr.Status.Certificate) > 0 ||
+		hasCondition(csr, certificatesv1.CertificateDenied) ||
+		hasCondition(csr, certificatesv1.CertificateFailed)
+}
+
+func parseRequest(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("request does not contain a PEM encoded certificate request")
+	}
+
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse certificate request: %w", err)
+	}
+
+	if err := req.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid signature of certificate request: %w", err)
+	}
+
+	return req, nil
+}
+
+func signatureArgs(csr *certificatesv1.CertificateSigningRequest, req *x509.CertificateRequest) pkg.SignatureArgs {
+	args := pkg.SignatureArgs{
+		CommonName: req.Subject.CommonName,
+		AltNames:   append(append([]string{}, req.DNSNames...), req.EmailAddresses...),
+	}
+	for _, ip := range req.IPAddresses {
+		args.IpSans = append(args.IpSans, ip.String())
+	}
+	if csr.Spec.ExpirationSeconds != nil {
+		args.Ttl = fmt.Sprintf("%ds", *csr.Spec.ExpirationSeconds)
+	}
+	for _, usage := range csr.Spec.Usages {
+		if keyUsage, ok := keyUsages[usage]; ok {
+			args.KeyUsages = append(args.KeyUsages, keyUsage)
+		}
+		if extKeyUsage, ok := extKeyUsages[usage]; ok {
+			args.ExtKeyUsages = append(args.ExtKeyUsages, extKeyUsage)
+		}
+	}
+	return args
+}
+
+// keyUsages maps the usages of a CSR to the key usages of Vault.
+var keyUsages = map[certificatesv1.KeyUsage]string{
+	certificatesv1.UsageDigitalSignature:  "DigitalSignature",
+	certificatesv1.UsageContentCommitment: "ContentCommitment",
+	certificatesv1.UsageKeyEncipherment:   "KeyEncipherment",
+	certificatesv1.UsageKeyAgreement:      "KeyAgreement",
+	certificatesv1.UsageDataEncipherment:  "DataEncipherment",
+	certificatesv1.UsageCertSign:          "CertSign",
+	certificatesv1.UsageCRLSign:           "CRLSign",
+	certificatesv1.UsageEncipherOnly:      "EncipherOnly",
+	certificatesv1.UsageDecipherOnly:      "DecipherOnly",
+}
+
+// extKeyUsages maps the usages of a CSR to the extended key usages of Vault.
+var extKeyUsages = map[certificatesv1.KeyUsage]string{
+	certificatesv1.UsageAny:             "Any",
+	certificatesv1.UsageServerAuth:      "ServerAuth",
+	certificatesv1.UsageClientAuth:      "ClientAuth",
+	certificatesv1.UsageCodeSigning:     "CodeSigning",
+	certificatesv1.UsageEmailProtection: "EmailProtection",
+	certificatesv1.UsageSMIME:           "EmailProtection",
+	certificatesv1.UsageIPsecEndSystem:  "IPSECEndSystem",
+	certificatesv1.UsageIPsecTunnel:     "IPSECTunnel",
+	certificatesv1.UsageIPsecUser:       "IPSECUser",
+	certificatesv1.UsageTimestamping:    "TimeStamping",
+	certificatesv1.UsageOCSPSigning:     "OCSPSigning",
+	certificatesv1.UsageMicrosoftSGC:    "MicrosoftServerGatedCrypto",
+	certificatesv1.UsageNetscapeSGC:     "NetscapeServerGatedCrypto",
+}
+
+// csrStorage passes the request of a CSR object to the PkiService and keeps the signature in memory.
+type csrStorage struct {
+	csr       []byte
+	signature *pkg.Signature
+}
+
+func (s *csrStorage) ReadCsr() ([]byte, error) {
+	return s.csr, nil
+}
+
+func (s *csrStorage) WriteSignature(signature *pkg.Signature) error {
+	s.signature = signature
+	return nil
+}
+
+// certificate returns the signed certificate followed by the issuing CA.
+func (s *csrStorage) certificate() []byte {
+	data := append([]byte{}, s.signature.Certificate...)
+	if s.signature.HasCaData() {
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		data = append(data, s.signature.CaData...)
+	}
+	return data
+}
@@ -0,0 +1,291 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+const signerName = "example.com/vault"
+
+// buildPkiClient returns a client that answers all sign requests with a self-signed certificate.
+func buildPkiClient(t *testing.T) *testutil.PkiClientMock {
+	t.Helper()
+	cert := testutil.NewCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "app.apps.svc"}}, nil).CertPem()
+	return &testutil.PkiClientMock{Signature: &pkg.Signature{Certificate: cert, CaData: cert, Serial: "01"}}
+}
+
+func buildCsr(t *testing.T, name, commonName string, dnsNames ...string) *certificatesv1.CertificateSigningRequest {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			SignerName: signerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth},
+			Username:   "system:serviceaccount:apps:app",
+		},
+	}
+}
+
+func buildSigner(t *testing.T, ctx context.Context, client *fake.Clientset, pkiClient *testutil.PkiClientMock, opts ...SignerOpts) *Signer {
+	t.Helper()
+
+	service, err := pki.NewPkiService(pkiClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts = append(opts, WithRecorder(record.NewFakeRecorder(10)))
+	signer, err := NewSigner(client, service, signerName, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer.factory.Start(ctx.Done())
+	signer.factory.WaitForCacheSync(ctx.Done())
+	return signer
+}
+
+func getCsr(t *testing.T, ctx context.Context, client *fake.Clientset, name string) *certificatesv1.CertificateSigningRequest {
+	t.Helper()
+
+	csr, err := client.CertificatesV1().CertificateSigningRequests().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+var testPolicy = Policy{
+	AllowedUsages:     DefaultAllowedUsages,
+	AllowedNames:      []string{"*.apps.svc"},
+	AllowedRequesters: []string{"system:serviceaccount:apps:*"},
+}
+
+func TestSigner_AutoApprove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := buildPkiClient(t)
+	client := fake.NewSimpleClientset(buildCsr(t, "app", "app.apps.svc", "www.apps.svc"))
+	signer := buildSigner(t, ctx, client, pkiClient, WithPolicy(testPolicy), WithAutoApprove(true))
+
+	if err := signer.Reconcile(ctx, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	csr := getCsr(t, ctx, client, "app")
+	if !isApproved(csr) {
+		t.Error("expected csr to be approved")
+	}
+	if len(csr.Status.Certificate) == 0 {
+		t.Fatal("expected certificate to be written")
+	}
+	if _, err := pkg.ParseCertPem(csr.Status.Certificate); err != nil {
+		t.Errorf("expected valid certificate: %v", err)
+	}
+	if len(pkiClient.SignArgs()) != 1 || pkiClient.SignArgs()[0].CommonName != "app.apps.svc" || pkiClient.SignArgs()[0].AltNames[0] != "www.apps.svc" {
+		t.Errorf("unexpected signature args %v", pkiClient.SignArgs())
+	}
+	if !slices.Equal(pkiClient.SignArgs()[0].KeyUsages, []string{"DigitalSignature"}) || !slices.Equal(pkiClient.SignArgs()[0].ExtKeyUsages, []string{"ServerAuth"}) {
+		t.Errorf("expected usages to be passed, got %v", pkiClient.SignArgs()[0])
+	}
+
+	// the csr has been signed already, nothing to do
+	if err := signer.Reconcile(ctx, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pkiClient.SignArgs()) != 1 {
+		t.Errorf("expected csr to be signed once, got %d", len(pkiClient.SignArgs()))
+	}
+}
+
+func TestSigner_StatusUpdateFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := buildPkiClient(t)
+	client := fake.NewSimpleClientset(buildCsr(t, "app", "app.apps.svc"))
+	failures := 0
+	client.PrependReactor("update", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "status" && failures == 0 {
+			failures++
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+	signer := buildSigner(t, ctx, client, pkiClient, WithPolicy(testPolicy), WithAutoApprove(true))
+
+	if err := signer.Reconcile(ctx, "app"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := signer.Reconcile(ctx, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(getCsr(t, ctx, client, "app").Status.Certificate) == 0 {
+		t.Error("expected certificate to be written")
+	}
+	if len(pkiClient.SignArgs()) != 1 {
+		t.Errorf("expected csr to be signed once, got %d", len(pkiClient.SignArgs()))
+	}
+}
+
+func TestSigner_AutoApproveDenied(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := buildPkiClient(t)
+	client := fake.NewSimpleClientset(buildCsr(t, "evil", "evil.kube-system.svc"))
+	signer := buildSigner(t, ctx, client, pkiClient, WithPolicy(testPolicy), WithAutoApprove(true))
+
+	if err := signer.Reconcile(ctx, "evil"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	csr := getCsr(t, ctx, client, "evil")
+	if !hasCondition(csr, certificatesv1.CertificateDenied) {
+		t.Error("expected csr to be denied")
+	}
+	if len(pkiClient.SignArgs()) != 0 || len(csr.Status.Certificate) > 0 {
+		t.Error("expected csr not to be signed")
+	}
+}
+
+func TestSigner_ManualApproval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := buildPkiClient(t)
+	client := fake.NewSimpleClientset(buildCsr(t, "app", "app.apps.svc"))
+	signer := buildSigner(t, ctx, client, pkiClient, WithPolicy(testPolicy))
+
+	if err := signer.Reconcile(ctx, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pkiClient.SignArgs()) != 0 || isApproved(getCsr(t, ctx, client, "app")) {
+		t.Fatal("expected pending csr to be left alone")
+	}
+
+	csr := getCsr(t, ctx, client, "app")
+	csr.Status.Conditions = append(csr.Status.Conditions, condition(certificatesv1.CertificateApproved, "AdminApproved", ""))
+	if _, err := client.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, "app", csr, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := signer.Reconcile(ctx, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(getCsr(t, ctx, client, "app").Status.Certificate) == 0 {
+		t.Error("expected approved csr to be signed")
+	}
+}
+
+func TestSigner_ApprovedPolicyViolation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkiClient := buildPkiClient(t)
+	csr := buildCsr(t, "app", "app.apps.svc")
+	csr.Spec.Usages = append(csr.Spec.Usages, certificatesv1.UsageCertSign)
+	csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{condition(certificatesv1.CertificateApproved, "AdminApproved", "")}
+	client := fake.NewSimpleClientset(csr)
+	signer := buildSigner(t, ctx, client, pkiClient, WithPolicy(testPolicy))
+
+	if err := signer.Reconcile(ctx, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	csr = getCsr(t, ctx, client, "app")
+	if !hasCondition(csr, certificatesv1.CertificateFailed) {
+		t.Error("expected csr to be marked as failed")
+	}
+	if len(pkiClient.SignArgs()) != 0 {
+		t.Error("expected csr not to be signed")
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		requester string
+		wantErr   bool
+	}{
+		{name: "no restrictions", policy: Policy{}, requester: "anyone"},
+		{name: "allowed", policy: testPolicy, requester: "system:serviceaccount:apps:app"},
+		{name: "requester not allowed", policy: testPolicy, requester: "system:serviceaccount:kube-system:app", wantErr: true},
+		{name: "name not allowed", policy: Policy{AllowedNames: []string{"*.other.svc"}}, requester: "anyone", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr := buildCsr(t, "app", "app.apps.svc")
+			csr.Spec.Username = tt.requester
+			req, err := parseRequest(csr.Spec.Request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.policy.Check(csr, req); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_matchesAnyName(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		val      string
+		want     bool
+	}{
+		{name: "exact", patterns: []string{"app.example.com"}, val: "app.example.com", want: true},
+		{name: "wildcard label", patterns: []string{"*.example.com"}, val: "app.example.com", want: true},
+		{name: "wildcard spans labels", patterns: []string{"*.example.com"}, val: "a.app.example.com", want: false},
+		{name: "wildcard matches apex", patterns: []string{"*.example.com"}, val: "example.com", want: false},
+		{name: "wildcard within label", patterns: []string{"app-*.example.com"}, val: "app-1.example.com", want: true},
+		{name: "wildcard suffix", patterns: []string{"app.*"}, val: "app.example.com", want: false},
+		{name: "ip", patterns: []string{"10.0.*.*"}, val: "10.0.1.2", want: true},
+		{name: "second pattern", patterns: []string{"*.example.org", "*.example.com"}, val: "app.example.com", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAnyName(tt.patterns, tt.val); got != tt.want {
+				t.Errorf("matchesAnyName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+type report struct {
+	Healthy      bool         `json:"healthy"`
+	Ready        bool         `json:"ready"`
+	Certificates []CertStatus `json:"certificates"`
+}
+
+// HealthzHandler reports whether the renewal loop is alive.
+func (t *Tracker) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeCheck(w, t.Alive())
+	})
+}
+
+// ReadyzHandler reports whether a valid certificate is available, according to the given check.
+func ReadyzHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeCheck(w, check())
+	})
+}
+
+// StatusHandler returns the status of all managed certificates as JSON.
+func (t *Tracker) StatusHandler(ready func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		ret := report{
+			Healthy:      t.Alive() == nil,
+			Ready:        ready == nil || ready() == nil,
+			Certificates: t.Certificates(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ret); err != nil {
+			log.Warn().Err(err).Msg("could not write status")
+		}
+	})
+}
+
+func writeCheck(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,201 @@
+package status
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+)
+
+// DefaultStallTimeout is the time a scheduled run may be overdue before the daemon is considered unhealthy. It
+// accounts for retries against Vault and the runtime of hooks.
+const DefaultStallTimeout = 15 * time.Minute
+
+const (
+	StatusIssued  = "issued"
+	StatusNoop    = "noop"
+	StatusVetoed  = "vetoed"
+	StatusDelayed = "delayed"
+	StatusFailed  = "failed"
+)
+
+// IssueStatusName returns the name of the outcome of an attempt to issue a certificate.
+func IssueStatusName(status pkg.IssueStatus) string {
+	switch status {
+	case pkg.Issued:
+		return StatusIssued
+	case pkg.Noop:
+		return StatusNoop
+	case pkg.Vetoed:
+		return StatusVetoed
+	case pkg.Delayed:
+		return StatusDelayed
+	default:
+		return StatusFailed
+	}
+}
+
+// CertStatus describes the state of a single managed certificate.
+type CertStatus struct {
+	CommonName  string     `json:"common_name"`
+	Serial      string     `json:"serial,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastStatus  string     `json:"last_status,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+}
+
+// Tracker keeps track of the managed certificates by observing the events of a PkiService and the schedule of the
+// daemon loop.
+type Tracker struct {
+	certs        map[string]*CertStatus
+	stallTimeout time.Duration
+	mutex        sync.Mutex
+}
+
+type TrackerOpts func(*Tracker) error
+
+func WithStallTimeout(timeout time.Duration) TrackerOpts {
+	return func(t *Tracker) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid stall timeout %v", timeout)
+		}
+		t.stallTimeout = timeout
+		return nil
+	}
+}
+
+func NewTracker(opts ...TrackerOpts) (*Tracker, error) {
+	ret := &Tracker{
+		certs:        map[string]*CertStatus{},
+		stallTimeout: DefaultStallTimeout,
+	}
+
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (t *Tracker) OnEvent(_ context.Context, event pki.Event) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch e := event.(type) {
+	case pki.CertIssued:
+		t.attempted(e.CommonName, StatusIssued, e.Result.IssuedCert, nil)
+	case pki.RenewalSkipped:
+		t.attempted(e.CommonName, IssueStatusName(e.Result.Status), e.Result.ExistingCert, nil)
+	case pki.IssueFailed:
+		cert := e.Result.IssuedCert
+		if cert == nil {
+			cert = e.Result.ExistingCert
+		}
+		t.attempted(e.CommonName, StatusFailed, cert, e.Err)
+	}
+
+	return nil
+}
+
+func (t *Tracker) attempted(commonName, status string, cert *x509.Certificate, err error) {
+	entry := t.get(commonName)
+	now := time.Now()
+	entry.LastAttempt = &now
+	entry.LastStatus = status
+	entry.LastError = ""
+	if err != nil {
+		entry.LastError = err.Error()
+	}
+
+	if cert != nil {
+		entry.Serial = pkg.FormatSerial(cert.SerialNumber)
+		notAfter := cert.NotAfter
+		entry.NotAfter = &notAfter
+	}
+}
+
+func (t *Tracker) get(commonName string) *CertStatus {
+	entry, ok := t.certs[commonName]
+	if !ok {
+		entry = &CertStatus{CommonName: commonName}
+		t.certs[commonName] = entry
+	}
+	return entry
+}
+
+// ScheduleNextRun records the next time the certificate is checked for renewal.
+func (t *Tracker) ScheduleNextRun(commonName string, next time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.get(commonName).NextRun = &next
+}
+
+// Remove stops tracking the certificate, e.g. if it is no longer managed after a config reload.
+func (t *Tracker) Remove(commonName string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.certs, commonName)
+}
+
+// Certificates returns the status of all managed certificates sorted by their common name.
+func (t *Tracker) Certificates() []CertStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ret := make([]CertStatus, 0, len(t.certs))
+	for _, entry := range t.certs {
+		ret = append(ret, *entry)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CommonName < ret[j].CommonName
+	})
+
+	return ret
+}
+
+// Alive returns an error if a scheduled run is overdue by more than the stall timeout, indicating a wedged loop.
+func (t *Tracker) Alive() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var errs []error
+	for _, entry := range t.certs {
+		if entry.NextRun != nil && time.Since(*entry.NextRun) > t.stallTimeout {
+			errs = append(errs, fmt.Errorf("run for '%s' overdue since %v", entry.CommonName, entry.NextRun.Format(time.RFC3339)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// StorageReadiness returns a check that succeeds if the storage contains a valid, non-expired certificate.
+func StorageReadiness(storage pki.IssueStorage) func() error {
+	return func() error {
+		cert, err := storage.ReadCert()
+		if err != nil {
+			return fmt.Errorf("could not read certificate: %w", err)
+		}
+		if cert == nil {
+			return pkg.ErrNoCertFound
+		}
+		if time.Now().Before(cert.NotBefore) {
+			return fmt.Errorf("certificate '%s' not valid before %v", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+		}
+		if pkg.IsCertExpired(*cert) {
+			return fmt.Errorf("certificate '%s' expired at %v", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,159 @@
+package status
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"golang.org/x/net/context"
+)
+
+type storageMock struct {
+	cert *x509.Certificate
+	err  error
+}
+
+func (m *storageMock) WriteCert(_ *pkg.CertData) error {
+	return nil
+}
+
+func (m *storageMock) ReadCert() (*x509.Certificate, error) {
+	return m.cert, m.err
+}
+
+func TestTracker_OnEvent(t *testing.T) {
+	tracker, err := NewTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := testutil.NewCertWithSerial(t, 1, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), nil).Cert
+	issued := testutil.NewCertWithSerial(t, 2, time.Now(), time.Now().Add(48*time.Hour), nil).Cert
+
+	ctx := context.Background()
+	_ = tracker.OnEvent(ctx, pki.IssueFailed{CommonName: "example.com", Result: pkg.IssueResult{ExistingCert: existing}, Err: pkg.ErrIssueCert})
+	certs := tracker.Certificates()
+	if len(certs) != 1 {
+		t.Fatalf("expected 1 cert, got %d", len(certs))
+	}
+	if certs[0].LastStatus != StatusFailed || certs[0].LastError == "" || certs[0].Serial != pkg.FormatSerial(existing.SerialNumber) {
+		t.Errorf("unexpected status after failure: %+v", certs[0])
+	}
+
+	_ = tracker.OnEvent(ctx, pki.CertIssued{CommonName: "example.com", Result: pkg.IssueResult{ExistingCert: existing, IssuedCert: issued, Status: pkg.Issued}})
+	certs = tracker.Certificates()
+	if certs[0].LastStatus != StatusIssued || certs[0].LastError != "" || certs[0].Serial != pkg.FormatSerial(issued.SerialNumber) {
+		t.Errorf("unexpected status after issuing: %+v", certs[0])
+	}
+	if certs[0].LastAttempt == nil || !certs[0].NotAfter.Equal(issued.NotAfter) {
+		t.Errorf("expected last attempt and expiry to be set: %+v", certs[0])
+	}
+
+	_ = tracker.OnEvent(ctx, pki.RenewalSkipped{CommonName: "example.com", Result: pkg.IssueResult{ExistingCert: issued, Status: pkg.Delayed}})
+	if status := tracker.Certificates()[0].LastStatus; status != StatusDelayed {
+		t.Errorf("expected status %s, got %s", StatusDelayed, status)
+	}
+}
+
+func TestTracker_Alive(t *testing.T) {
+	tracker, err := NewTracker(WithStallTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.Alive(); err != nil {
+		t.Errorf("expected tracker without schedule to be alive: %v", err)
+	}
+
+	tracker.ScheduleNextRun("example.com", time.Now().Add(-30*time.Second))
+	if err := tracker.Alive(); err != nil {
+		t.Errorf("expected run within stall timeout to be alive: %v", err)
+	}
+
+	tracker.ScheduleNextRun("example.com", time.Now().Add(-2*time.Minute))
+	if err := tracker.Alive(); err == nil {
+		t.Errorf("expected overdue run to be reported")
+	}
+
+	tracker.Remove("example.com")
+	if err := tracker.Alive(); err != nil || len(tracker.Certificates()) != 0 {
+		t.Errorf("expected removed certificate to be ignored: %v", err)
+	}
+}
+
+func TestStorageReadiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage *storageMock
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			storage: &storageMock{cert: testutil.NewCertWithSerial(t, 1, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), nil).Cert},
+		},
+		{
+			name:    "expired",
+			storage: &storageMock{cert: testutil.NewCertWithSerial(t, 1, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour), nil).Cert},
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			storage: &storageMock{cert: testutil.NewCertWithSerial(t, 1, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour), nil).Cert},
+			wantErr: true,
+		},
+		{
+			name:    "missing",
+			storage: &storageMock{err: pkg.ErrNoCertFound},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := StorageReadiness(tt.storage)()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StorageReadiness() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	tracker, err := NewTracker(WithStallTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.ScheduleNextRun("example.com", time.Now().Add(time.Hour))
+
+	notReady := func() error {
+		return errors.New("no cert")
+	}
+
+	recorder := httptest.NewRecorder()
+	tracker.HealthzHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected healthz to return %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	ReadyzHandler(notReady).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readyz to return %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	tracker.StatusHandler(notReady).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var got report
+	if err := json.NewDecoder(recorder.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Healthy || got.Ready || len(got.Certificates) != 1 || got.Certificates[0].NextRun == nil {
+		t.Errorf("unexpected status report: %+v", got)
+	}
+}
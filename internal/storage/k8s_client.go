@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildKubernetesConfig builds the client config for the given kubeconfig context. If neither a kubeconfig nor a
+// context is given, the in-cluster config is used. Outside a cluster, the kubeconfig is looked up using the KUBECONFIG
+// env var and ~/.kube/config, just like kubectl does.
+func buildKubernetesConfig(config *conf.Config, kubeContext string) (*rest.Config, error) {
+	impersonate := rest.ImpersonationConfig{}
+	var kubeconfig string
+	if config != nil {
+		kubeconfig = config.KubeConfig
+		impersonate.UserName = config.KubeImpersonateUser
+		impersonate.Groups = config.KubeImpersonateGroups
+		if len(kubeContext) == 0 {
+			kubeContext = config.KubeContext
+		}
+	}
+
+	if len(kubeconfig) == 0 && len(kubeContext) == 0 {
+		restConfig, err := rest.InClusterConfig()
+		if err == nil {
+			restConfig.Impersonate = impersonate
+			return restConfig, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, err
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if len(kubeconfig) > 0 {
+		// multiple files are merged, just like the KUBECONFIG env var
+		rules.Precedence = filepath.SplitList(kubeconfig)
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	}
+	overrides.AuthInfo.Impersonate = impersonate.UserName
+	overrides.AuthInfo.ImpersonateGroups = impersonate.Groups
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
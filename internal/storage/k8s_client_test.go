@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com:6443
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: admin
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+current-context: dev
+`
+
+func TestBuildKubernetesConfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		config      *conf.Config
+		kubeContext string
+		wantHost    string
+		wantUser    string
+		wantGroups  []string
+	}{
+		{
+			name:     "current context",
+			config:   &conf.Config{KubeConfig: kubeconfig},
+			wantHost: "https://dev.example.com:6443",
+		},
+		{
+			name:     "configured context",
+			config:   &conf.Config{KubeConfig: kubeconfig, KubeContext: "prod"},
+			wantHost: "https://prod.example.com:6443",
+		},
+		{
+			name:        "context of uri takes precedence",
+			config:      &conf.Config{KubeConfig: kubeconfig, KubeContext: "dev"},
+			kubeContext: "prod",
+			wantHost:    "https://prod.example.com:6443",
+		},
+		{
+			name:       "impersonation",
+			config:     &conf.Config{KubeConfig: kubeconfig, KubeImpersonateUser: "deployer", KubeImpersonateGroups: []string{"ci"}},
+			wantHost:   "https://dev.example.com:6443",
+			wantUser:   "deployer",
+			wantGroups: []string{"ci"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildKubernetesConfig(tt.config, tt.kubeContext)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Host != tt.wantHost {
+				t.Errorf("expected host %s, got %s", tt.wantHost, got.Host)
+			}
+			if got.Impersonate.UserName != tt.wantUser {
+				t.Errorf("expected impersonated user '%s', got '%s'", tt.wantUser, got.Impersonate.UserName)
+			}
+			if len(tt.wantGroups) > 0 && !reflect.DeepEqual(got.Impersonate.Groups, tt.wantGroups) {
+				t.Errorf("expected impersonated groups %v, got %v", tt.wantGroups, got.Impersonate.Groups)
+			}
+		})
+	}
+}
+
+func TestBuildKubernetesConfig_UnknownContext(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buildKubernetesConfig(&conf.Config{KubeConfig: kubeconfig}, "staging"); err == nil {
+		t.Error("expected error for unknown context")
+	}
+}
@@ -16,7 +16,7 @@ const K8sConfigMapScheme = "k8s-cm"
 
 type K8sConfigmapStorage struct {
 	*K8sConfig
-	client *kubernetes.Clientset
+	client kubernetes.Interface
 }
 
 func NewK8sConfigmapStorageFromUri(uri string, context *buildContext) (*K8sConfigmapStorage, error) {
@@ -25,7 +25,7 @@ func NewK8sConfigmapStorageFromUri(uri string, context *buildContext) (*K8sConfi
 		return nil, err
 	}
 
-	client, err := context.KubernetesClient()
+	client, err := context.KubernetesClientForContext(conf.Context)
 	if err != nil {
 		return nil, fmt.Errorf("could not build kubernetes client: %v", err)
 	}
@@ -36,12 +36,12 @@ func NewK8sConfigmapStorageFromUri(uri string, context *buildContext) (*K8sConfi
 	}, nil
 }
 
-func NewK8sConfigmapStorage(client *kubernetes.Clientset, name string, opts ...K8sOption) (*K8sConfigmapStorage, error) {
+func NewK8sConfigmapStorage(client kubernetes.Interface, opts ...K8sOption) (*K8sConfigmapStorage, error) {
 	if client == nil {
 		return nil, errors.New("empty client provided")
 	}
 
-	k8sBackend := &K8sConfigmapStorage{}
+	k8sBackend := &K8sConfigmapStorage{K8sConfig: &K8sConfig{}}
 	k8sBackend.client = client
 	for _, opt := range opts {
 		opt(k8sBackend.K8sConfig)
@@ -54,14 +54,15 @@ func (fs *K8sConfigmapStorage) Read() ([]byte, error) {
 	configMap, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
-			return nil, pkg.ErrNoCertFound
+			return nil, fmt.Errorf("kubernetes configmap '%s' not found: %w", fs, pkg.ErrNoCertFound)
 		}
-		return nil, err
+		return nil, fmt.Errorf("could not read kubernetes configmap '%s': %w", fs, err)
 	}
 
-	cert, ok := configMap.Data[keyCert]
+	key := fs.keyOrDefault(keyCert)
+	cert, ok := configMap.Data[key]
 	if !ok {
-		return nil, fmt.Errorf("kubernetes configMap '%s' does not contain a certifcate", fs.Name)
+		return nil, fmt.Errorf("kubernetes configmap '%s' does not contain key '%s': %w", fs, key, pkg.ErrNoCertFound)
 	}
 
 	return []byte(cert), nil
@@ -71,34 +72,74 @@ func (fs *K8sConfigmapStorage) CanRead() error {
 	_, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
-			return pkg.ErrNoCertFound
+			return fmt.Errorf("kubernetes configmap '%s' not found: %w", fs, pkg.ErrNoCertFound)
 		}
-		return err
+		return fmt.Errorf("could not read kubernetes configmap '%s': %w", fs, err)
 	}
 
 	return nil
 }
 
 func (fs *K8sConfigmapStorage) Write(data []byte) error {
-	configmap := &v1.ConfigMap{
-		ObjectMeta: meta.ObjectMeta{
-			Name: fs.Name,
-			Labels: map[string]string{
-				"app": "k8s-cli-pki",
+	err := retryWrite(func() error {
+		existing, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
+		if err == nil {
+			// keep the metadata and other keys of existing objects, they may be managed by someone else
+			configmap := existing.DeepCopy()
+			if configmap.Data == nil {
+				configmap.Data = map[string]string{}
+			}
+			configmap.Data[fs.keyOrDefault(keyCert)] = string(data)
+			fs.applyMetadata(&configmap.ObjectMeta)
+			_, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Update(context.TODO(), configmap, meta.UpdateOptions{})
+			return err
+		}
+
+		if !k8sErrors.IsNotFound(err) {
+			return err
+		}
+
+		configmap := &v1.ConfigMap{
+			ObjectMeta: fs.newObjectMeta(),
+			Data: map[string]string{
+				fs.keyOrDefault(keyCert): string(data),
 			},
-		},
-		Data: map[string]string{
-			keyCert: string(data),
-		},
+		}
+		_, err = fs.client.CoreV1().ConfigMaps(fs.Namespace).Create(context.TODO(), configmap, meta.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write kubernetes configmap '%s': %w", fs, err)
 	}
 
-	if fs.CanRead() == nil {
-		_, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Update(context.TODO(), configmap, meta.UpdateOptions{})
+	return nil
+}
+
+// Clear removes the key from the configmap, the configmap itself and its other keys are kept.
+func (fs *K8sConfigmapStorage) Clear() error {
+	err := retryWrite(func() error {
+		existing, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		key := fs.keyOrDefault(keyCert)
+		if _, ok := existing.Data[key]; !ok {
+			return nil
+		}
+		configmap := existing.DeepCopy()
+		delete(configmap.Data, key)
+		_, err = fs.client.CoreV1().ConfigMaps(fs.Namespace).Update(context.TODO(), configmap, meta.UpdateOptions{})
 		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not clear kubernetes configmap '%s': %w", fs, err)
 	}
 
-	_, err := fs.client.CoreV1().ConfigMaps(fs.Namespace).Create(context.TODO(), configmap, meta.CreateOptions{})
-	return err
+	return nil
 }
 
 func (fs *K8sConfigmapStorage) CanWrite() error {
@@ -14,7 +14,7 @@ import (
 
 type K8sSecretStorage struct {
 	*K8sConfig
-	client *kubernetes.Clientset
+	client kubernetes.Interface
 }
 
 const K8sSecretMapScheme = "k8s-sec"
@@ -25,7 +25,7 @@ func NewK8sSecretStorageFromUri(uri string, context *buildContext) (*K8sSecretSt
 		return nil, err
 	}
 
-	client, err := context.KubernetesClient()
+	client, err := context.KubernetesClientForContext(conf.Context)
 	if err != nil {
 		return nil, fmt.Errorf("could not build kubernetes client: %v", err)
 	}
@@ -36,12 +36,12 @@ func NewK8sSecretStorageFromUri(uri string, context *buildContext) (*K8sSecretSt
 	}, nil
 }
 
-func NewK8sSecretStorage(client *kubernetes.Clientset, opts ...K8sOption) (*K8sSecretStorage, error) {
+func NewK8sSecretStorage(client kubernetes.Interface, opts ...K8sOption) (*K8sSecretStorage, error) {
 	if client == nil {
 		return nil, errors.New("empty client provided")
 	}
 
-	k8sBackend := &K8sSecretStorage{}
+	k8sBackend := &K8sSecretStorage{K8sConfig: &K8sConfig{}}
 	k8sBackend.client = client
 
 	for _, opt := range opts {
@@ -59,14 +59,15 @@ func (fs *K8sSecretStorage) Read() ([]byte, error) {
 	secret, err := fs.client.CoreV1().Secrets(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
-			return nil, pkg.ErrNoCertFound
+			return nil, fmt.Errorf("kubernetes secret '%s' not found: %w", fs, pkg.ErrNoCertFound)
 		}
-		return nil, err
+		return nil, fmt.Errorf("could not read kubernetes secret '%s': %w", fs, err)
 	}
 
-	cert, ok := secret.Data[keyPrivateKey]
+	key := fs.keyOrDefault(keyPrivateKey)
+	cert, ok := secret.Data[key]
 	if !ok {
-		return nil, fmt.Errorf("kubernetes secret '%s' does not contain a certifcate", fs.Name)
+		return nil, fmt.Errorf("kubernetes secret '%s' does not contain key '%s': %w", fs, key, pkg.ErrNoCertFound)
 	}
 
 	return cert, nil
@@ -80,9 +81,9 @@ func (fs *K8sSecretStorage) CanRead() error {
 	_, err := fs.client.CoreV1().Secrets(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
-			return pkg.ErrNoCertFound
+			return fmt.Errorf("kubernetes secret '%s' not found: %w", fs, pkg.ErrNoCertFound)
 		}
-		return err
+		return fmt.Errorf("could not read kubernetes secret '%s': %w", fs, err)
 	}
 
 	return nil
@@ -90,28 +91,72 @@ func (fs *K8sSecretStorage) CanRead() error {
 
 func (fs *K8sSecretStorage) Write(data []byte) error {
 	if fs.client == nil {
-		return errors.New("can't read secret, uninitialized k8s client")
+		return errors.New("can't write secret, uninitialized k8s client")
 	}
 
-	secret := &v1.Secret{
-		ObjectMeta: meta.ObjectMeta{
-			Name: fs.Name,
-			Labels: map[string]string{
-				"app": "k8s-cli-pki",
+	err := retryWrite(func() error {
+		existing, err := fs.client.CoreV1().Secrets(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
+		if err == nil {
+			// keep the metadata and other keys of existing objects, they may be managed by someone else
+			secret := existing.DeepCopy()
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[fs.keyOrDefault(keyPrivateKey)] = data
+			fs.applyMetadata(&secret.ObjectMeta)
+			_, err := fs.client.CoreV1().Secrets(fs.Namespace).Update(context.TODO(), secret, meta.UpdateOptions{})
+			return err
+		}
+
+		if !k8sErrors.IsNotFound(err) {
+			return err
+		}
+
+		secret := &v1.Secret{
+			ObjectMeta: fs.newObjectMeta(),
+			Data: map[string][]byte{
+				fs.keyOrDefault(keyPrivateKey): data,
 			},
-		},
-		StringData: map[string]string{
-			keyPrivateKey: string(data),
-		},
+		}
+		_, err = fs.client.CoreV1().Secrets(fs.Namespace).Create(context.TODO(), secret, meta.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write kubernetes secret '%s': %w", fs, err)
 	}
 
-	if fs.CanRead() == nil {
-		_, err := fs.client.CoreV1().Secrets(fs.Namespace).Update(context.TODO(), secret, meta.UpdateOptions{})
+	return nil
+}
+
+// Clear removes the key from the secret, the secret itself and its other keys are kept.
+func (fs *K8sSecretStorage) Clear() error {
+	if fs.client == nil {
+		return errors.New("can't write secret, uninitialized k8s client")
+	}
+
+	err := retryWrite(func() error {
+		existing, err := fs.client.CoreV1().Secrets(fs.Namespace).Get(context.TODO(), fs.Name, meta.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		key := fs.keyOrDefault(keyPrivateKey)
+		if _, ok := existing.Data[key]; !ok {
+			return nil
+		}
+		secret := existing.DeepCopy()
+		delete(secret.Data, key)
+		_, err = fs.client.CoreV1().Secrets(fs.Namespace).Update(context.TODO(), secret, meta.UpdateOptions{})
 		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not clear kubernetes secret '%s': %w", fs, err)
 	}
 
-	_, err := fs.client.CoreV1().Secrets(fs.Namespace).Create(context.TODO(), secret, meta.CreateOptions{})
-	return err
+	return nil
 }
 
 func (fs *K8sSecretStorage) CanWrite() error {
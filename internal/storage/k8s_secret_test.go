@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestK8sSecretStorage_WriteMerges(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: meta.ObjectMeta{
+			Name:        "name",
+			Namespace:   "namespace",
+			Labels:      map[string]string{"team": "a"},
+			Annotations: map[string]string{"foreign": "annotation"},
+		},
+		Data: map[string][]byte{
+			"foreign": []byte("data"),
+		},
+	})
+
+	owner := meta.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "1234"}
+	storage, err := NewK8sSecretStorage(client, WithNamespace("namespace"), WithName("name"), WithKey("tls.key"),
+		WithLabels(map[string]string{"env": "prod"}), WithOwnerReference(owner))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writing twice must not duplicate the owner reference
+	for i := 0; i < 2; i++ {
+		if err := storage.Write([]byte("key")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	secret, err := client.CoreV1().Secrets("namespace").Get(context.TODO(), "name", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantData := map[string][]byte{"foreign": []byte("data"), "tls.key": []byte("key")}
+	if !reflect.DeepEqual(secret.Data, wantData) {
+		t.Errorf("Data = %v, want %v", secret.Data, wantData)
+	}
+	wantLabels := map[string]string{"team": "a", "env": "prod"}
+	if !reflect.DeepEqual(secret.Labels, wantLabels) {
+		t.Errorf("Labels = %v, want %v", secret.Labels, wantLabels)
+	}
+	if secret.Annotations["foreign"] != "annotation" {
+		t.Errorf("foreign annotation has not been preserved")
+	}
+	if !reflect.DeepEqual(secret.OwnerReferences, []meta.OwnerReference{owner}) {
+		t.Errorf("OwnerReferences = %v, want %v", secret.OwnerReferences, []meta.OwnerReference{owner})
+	}
+
+	read, err := storage.Read()
+	if err != nil || string(read) != "key" {
+		t.Errorf("Read() = %q, %v", read, err)
+	}
+}
+
+func TestK8sSecretStorage_WriteCreates(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	storage, err := NewK8sSecretStorage(client, WithNamespace("namespace"), WithName("name"),
+		WithAnnotations(map[string]string{"a": "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.Read(); !errors.Is(err, pkg.ErrNoCertFound) {
+		t.Errorf("Read() error = %v, want %v", err, pkg.ErrNoCertFound)
+	}
+
+	if err := storage.Write([]byte("key")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("namespace").Get(context.TODO(), "name", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[keyPrivateKey]) != "key" {
+		t.Errorf("Data = %v", secret.Data)
+	}
+	if secret.Labels["app"] != "k8s-cli-pki" || secret.Annotations["a"] != "b" {
+		t.Errorf("unexpected metadata: %v, %v", secret.Labels, secret.Annotations)
+	}
+}
+
+func TestK8sSecretStorage_Clear(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: "name", Namespace: "namespace"},
+		Data: map[string][]byte{
+			"foreign": []byte("data"),
+			"tls.key": []byte("key"),
+		},
+	})
+	storage, err := NewK8sSecretStorage(client, WithNamespace("namespace"), WithName("name"), WithKey("tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if _, err := storage.Read(); !errors.Is(err, pkg.ErrNoCertFound) {
+		t.Errorf("Read() error = %v, want %v", err, pkg.ErrNoCertFound)
+	}
+
+	secret, err := client.CoreV1().Secrets("namespace").Get(context.TODO(), "name", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(secret.Data, map[string][]byte{"foreign": []byte("data")}) {
+		t.Errorf("expected only the key to be removed, got %v", secret.Data)
+	}
+
+	// clearing a missing secret is a no-op
+	storage, _ = NewK8sSecretStorage(client, WithNamespace("namespace"), WithName("missing"))
+	if err := storage.Clear(); err != nil {
+		t.Errorf("Clear() error = %v", err)
+	}
+}
+
+func TestK8sSecretStorage_WriteRetriesOnConflict(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: "name", Namespace: "namespace"},
+	})
+
+	conflicts := 2
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, k8sErrors.NewConflict(schema.GroupResource{Resource: "secrets"}, "name", errors.New("modified"))
+		}
+		return false, nil, nil
+	})
+
+	storage, err := NewK8sSecretStorage(client, WithNamespace("namespace"), WithName("name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Write([]byte("key")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if conflicts != 0 {
+		t.Errorf("expected all conflicts to be retried, %d left", conflicts)
+	}
+}
+
+func TestK8sSecretStorage_ErrorContainsName(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "name", errors.New("denied"))
+	})
+
+	storage, err := NewK8sSecretStorage(client, WithNamespace("namespace"), WithName("name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Write([]byte("key"))
+	if err == nil || !k8sErrors.IsForbidden(err) {
+		t.Fatalf("Write() error = %v, want forbidden", err)
+	}
+	if want := "could not write kubernetes secret 'namespace/name'"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Write() error = %q, want prefix %q", err.Error(), want)
+	}
+}
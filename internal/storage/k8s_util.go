@@ -2,13 +2,33 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"strings"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 )
 
+// defaultLabels are added to objects created by the storage implementations.
+var defaultLabels = map[string]string{
+	"app": "k8s-cli-pki",
+}
+
 type K8sConfig struct {
 	Namespace string
 	Name      string
+	// Key is the key inside the object's data the artifact is stored under. If empty, a default key is used.
+	Key string
+	// Context is the kubeconfig context of the cluster the object lives in. If empty, the default cluster is used.
+	Context string
+	// Labels and Annotations are merged into the existing metadata of the object on each write.
+	Labels      map[string]string
+	Annotations map[string]string
+	// OwnerReferences are added to the object on each write, unless an owner with the same uid is already present.
+	OwnerReferences []meta.OwnerReference
 }
 
 type K8sOption func(sink *K8sConfig)
@@ -25,6 +45,96 @@ func WithName(secretName string) K8sOption {
 	}
 }
 
+func WithKey(key string) K8sOption {
+	return func(h *K8sConfig) {
+		h.Key = key
+	}
+}
+
+func WithLabels(labels map[string]string) K8sOption {
+	return func(h *K8sConfig) {
+		h.Labels = labels
+	}
+}
+
+func WithAnnotations(annotations map[string]string) K8sOption {
+	return func(h *K8sConfig) {
+		h.Annotations = annotations
+	}
+}
+
+func WithOwnerReference(owner meta.OwnerReference) K8sOption {
+	return func(h *K8sConfig) {
+		h.OwnerReferences = append(h.OwnerReferences, owner)
+	}
+}
+
+func (c *K8sConfig) keyOrDefault(defaultKey string) string {
+	if len(c.Key) > 0 {
+		return c.Key
+	}
+	return defaultKey
+}
+
+// String returns the namespace and name of the object, used to identify it in errors.
+func (c *K8sConfig) String() string {
+	return c.Namespace + "/" + c.Name
+}
+
+// applyMetadata merges the configured labels, annotations and owner references into the metadata of the object.
+func (c *K8sConfig) applyMetadata(obj *meta.ObjectMeta) {
+	if len(c.Labels) > 0 && obj.Labels == nil {
+		obj.Labels = map[string]string{}
+	}
+	for key, val := range c.Labels {
+		obj.Labels[key] = val
+	}
+
+	if len(c.Annotations) > 0 && obj.Annotations == nil {
+		obj.Annotations = map[string]string{}
+	}
+	for key, val := range c.Annotations {
+		obj.Annotations[key] = val
+	}
+
+	for _, owner := range c.OwnerReferences {
+		exists := false
+		for _, existing := range obj.OwnerReferences {
+			if existing.UID == owner.UID {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			obj.OwnerReferences = append(obj.OwnerReferences, owner)
+		}
+	}
+}
+
+// newObjectMeta returns the metadata of an object that is about to be created.
+func (c *K8sConfig) newObjectMeta() meta.ObjectMeta {
+	ret := meta.ObjectMeta{
+		Name:      c.Name,
+		Namespace: c.Namespace,
+		Labels:    map[string]string{},
+	}
+	for key, val := range defaultLabels {
+		ret.Labels[key] = val
+	}
+	c.applyMetadata(&ret)
+	return ret
+}
+
+// retryWrite retries a read-modify-write cycle if the object has been modified or created concurrently.
+func retryWrite(write func() error) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return k8sErrors.IsConflict(err) || k8sErrors.IsAlreadyExists(err)
+	}, write)
+}
+
+// K8sConfigFromUri parses uris of the form 'scheme:///namespace/name'. The optional query parameters 'key', 'context',
+// 'label' and 'annotation' (both 'key=value', may be repeated) and 'owner' ('apiVersion:kind:name:uid', may be
+// repeated) configure the storage.
 func K8sConfigFromUri(uri string) (*K8sConfig, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -41,5 +151,60 @@ func K8sConfigFromUri(uri string) (*K8sConfig, error) {
 	impl.Namespace = split[1]
 	impl.Name = split[2]
 
-	return impl, err
+	query := parsed.Query()
+	impl.Key = query.Get("key")
+	impl.Context = query.Get("context")
+
+	if impl.Labels, err = parseKeyValues(query["label"]); err != nil {
+		return nil, fmt.Errorf("invalid label: %w", err)
+	}
+	if impl.Annotations, err = parseKeyValues(query["annotation"]); err != nil {
+		return nil, fmt.Errorf("invalid annotation: %w", err)
+	}
+
+	for _, val := range query["owner"] {
+		owner, err := parseOwnerReference(val)
+		if err != nil {
+			return nil, err
+		}
+		impl.OwnerReferences = append(impl.OwnerReferences, owner)
+	}
+
+	return impl, nil
+}
+
+func parseKeyValues(vals []string) (map[string]string, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	ret := map[string]string{}
+	for _, val := range vals {
+		key, value, found := strings.Cut(val, "=")
+		if !found || len(key) == 0 {
+			return nil, fmt.Errorf("expected 'key=value', got '%s'", val)
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+func parseOwnerReference(val string) (meta.OwnerReference, error) {
+	split := strings.Split(val, ":")
+	if len(split) != 4 {
+		return meta.OwnerReference{}, fmt.Errorf("invalid owner '%s', expected 'apiVersion:kind:name:uid'", val)
+	}
+
+	for _, part := range split {
+		if len(part) == 0 {
+			return meta.OwnerReference{}, fmt.Errorf("invalid owner '%s', expected 'apiVersion:kind:name:uid'", val)
+		}
+	}
+
+	return meta.OwnerReference{
+		APIVersion: split[0],
+		Kind:       split[1],
+		Name:       split[2],
+		UID:        types.UID(split[3]),
+	}, nil
 }
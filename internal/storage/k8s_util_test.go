@@ -3,6 +3,8 @@ package storage
 import (
 	"reflect"
 	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestK8sConfigFromUri(t *testing.T) {
@@ -21,6 +23,46 @@ func TestK8sConfigFromUri(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "context",
+			uri:  "k8s-sec:///namespace/name?context=prod",
+			want: &K8sConfig{
+				Namespace: "namespace",
+				Name:      "name",
+				Context:   "prod",
+			},
+			wantErr: false,
+		},
+		{
+			name: "metadata",
+			uri:  "k8s-sec:///namespace/name?key=tls.key&label=team=a&label=env=prod&annotation=owner=me&owner=apps/v1:Deployment:web:1234",
+			want: &K8sConfig{
+				Namespace: "namespace",
+				Name:      "name",
+				Key:       "tls.key",
+				Labels: map[string]string{
+					"team": "a",
+					"env":  "prod",
+				},
+				Annotations: map[string]string{
+					"owner": "me",
+				},
+				OwnerReferences: []meta.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "1234"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "invalid label",
+			uri:     "k8s-sec:///namespace/name?label=team",
+			wantErr: true,
+		},
+		{
+			name:    "invalid owner",
+			uri:     "k8s-sec:///namespace/name?owner=Deployment:web",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
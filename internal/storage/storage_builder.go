@@ -7,40 +7,73 @@ import (
 	"sync"
 
 	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/internal"
 	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
 	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
 	"github.com/soerenschneider/vault-pki-cli/pkg/storage/backend"
 	sink2 "github.com/soerenschneider/vault-pki-cli/pkg/storage/shape"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
 var (
-	instance *buildContext
-	lock     = &sync.Mutex{}
-	once     = sync.Once{}
+	instance     *buildContext
+	instanceLock = &sync.RWMutex{}
+	lock         = &sync.Mutex{}
+	once         = sync.Once{}
 )
 
 // buildContext is responsible for building storage implementation instances. The struct contains shared resources,
 // such as clients that can be shared across multiple instances of storage implementations.
 type buildContext struct {
-	config           *conf.Config
-	kubernetesClient *kubernetes.Clientset
+	config *conf.Config
+	// kubernetesClients contains a client for each kubeconfig context, the empty context denotes the default cluster
+	kubernetesClients map[string]*kubernetes.Clientset
+}
+
+func newBuildContext(config *conf.Config) *buildContext {
+	return &buildContext{
+		config:            config,
+		kubernetesClients: map[string]*kubernetes.Clientset{},
+	}
 }
 
 func InitBuilder(config *conf.Config) *buildContext {
 	once.Do(func() {
+		instanceLock.Lock()
+		defer instanceLock.Unlock()
 		if instance == nil {
-			instance = &buildContext{
-				config: config,
-			}
+			instance = newBuildContext(config)
 		}
 	})
 
+	instanceLock.RLock()
+	defer instanceLock.RUnlock()
 	return instance
 }
 
+// ReplaceBuilder replaces the shared buildContext with a new one for the given config, e.g. after the config has been
+// reloaded, so changes of the kubeconfig, context or impersonation settings take effect. Clients of the previous
+// buildContext are not reused. The returned function restores the previous buildContext, e.g. if the new config could
+// not be applied.
+func ReplaceBuilder(config *conf.Config) (restore func()) {
+	once.Do(func() {})
+
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+	previous := instance
+	instance = newBuildContext(config)
+
+	return func() {
+		instanceLock.Lock()
+		defer instanceLock.Unlock()
+		instance = previous
+	}
+}
+
 func GetBuilder() (*buildContext, error) {
+	instanceLock.RLock()
+	defer instanceLock.RUnlock()
 	if instance == nil {
 		return nil, errors.New("buildContext not initialized yet")
 	}
@@ -67,25 +100,37 @@ func (context *buildContext) BuildFromUri(uri string) (pki.StorageImplementation
 	}
 }
 
+// KubernetesClient returns the client for the default cluster.
 func (context *buildContext) KubernetesClient() (*kubernetes.Clientset, error) {
-	if context.kubernetesClient == nil {
-		lock.Lock()
-		defer lock.Unlock()
-		if context.kubernetesClient == nil {
-			log.Info().Msg("Building kubernetes client")
-			config, err := rest.InClusterConfig()
-			if err != nil {
-				return nil, fmt.Errorf("could not build kubernetes client config: %v", err)
-			}
-			client, err := kubernetes.NewForConfig(config)
-			if err != nil {
-				return nil, fmt.Errorf("could not build kubernetes client: %v", err)
-			}
-			context.kubernetesClient = client
-		}
+	return context.KubernetesClientForContext("")
+}
+
+// KubernetesClientForContext returns the client for the cluster of the given kubeconfig context. Clients are built
+// once and shared by all storage implementations.
+func (context *buildContext) KubernetesClientForContext(kubeContext string) (*kubernetes.Clientset, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if client, ok := context.kubernetesClients[kubeContext]; ok {
+		return client, nil
+	}
+
+	if len(kubeContext) > 0 {
+		log.Info().Msgf("Building kubernetes client for context '%s'", kubeContext)
+	} else {
+		log.Info().Msg("Building kubernetes client")
+	}
+	config, err := buildKubernetesConfig(context.config, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("could not build kubernetes client config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not build kubernetes client: %v", err)
 	}
 
-	return context.kubernetesClient, nil
+	context.kubernetesClients[kubeContext] = client
+	return client, nil
 }
 
 func CaStorageFromConfig(storageConfig []map[string]string) (*sink2.CaStorage, error) {
@@ -119,17 +164,19 @@ const (
 	keyId  = "key"
 	caId   = "ca"
 	csrId  = "csr"
-	crlId  = "crl"
+	ocspId = "ocsp"
 )
 
-func CrlStorageFromConfig(storageConfig []map[string]string) (*sink2.CrlStorage, error) {
+// CrlStorageFromConfig builds the storage for the given kind of CRL. The storage slot is named after the kind.
+func CrlStorageFromConfig(storageConfig []map[string]string, kind pkg.CrlKind) (*sink2.CrlStorage, error) {
+	crlSlot := string(kind)
 	var crlVal string
 	for _, conf := range storageConfig {
-		val, ok := conf[crlId]
+		val, ok := conf[crlSlot]
 		if ok {
 			crlVal = val
 		} else {
-			log.Info().Msgf("No storage config given for '%s', writing to stdout", crlId)
+			log.Info().Msgf("No storage config given for '%s', writing to stdout", crlSlot)
 		}
 	}
 
@@ -148,6 +195,26 @@ func CrlStorageFromConfig(storageConfig []map[string]string) (*sink2.CrlStorage,
 	return sink2.NewCrlStorage(nil)
 }
 
+// ConfiguredCrlKinds returns the kinds of CRLs that have a storage slot configured. If no slot is configured, only
+// the base CRL is returned.
+func ConfiguredCrlKinds(storageConfig []map[string]string) []pkg.CrlKind {
+	var kinds []pkg.CrlKind
+	for _, kind := range pkg.CrlKinds {
+		for _, conf := range storageConfig {
+			if _, ok := conf[string(kind)]; ok {
+				kinds = append(kinds, kind)
+				break
+			}
+		}
+	}
+
+	if len(kinds) == 0 {
+		return []pkg.CrlKind{pkg.CrlBase}
+	}
+
+	return kinds
+}
+
 func CsrStorageFromConfig(storageConfig []map[string]string) (*sink2.CsrStorage, error) {
 	var certVal string
 	var csrVal string
@@ -260,11 +327,70 @@ func buildSink(conf map[string]string) (*sink2.KeyPairStorage, error) {
 	return sink2.NewKeyPairStorage(certSink, keySink, caSink)
 }
 
+func OcspStorageFromConfig(config *conf.Config) ([]*sink2.OcspStorage, error) {
+	builder, err := GetBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []*sink2.OcspStorage
+	for _, conf := range config.StorageConfig {
+		keyPair, err := buildSink(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		val, ok := conf[ocspId]
+		if !ok || len(val) == 0 {
+			val, err = defaultOcspUri(conf)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ocspSink, err := builder.BuildFromUri(val)
+		if err != nil {
+			return nil, err
+		}
+
+		sink, err := sink2.NewOcspStorage(keyPair, ocspSink)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// defaultOcspUri derives the storage of the OCSP response from the storage of the certificate, the response is
+// written next to the certificate as '<cert>.ocsp'. Only file storages are supported.
+func defaultOcspUri(conf map[string]string) (string, error) {
+	certVal, ok := conf[certId]
+	if !ok || len(certVal) == 0 {
+		certVal = conf[keyId]
+	}
+
+	parsed, err := url.Parse(certVal)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != backend.FsScheme {
+		return "", fmt.Errorf("can not build storage, missing '%s' in storage configuration", ocspId)
+	}
+
+	parsed.Path += ".ocsp"
+	return parsed.String(), nil
+}
+
 func MultiKeyPairStorageFromConfig(config *conf.Config) (*sink2.MultiKeyPairStorage, error) {
 	sinks, err := KeyPairStorageFromConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	return sink2.NewMultiKeyPairSink(sinks...)
+	return sink2.NewMultiKeyPairSink(sinks,
+		sink2.WithParallelWrites(config.StorageParallelWrites),
+		sink2.WithStatusHandler(internal.UpdateSinkMetrics),
+	)
 }
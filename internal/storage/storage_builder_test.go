@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/conf"
+)
+
+func Test_defaultOcspUri(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "cert",
+			conf: map[string]string{certId: "file:///etc/ssl/cert.pem", keyId: "file:///etc/ssl/key.pem"},
+			want: "file:///etc/ssl/cert.pem.ocsp",
+		},
+		{
+			name: "keypair in key slot",
+			conf: map[string]string{keyId: "file://user:group@/etc/ssl/keypair.pem?chmod=640"},
+			want: "file://user:group@/etc/ssl/keypair.pem.ocsp?chmod=640",
+		},
+		{
+			name:    "kubernetes",
+			conf:    map[string]string{certId: "k8s-sec:///namespace/name", keyId: "k8s-sec:///namespace/name"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaultOcspUri(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("defaultOcspUri() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("defaultOcspUri() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceBuilder(t *testing.T) {
+	initial := &conf.Config{CommonName: "initial"}
+	InitBuilder(initial)
+
+	reloaded := &conf.Config{CommonName: "reloaded"}
+	restore := ReplaceBuilder(reloaded)
+
+	builder, err := GetBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builder.config != reloaded {
+		t.Errorf("expected builder to use the reloaded config")
+	}
+
+	// InitBuilder must not replace the builder again
+	if InitBuilder(initial).config != reloaded {
+		t.Errorf("expected InitBuilder to return the replaced builder")
+	}
+
+	restore()
+	builder, err = GetBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builder.config != initial {
+		t.Errorf("expected previous builder to be restored")
+	}
+}
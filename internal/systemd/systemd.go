@@ -0,0 +1,121 @@
+// Package systemd implements the parts of the systemd service manager protocols that are needed to run as a
+// Type=notify service: readiness and status notifications, the watchdog and socket activation.
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+
+	// listenFdsStart is the first file descriptor passed by systemd socket activation
+	listenFdsStart = 3
+)
+
+// Status returns a state that describes the service's status in a human-readable way.
+func Status(format string, args ...any) string {
+	return "STATUS=" + fmt.Sprintf(format, args...)
+}
+
+// Notify sends the given states to the service manager. It returns false if the service has not been started by
+// systemd with notification support.
+func Notify(states ...string) (bool, error) {
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if len(socketAddr) == 0 {
+		return false, nil
+	}
+
+	// abstract sockets are denoted by a leading '@'
+	if strings.HasPrefix(socketAddr, "@") {
+		socketAddr = "\x00" + socketAddr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketAddr, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("could not connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return false, fmt.Errorf("could not notify service manager: %w", err)
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns the interval in which the service manager expects WATCHDOG=1 notifications. It returns 0
+// if the watchdog is not enabled for this process.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if len(usec) == 0 {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	val, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || val <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC '%s'", usec)
+	}
+
+	return time.Duration(val) * time.Microsecond, nil
+}
+
+// Listeners returns the sockets passed by socket activation, keyed by the name configured with FileDescriptorName=.
+// Unnamed sockets are named 'unknown' by systemd. The environment variables are unset, so the sockets are not passed
+// on to hooks.
+func Listeners() (map[string]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, errors.New("invalid LISTEN_FDS")
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	ret := make(map[string]net.Listener, count)
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := "unknown"
+		if i < len(names) && len(names[i]) > 0 {
+			name = names[i]
+		}
+		if _, exists := ret[name]; exists {
+			name = fmt.Sprintf("%s-%d", name, i)
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// FileListener dups the descriptor
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket '%s' is not a stream socket: %w", name, err)
+		}
+		ret[name] = listener
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,90 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	if sent || err != nil {
+		t.Fatalf("expected no notification without NOTIFY_SOCKET, got %v, %v", sent, err)
+	}
+
+	// unix socket paths are limited in length, the test's temp dir might exceed it
+	dir, err := os.MkdirTemp("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	sent, err = Notify(Ready, Status("next run at %s", "noon"))
+	if !sent || err != nil {
+		t.Fatalf("expected notification to be sent, got %v, %v", sent, err)
+	}
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), "READY=1\nSTATUS=next run at noon"; got != want {
+		t.Errorf("Notify() sent %q, want %q", got, want)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "own pid", usec: "30000000", pid: strconv.Itoa(os.Getpid()), want: 30 * time.Second},
+		{name: "other pid", usec: "30000000", pid: "1"},
+		{name: "invalid", usec: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			got, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WatchdogInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListeners_OtherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := Listeners()
+	if err != nil || len(listeners) != 0 {
+		t.Fatalf("expected sockets of other processes to be ignored, got %v, %v", listeners, err)
+	}
+	if len(os.Getenv("LISTEN_FDS")) > 0 {
+		t.Errorf("expected environment to be unset")
+	}
+}
@@ -0,0 +1,113 @@
+// Package testutil contains fixtures that are shared by the tests of multiple packages.
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+)
+
+// Cert is an ECDSA certificate along with its private key.
+type Cert struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewCert creates a certificate from the template that is signed by the parent or self-signed if the parent is nil.
+// Unset fields of the template default to serial 1, common name 'test' and a validity of one hour around now.
+func NewCert(t testing.TB, template *x509.Certificate, parent *Cert) *Cert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template = withDefaults(template)
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.Cert, parent.Key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Cert{Cert: cert, Key: key}
+}
+
+// NewCertWithSerial creates a certificate with the given serial and validity that is signed by the parent or self-signed
+// if the parent is nil. A zero validity bound defaults to one hour around now.
+func NewCertWithSerial(t testing.TB, serial int64, notBefore, notAfter time.Time, parent *Cert) *Cert {
+	t.Helper()
+	return NewCert(t, &x509.Certificate{SerialNumber: big.NewInt(serial), NotBefore: notBefore, NotAfter: notAfter}, parent)
+}
+
+// NewCa creates a self-signed CA certificate.
+func NewCa(t testing.TB) *Cert {
+	t.Helper()
+	return NewCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}, nil)
+}
+
+func withDefaults(template *x509.Certificate) *x509.Certificate {
+	ret := *template
+	if ret.SerialNumber == nil {
+		ret.SerialNumber = big.NewInt(1)
+	}
+	if len(ret.Subject.CommonName) == 0 {
+		ret.Subject.CommonName = "test"
+	}
+	if ret.NotBefore.IsZero() {
+		ret.NotBefore = time.Now().Add(-1 * time.Hour)
+	}
+	if ret.NotAfter.IsZero() {
+		ret.NotAfter = time.Now().Add(time.Hour)
+	}
+	return &ret
+}
+
+// CertPem returns the PEM encoded certificate.
+func (c *Cert) CertPem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// KeyPem returns the PEM encoded private key.
+func (c *Cert) KeyPem(t testing.TB) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// CertData returns the certificate and private key, along with the issuing CA if given.
+func (c *Cert) CertData(t testing.TB, ca *Cert) *pkg.CertData {
+	t.Helper()
+	ret := &pkg.CertData{
+		Certificate: c.CertPem(),
+		PrivateKey:  c.KeyPem(t),
+	}
+	if ca != nil {
+		ret.CaData = ca.CertPem()
+	}
+	return ret
+}
@@ -0,0 +1,89 @@
+package testutil
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"golang.org/x/net/context"
+)
+
+// PkiClientMock implements pki.PkiClient. It returns the configured data and records the arguments of issue and sign
+// requests. Requests without configured data fail, acme certificates are read from the issued data.
+type PkiClientMock struct {
+	Issued    *pkg.CertData
+	IssueErr  error
+	Signature *pkg.Signature
+	CaChain   []byte
+	Crl       []byte
+
+	mutex     sync.Mutex
+	issueArgs []pkg.IssueArgs
+	signArgs  []pkg.SignatureArgs
+}
+
+func (m *PkiClientMock) Issue(_ context.Context, args pkg.IssueArgs) (*pkg.CertData, error) {
+	m.mutex.Lock()
+	m.issueArgs = append(m.issueArgs, args)
+	m.mutex.Unlock()
+
+	if m.IssueErr != nil {
+		return nil, m.IssueErr
+	}
+	if m.Issued == nil {
+		return nil, errors.New("not implemented")
+	}
+	return m.Issued, nil
+}
+
+func (m *PkiClientMock) Sign(_ context.Context, _ string, args pkg.SignatureArgs) (*pkg.Signature, error) {
+	m.mutex.Lock()
+	m.signArgs = append(m.signArgs, args)
+	m.mutex.Unlock()
+
+	if m.Signature == nil {
+		return nil, errors.New("not implemented")
+	}
+	return m.Signature, nil
+}
+
+func (m *PkiClientMock) Revoke(_ context.Context, _ string) error {
+	return nil
+}
+
+func (m *PkiClientMock) ReadAcme(_ context.Context, _ string) (*pkg.CertData, error) {
+	if m.Issued == nil {
+		return nil, errors.New("not implemented")
+	}
+	return m.Issued, nil
+}
+
+func (m *PkiClientMock) Tidy(_ context.Context) error {
+	return nil
+}
+
+func (m *PkiClientMock) FetchCa(_ bool) ([]byte, error) {
+	return m.CaChain, nil
+}
+
+func (m *PkiClientMock) FetchCaChain() ([]byte, error) {
+	return m.CaChain, nil
+}
+
+func (m *PkiClientMock) FetchCrl(_ pkg.CrlKind, _ bool) ([]byte, error) {
+	return m.Crl, nil
+}
+
+// IssueArgs returns the arguments of all issue requests.
+func (m *PkiClientMock) IssueArgs() []pkg.IssueArgs {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]pkg.IssueArgs{}, m.issueArgs...)
+}
+
+// SignArgs returns the arguments of all sign requests.
+func (m *PkiClientMock) SignArgs() []pkg.SignatureArgs {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]pkg.SignatureArgs{}, m.signArgs...)
+}
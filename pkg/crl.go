@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"go.uber.org/multierr"
+)
+
+// ParseCrl parses a CRL that is either PEM or DER encoded.
+func ParseCrl(data []byte) (*x509.RevocationList, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data provided")
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected pem block type '%s'", block.Type)
+		}
+		data = block.Bytes
+	}
+
+	return x509.ParseRevocationList(data)
+}
+
+// ParseCertsPem parses all certificates contained in the given PEM data, e.g. a CA chain.
+func ParseCertsPem(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	var block *pem.Block
+	rest := data
+	for {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+
+	return certs, nil
+}
+
+// VerifyCrl verifies the signature of the CRL against the given CA certificates. Verification succeeds if the CRL
+// has been signed by any of the certificates.
+func VerifyCrl(crl *x509.RevocationList, cas []*x509.Certificate) error {
+	if crl == nil {
+		return fmt.Errorf("%w: nil crl provided", ErrCrlInvalid)
+	}
+
+	var errs error
+	for _, ca := range cas {
+		err := crl.CheckSignatureFrom(ca)
+		if err == nil {
+			return nil
+		}
+		errs = multierr.Append(errs, err)
+	}
+
+	return fmt.Errorf("%w: signature could not be verified: %v", ErrCrlInvalid, errs)
+}
+
+var oidDeltaCrlIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+// reasonRemoveFromCrl is the reason code that is used in delta CRLs to signal that a certificate is not revoked anymore.
+const reasonRemoveFromCrl = 8
+
+// DeltaCrlBaseNumber returns the number of the base CRL a delta CRL refers to. An error is returned if the CRL does
+// not contain a delta CRL indicator.
+func DeltaCrlBaseNumber(crl *x509.RevocationList) (*big.Int, error) {
+	if crl == nil {
+		return nil, fmt.Errorf("%w: nil crl provided", ErrCrlInvalid)
+	}
+
+	for _, ext := range crl.Extensions {
+		if !ext.Id.Equal(oidDeltaCrlIndicator) {
+			continue
+		}
+
+		baseNumber := new(big.Int)
+		if _, err := asn1.Unmarshal(ext.Value, &baseNumber); err != nil {
+			return nil, fmt.Errorf("%w: malformed delta crl indicator: %v", ErrCrlInvalid, err)
+		}
+		return baseNumber, nil
+	}
+
+	return nil, fmt.Errorf("%w: not a delta crl", ErrCrlInvalid)
+}
+
+// RevocationSet contains the effective revoked serial numbers of a base CRL and optional delta CRLs.
+type RevocationSet map[string]x509.RevocationListEntry
+
+// NewRevocationSet merges the entries of the base CRL and the given delta CRLs. Delta CRLs must be issued by the same
+// issuer as the base CRL and must not require a newer base CRL.
+func NewRevocationSet(base *x509.RevocationList, deltas ...*x509.RevocationList) (RevocationSet, error) {
+	if base == nil {
+		return nil, fmt.Errorf("%w: nil crl provided", ErrCrlInvalid)
+	}
+
+	set := RevocationSet{}
+	for _, entry := range base.RevokedCertificateEntries {
+		if entry.SerialNumber != nil {
+			set[entry.SerialNumber.String()] = entry
+		}
+	}
+
+	for _, delta := range deltas {
+		baseNumber, err := DeltaCrlBaseNumber(delta)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(delta.RawIssuer, base.RawIssuer) {
+			return nil, fmt.Errorf("%w: delta crl has been issued by a different issuer", ErrCrlInvalid)
+		}
+
+		if base.Number == nil || base.Number.Cmp(baseNumber) < 0 {
+			return nil, fmt.Errorf("%w: delta crl requires base crl %v", ErrCrlOutdated, baseNumber)
+		}
+
+		for _, entry := range delta.RevokedCertificateEntries {
+			if entry.SerialNumber == nil {
+				continue
+			}
+
+			if entry.ReasonCode == reasonRemoveFromCrl {
+				delete(set, entry.SerialNumber.String())
+			} else {
+				set[entry.SerialNumber.String()] = entry
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// IsRevoked returns whether the given serial number is part of the revocation set.
+func (s RevocationSet) IsRevoked(serial *big.Int) bool {
+	if serial == nil {
+		return false
+	}
+
+	_, found := s[serial.String()]
+	return found
+}
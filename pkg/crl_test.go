@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func buildCrls(t *testing.T, baseNumber int64, deltaBaseNumber int64) (*x509.RevocationList, *x509.RevocationList) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseDer, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(baseNumber),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(10), RevocationTime: time.Now()},
+			{SerialNumber: big.NewInt(11), RevocationTime: time.Now()},
+		},
+	}, ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indicator, err := asn1.Marshal(big.NewInt(deltaBaseNumber))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltaDer, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(baseNumber + 1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(11), RevocationTime: time.Now(), ReasonCode: reasonRemoveFromCrl},
+			{SerialNumber: big.NewInt(12), RevocationTime: time.Now()},
+		},
+		ExtraExtensions: []pkix.Extension{{Id: oidDeltaCrlIndicator, Critical: true, Value: indicator}},
+	}, ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := ParseCrl(baseDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := ParseCrl(deltaDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base, delta
+}
+
+func TestNewRevocationSet(t *testing.T) {
+	base, delta := buildCrls(t, 5, 5)
+
+	set, err := NewRevocationSet(base, delta)
+	if err != nil {
+		t.Fatalf("NewRevocationSet() error = %v", err)
+	}
+
+	want := map[int64]bool{
+		10: true,
+		11: false,
+		12: true,
+		13: false,
+	}
+	for serial, revoked := range want {
+		if got := set.IsRevoked(big.NewInt(serial)); got != revoked {
+			t.Errorf("IsRevoked(%d) = %v, want %v", serial, got, revoked)
+		}
+	}
+}
+
+func TestNewRevocationSet_Errors(t *testing.T) {
+	base, delta := buildCrls(t, 5, 6)
+	if _, err := NewRevocationSet(base, delta); !errors.Is(err, ErrCrlOutdated) {
+		t.Errorf("NewRevocationSet() error = %v, want %v", err, ErrCrlOutdated)
+	}
+
+	if _, err := NewRevocationSet(base, base); !errors.Is(err, ErrCrlInvalid) {
+		t.Errorf("NewRevocationSet() error = %v, want %v", err, ErrCrlInvalid)
+	}
+}
@@ -3,7 +3,9 @@ package pkg
 import (
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 )
 
 var (
@@ -15,6 +17,11 @@ var (
 	ErrRevokeCert      = errors.New("error while revoking cert")
 	ErrSignCert        = errors.New("error while signing cert")
 	ErrTidyCert        = errors.New("error while tidying up cert storage")
+	ErrCrlInvalid      = errors.New("crl is invalid")
+	ErrCrlOutdated     = errors.New("crl is older than the existing crl")
+	ErrFetchCrl        = errors.New("error while fetching crl")
+	ErrIssueVetoed     = errors.New("renewal vetoed by pre-issue hook")
+	ErrIssueDelayed    = errors.New("renewal delayed by pre-issue hook")
 )
 
 type IssueStatus int
@@ -23,12 +30,52 @@ const (
 	Issued  IssueStatus = iota
 	Noop    IssueStatus = iota
 	Unknown IssueStatus = iota
+	Vetoed  IssueStatus = iota
+	Delayed IssueStatus = iota
 )
 
 type IssueResult struct {
 	ExistingCert *x509.Certificate
 	IssuedCert   *x509.Certificate
 	Status       IssueStatus
+	// RetryAfter is set if the renewal has been delayed
+	RetryAfter time.Duration
+}
+
+// DelayError signals that a renewal should not happen now but be retried after the given duration.
+type DelayError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *DelayError) Error() string {
+	return fmt.Sprintf("%v, retry after %v: %v", ErrIssueDelayed, e.RetryAfter, e.Err)
+}
+
+func (e *DelayError) Unwrap() []error {
+	return []error{ErrIssueDelayed, e.Err}
+}
+
+// CrlKind identifies the different CRLs a PKI mount can publish.
+type CrlKind string
+
+const (
+	CrlBase         CrlKind = "crl"
+	CrlDelta        CrlKind = "crl-delta"
+	CrlUnified      CrlKind = "unified-crl"
+	CrlUnifiedDelta CrlKind = "unified-crl-delta"
+)
+
+var CrlKinds = []CrlKind{CrlBase, CrlDelta, CrlUnified, CrlUnifiedDelta}
+
+func (k CrlKind) IsDelta() bool {
+	return k == CrlDelta || k == CrlUnifiedDelta
+}
+
+type CrlResult struct {
+	ExistingCrl *x509.RevocationList
+	FetchedCrl  *x509.RevocationList
+	Status      IssueStatus
 }
 
 type SignatureArgs struct {
@@ -36,6 +83,10 @@ type SignatureArgs struct {
 	Ttl        string
 	IpSans     []string
 	AltNames   []string
+	// KeyUsages and ExtKeyUsages use the names of Vault, e.g. 'DigitalSignature' and 'ServerAuth'. Empty lists
+	// leave the decision to the role.
+	KeyUsages    []string
+	ExtKeyUsages []string
 }
 
 type IssueArgs struct {
@@ -43,6 +94,8 @@ type IssueArgs struct {
 	Ttl        string
 	IpSans     []string
 	AltNames   []string
+	// Force issues a new certificate regardless of the renewal strategy's decision
+	Force bool
 }
 
 type CertData struct {
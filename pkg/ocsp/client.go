@@ -0,0 +1,208 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.uber.org/multierr"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/net/context"
+)
+
+const (
+	contentTypeRequest  = "application/ocsp-request"
+	contentTypeResponse = "application/ocsp-response"
+
+	// maxResponseSize limits the size of a response that is read from a responder
+	maxResponseSize = 1024 * 1024
+
+	defaultRefreshInterval = 1 * time.Hour
+)
+
+var (
+	ErrNoResponder     = errors.New("no ocsp responder available")
+	ErrInvalidResponse = errors.New("invalid ocsp response")
+)
+
+// Client queries OCSP responders for the revocation status of certificates. Responders that are explicitly configured
+// take precedence over the responders listed in the certificate's AIA extension.
+type Client struct {
+	httpClient *http.Client
+	responders []string
+}
+
+type ClientOpt func(c *Client) error
+
+func WithResponder(url string) ClientOpt {
+	return func(c *Client) error {
+		if len(url) == 0 {
+			return errors.New("empty responder url")
+		}
+		c.responders = append(c.responders, url)
+		return nil
+	}
+}
+
+func WithHttpClient(client *http.Client) ClientOpt {
+	return func(c *Client) error {
+		if client == nil {
+			return errors.New("nil http client")
+		}
+		c.httpClient = client
+		return nil
+	}
+}
+
+func NewClient(opts ...ClientOpt) (*Client, error) {
+	ret := &Client{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	return ret, errs
+}
+
+// Response is a verified OCSP response including its DER encoded form that can be used for stapling.
+type Response struct {
+	*ocsp.Response
+	Der []byte
+}
+
+func (r *Response) IsGood() bool {
+	return r.Status == ocsp.Good
+}
+
+// RefreshAt returns the time when the response should be refreshed, which is halfway through its validity window.
+func (r *Response) RefreshAt() time.Time {
+	if r.NextUpdate.IsZero() {
+		return time.Now().Add(defaultRefreshInterval)
+	}
+
+	validity := r.NextUpdate.Sub(r.ThisUpdate)
+	return r.ThisUpdate.Add(validity / 2)
+}
+
+// Query asks the configured responders, falling back to the certificate's AIA responders, for the status of the
+// given certificate. The response's signature, serial and validity window are verified.
+func (c *Client) Query(ctx context.Context, cert, issuer *x509.Certificate) (*Response, error) {
+	if cert == nil || issuer == nil {
+		return nil, errors.New("empty cert(s) supplied")
+	}
+
+	responders := c.responders
+	if len(responders) == 0 {
+		responders = cert.OCSPServer
+	}
+	if len(responders) == 0 {
+		return nil, ErrNoResponder
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, fmt.Errorf("could not build ocsp request: %w", err)
+	}
+
+	var errs error
+	for _, responder := range responders {
+		resp, err := c.query(ctx, responder, req, cert, issuer)
+		if err == nil {
+			return resp, nil
+		}
+		log.Warn().Err(err).Str("responder", responder).Msg("Querying ocsp responder failed")
+		errs = multierr.Append(errs, err)
+	}
+
+	return nil, errs
+}
+
+func (c *Client) query(ctx context.Context, responder string, req []byte, cert, issuer *x509.Certificate) (*Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, responder, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentTypeRequest)
+	httpReq.Header.Set("Accept", contentTypeResponse)
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("responder '%s' returned status code %d", responder, httpResp.StatusCode)
+	}
+
+	der, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	if err := verifyResponse(parsed, cert); err != nil {
+		return nil, err
+	}
+
+	return &Response{Response: parsed, Der: der}, nil
+}
+
+func verifyResponse(resp *ocsp.Response, cert *x509.Certificate) error {
+	if resp.SerialNumber == nil || resp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return fmt.Errorf("%w: serial mismatch", ErrInvalidResponse)
+	}
+
+	now := time.Now()
+	if resp.ThisUpdate.After(now.Add(5 * time.Minute)) {
+		return fmt.Errorf("%w: response is not valid yet", ErrInvalidResponse)
+	}
+
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now) {
+		return fmt.Errorf("%w: response is outdated", ErrInvalidResponse)
+	}
+
+	return nil
+}
+
+// FindIssuer returns the certificate of the given chain that signed the certificate.
+func FindIssuer(cert *x509.Certificate, chain []*x509.Certificate) (*x509.Certificate, error) {
+	if cert == nil {
+		return nil, errors.New("empty cert supplied")
+	}
+
+	for _, candidate := range chain {
+		if cert.CheckSignatureFrom(candidate) == nil {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.New("issuer not found in chain")
+}
+
+// StatusString returns a human-readable representation of an OCSP status.
+func StatusString(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
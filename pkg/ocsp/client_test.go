@@ -0,0 +1,102 @@
+package ocsp
+
+import (
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/net/context"
+)
+
+func TestClient_Query(t *testing.T) {
+	ca := testutil.NewCa(t)
+	leaf := testutil.NewCertWithSerial(t, 42, time.Time{}, time.Time{}, ca).Cert
+	otherLeaf := testutil.NewCertWithSerial(t, 43, time.Time{}, time.Time{}, ca).Cert
+
+	tests := []struct {
+		name       string
+		status     int
+		respSerial *big.Int
+		wantErr    bool
+	}{
+		{
+			name:       "good",
+			status:     ocsp.Good,
+			respSerial: leaf.SerialNumber,
+		},
+		{
+			name:       "revoked",
+			status:     ocsp.Revoked,
+			respSerial: leaf.SerialNumber,
+		},
+		{
+			name:       "serial mismatch",
+			status:     ocsp.Good,
+			respSerial: otherLeaf.SerialNumber,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if _, err := ocsp.ParseRequest(body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				resp, err := ocsp.CreateResponse(ca.Cert, ca.Cert, ocsp.Response{
+					Status:       tt.status,
+					SerialNumber: tt.respSerial,
+					ThisUpdate:   time.Now().Add(-1 * time.Minute),
+					NextUpdate:   time.Now().Add(time.Hour),
+					RevokedAt:    time.Now().Add(-1 * time.Minute),
+				}, ca.Key)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_, _ = w.Write(resp)
+			}))
+			defer server.Close()
+
+			client, err := NewClient(WithResponder(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := client.Query(context.Background(), leaf, ca.Cert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.status {
+				t.Errorf("Query() status = %v, want %v", got.Status, tt.status)
+			}
+			if len(got.Der) == 0 {
+				t.Errorf("Query() returned empty der")
+			}
+		})
+	}
+}
+
+func TestClient_QueryNoResponder(t *testing.T) {
+	ca := testutil.NewCa(t)
+	leaf := testutil.NewCertWithSerial(t, 42, time.Time{}, time.Time{}, ca).Cert
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Query(context.Background(), leaf, ca.Cert); err != ErrNoResponder {
+		t.Errorf("Query() error = %v, want %v", err, ErrNoResponder)
+	}
+}
@@ -0,0 +1,114 @@
+package pki
+
+import (
+	"crypto/x509"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+// Event is emitted by the PkiService during the lifecycle of a certificate. Observers use a type switch to handle the
+// events they are interested in.
+type Event interface {
+	EventName() string
+}
+
+// IssueStarted is emitted right before a new certificate is requested.
+type IssueStarted struct {
+	CommonName string
+	Result     pkg.IssueResult
+}
+
+// CertIssued is emitted after a new certificate has been written to the storage.
+type CertIssued struct {
+	CommonName string
+	Result     pkg.IssueResult
+}
+
+// RenewalSkipped is emitted if the existing certificate has not been renewed, either because renewing it is not
+// necessary yet or because a pre-issue hook vetoed or delayed the renewal.
+type RenewalSkipped struct {
+	CommonName string
+	Result     pkg.IssueResult
+}
+
+// IssueFailed is emitted if issuing or writing a certificate failed.
+type IssueFailed struct {
+	CommonName string
+	Result     pkg.IssueResult
+	Err        error
+}
+
+// CertSigned is emitted after a CSR has been signed and the certificate has been written to the storage.
+type CertSigned struct {
+	CommonName string
+	Cert       *x509.Certificate
+}
+
+// SignFailed is emitted if signing a CSR failed.
+type SignFailed struct {
+	CommonName string
+	Err        error
+}
+
+// CertRevoked is emitted after a certificate has been revoked.
+type CertRevoked struct {
+	Serial string
+}
+
+// RevokeFailed is emitted if revoking a certificate failed.
+type RevokeFailed struct {
+	Serial string
+	Err    error
+}
+
+// CrlFetched is emitted after a CRL has been fetched. Err is set if the CRL could not be fetched, verified or written.
+type CrlFetched struct {
+	Kind   pkg.CrlKind
+	Result pkg.CrlResult
+	Err    error
+}
+
+func (e IssueStarted) EventName() string   { return "issue_started" }
+func (e CertIssued) EventName() string     { return "cert_issued" }
+func (e RenewalSkipped) EventName() string { return "renewal_skipped" }
+func (e IssueFailed) EventName() string    { return "issue_failed" }
+func (e CertSigned) EventName() string     { return "cert_signed" }
+func (e SignFailed) EventName() string     { return "sign_failed" }
+func (e CertRevoked) EventName() string    { return "cert_revoked" }
+func (e RevokeFailed) EventName() string   { return "revoke_failed" }
+func (e CrlFetched) EventName() string     { return "crl_fetched" }
+
+// Observer is notified about all events of a PkiService. Errors returned by observers of CertIssued events are
+// returned to the caller, all other errors are only logged.
+type Observer interface {
+	OnEvent(ctx context.Context, event Event) error
+}
+
+// ObserverFunc adapts a function to an Observer.
+type ObserverFunc func(ctx context.Context, event Event) error
+
+func (f ObserverFunc) OnEvent(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// AddObserver registers an observer. Observers are called synchronously in the order they have been registered.
+func (p *PkiService) AddObserver(observer Observer) {
+	p.observers = append(p.observers, observer)
+}
+
+func (p *PkiService) emit(ctx context.Context, event Event) error {
+	var errs error
+	for _, observer := range p.observers {
+		errs = multierr.Append(errs, observer.OnEvent(ctx, event))
+	}
+	return errs
+}
+
+func (p *PkiService) emitLogged(ctx context.Context, event Event) {
+	if err := p.emit(ctx, event); err != nil {
+		log.Warn().Err(err).Str("event", event.EventName()).Msg("Observer failed")
+	}
+}
@@ -0,0 +1,113 @@
+package pki
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/renew_strategy"
+	"golang.org/x/net/context"
+)
+
+type observerMock struct {
+	events []string
+	err    error
+}
+
+func (m *observerMock) OnEvent(_ context.Context, event Event) error {
+	m.events = append(m.events, event.EventName())
+	return m.err
+}
+
+func TestPkiService_IssueEvents(t *testing.T) {
+	ca := buildTestCa(t)
+	existing, _ := ca.issue(t, 10)
+	_, issued := ca.issue(t, 11)
+
+	tests := []struct {
+		name        string
+		renew       bool
+		issued      []byte
+		observerErr error
+		wantEvents  []string
+		wantErr     bool
+	}{
+		{
+			name:       "issued",
+			renew:      true,
+			issued:     issued,
+			wantEvents: []string{"issue_started", "cert_issued"},
+		},
+		{
+			name:       "skipped",
+			renew:      false,
+			issued:     issued,
+			wantEvents: []string{"renewal_skipped"},
+		},
+		{
+			name:       "failed",
+			renew:      true,
+			issued:     []byte("garbage"),
+			wantEvents: []string{"issue_started", "issue_failed"},
+			wantErr:    true,
+		},
+		{
+			name:        "observer error is returned for issued certs",
+			renew:       true,
+			issued:      issued,
+			observerErr: pkg.ErrRunHook,
+			wantEvents:  []string{"issue_started", "cert_issued"},
+			wantErr:     true,
+		},
+		{
+			name:        "observer error is not returned for skipped renewals",
+			renew:       false,
+			issued:      issued,
+			observerErr: pkg.ErrRunHook,
+			wantEvents:  []string{"renewal_skipped"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &testutil.PkiClientMock{CaChain: ca.pem, Issued: &pkg.CertData{Certificate: tt.issued}}
+			observer := &observerMock{err: tt.observerErr}
+			p, err := NewPkiService(client, &renew_strategy.StaticRenewal{Decision: tt.renew}, WithObserver(observer))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.Issue(context.Background(), &issueStorageMock{cert: existing}, pkg.IssueArgs{CommonName: "leaf"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Issue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.observerErr != nil && tt.wantErr && !errors.Is(err, tt.observerErr) {
+				t.Errorf("Issue() error = %v, want %v", err, tt.observerErr)
+			}
+			if !reflect.DeepEqual(observer.events, tt.wantEvents) {
+				t.Errorf("Issue() events = %v, want %v", observer.events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestPkiService_RevokeEvents(t *testing.T) {
+	observer := &observerMock{}
+	p, err := NewPkiService(&testutil.PkiClientMock{}, nil, WithObserver(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Revoke(context.Background(), "aa:bb"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Revoke(context.Background(), ""); err == nil {
+		t.Fatal("expected error for empty serial")
+	}
+
+	want := []string{"cert_revoked", "revoke_failed"}
+	if !reflect.DeepEqual(observer.events, want) {
+		t.Errorf("Revoke() events = %v, want %v", observer.events, want)
+	}
+}
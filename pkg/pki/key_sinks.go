@@ -16,6 +16,7 @@ type IssueStorage interface {
 }
 
 type CrlStorage interface {
+	ReadCrl() ([]byte, error)
 	WriteCrl(crlData []byte) error
 }
 
@@ -27,3 +28,9 @@ type CsrStorage interface {
 type CaStorage interface {
 	WriteCa(certData []byte) error
 }
+
+// OcspStorage reads the certificate to query the OCSP status for and stores the OCSP response for stapling.
+type OcspStorage interface {
+	ReadCert() (*x509.Certificate, error)
+	WriteOcspResponse(der []byte) error
+}
@@ -0,0 +1,23 @@
+package pki
+
+import "errors"
+
+func WithPreIssueGate(gate PreIssueGate) PkiServiceOpts {
+	return func(p *PkiService) error {
+		if gate == nil {
+			return errors.New("nil pre-issue gate provided")
+		}
+		p.gate = gate
+		return nil
+	}
+}
+
+func WithObserver(observer Observer) PkiServiceOpts {
+	return func(p *PkiService) error {
+		if observer == nil {
+			return errors.New("nil observer provided")
+		}
+		p.observers = append(p.observers, observer)
+		return nil
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
 	"github.com/soerenschneider/vault-pki-cli/pkg/renew_strategy"
+	"go.uber.org/multierr"
 	"golang.org/x/net/context"
 )
 
@@ -23,6 +24,33 @@ type StorageImplementation interface {
 	CanWrite() error
 }
 
+// RawStorage is implemented by storage implementations that alter the data written using Write, e.g. by appending a
+// trailing newline. WriteRaw writes the data as is, e.g. binary DER encoded data.
+type RawStorage interface {
+	WriteRaw(data []byte) error
+}
+
+// ClearableStorage is implemented by storage implementations that can remove the data they hold. It allows rolling
+// back the first write to a storage that does not implement TransactionalStorage.
+type ClearableStorage interface {
+	Clear() error
+}
+
+// TransactionalStorage is implemented by storage implementations that can prepare a write without making the data
+// visible yet. This allows to update multiple storages all-or-nothing. Storage implementations that do not implement
+// it are updated by overwriting their data, restoring the previous data on rollback.
+type TransactionalStorage interface {
+	Stage(data []byte) (StagedWrite, error)
+}
+
+// StagedWrite is a prepared write of a TransactionalStorage.
+type StagedWrite interface {
+	// Commit makes the staged data visible.
+	Commit() error
+	// Rollback discards the staged data or, if it has been committed already, restores the previous data.
+	Rollback() error
+}
+
 type PkiClient interface {
 	// Issue issues a new certificate from the PKI
 	Issue(ctx context.Context, args pkg.IssueArgs) (*pkg.CertData, error)
@@ -45,20 +73,35 @@ type PkiClient interface {
 	// FetchCaChain returns the whole CA chain for the configured mount
 	FetchCaChain() ([]byte, error)
 
-	// FetchCrl returns the CRL of the configured mount
-	FetchCrl(binary bool) ([]byte, error)
+	// FetchCrl returns the CRL of the given kind of the configured mount
+	FetchCrl(kind pkg.CrlKind, binary bool) ([]byte, error)
 }
 
 type RenewStrategy interface {
 	Renew(cert *x509.Certificate) (bool, error)
 }
 
+// RevocationChecker is optionally implemented by a RenewStrategy that checks whether a certificate has been revoked.
+type RevocationChecker interface {
+	IsRevoked(cert *x509.Certificate) (bool, error)
+}
+
+// PreIssueGate is consulted before an existing certificate that is neither expired nor revoked is renewed. Returning
+// an error wrapping pkg.ErrIssueVetoed skips the renewal, returning a *pkg.DelayError postpones it.
+type PreIssueGate interface {
+	Permit(ctx context.Context, cert *x509.Certificate) error
+}
+
 type PkiService struct {
-	pkiImpl  PkiClient
-	strategy RenewStrategy
+	pkiImpl   PkiClient
+	strategy  RenewStrategy
+	gate      PreIssueGate
+	observers []Observer
 }
 
-func NewPkiService(pki PkiClient, strategy RenewStrategy) (*PkiService, error) {
+type PkiServiceOpts func(service *PkiService) error
+
+func NewPkiService(pki PkiClient, strategy RenewStrategy, opts ...PkiServiceOpts) (*PkiService, error) {
 	if pki == nil {
 		return nil, errors.New("empty pki impl provided")
 	}
@@ -67,13 +110,32 @@ func NewPkiService(pki PkiClient, strategy RenewStrategy) (*PkiService, error) {
 		strategy = &renew_strategy.StaticRenewal{Decision: true}
 	}
 
-	return &PkiService{
+	ret := &PkiService{
 		pkiImpl:  pki,
 		strategy: strategy,
-	}, nil
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	return ret, errs
 }
 
 func (p *PkiService) Revoke(ctx context.Context, serial string) error {
+	if err := p.revoke(ctx, serial); err != nil {
+		p.emitLogged(ctx, RevokeFailed{Serial: serial, Err: err})
+		return err
+	}
+
+	p.emitLogged(ctx, CertRevoked{Serial: serial})
+	return nil
+}
+
+func (p *PkiService) revoke(ctx context.Context, serial string) error {
 	if len(serial) == 0 {
 		return errors.New("can't revoke, empty cert serial provided")
 	}
@@ -104,14 +166,19 @@ func (p *PkiService) Tidy(ctx context.Context) error {
 }
 
 func (p *PkiService) ReadAcme(ctx context.Context, format IssueStorage, commonName string) (pkg.IssueResult, error) {
+	ret, err := p.readAcme(ctx, format, commonName)
+	return ret, p.emitIssueResult(ctx, commonName, ret, err)
+}
+
+func (p *PkiService) readAcme(ctx context.Context, format IssueStorage, commonName string) (pkg.IssueResult, error) {
 	ret := pkg.IssueResult{
 		Status: pkg.Unknown,
 	}
 
 	var err error
 	ret.ExistingCert, err = format.ReadCert()
-	if err == nil && ret.ExistingCert == nil {
-		ret.Status = pkg.Noop
+	if err != nil && !errors.Is(err, pkg.ErrNoCertFound) {
+		log.Warn().Err(err).Msg("Could not read certificate")
 	}
 
 	var cert *pkg.CertData
@@ -131,16 +198,17 @@ func (p *PkiService) ReadAcme(ctx context.Context, format IssueStorage, commonNa
 		return ret, fmt.Errorf("received cert data invalid: %w: %v", pkg.ErrCertInvalidData, err)
 	}
 
-	if ret.ExistingCert != nil {
-		if !bytes.Equal(ret.ExistingCert.Raw, ret.IssuedCert.Raw) {
-			ret.Status = pkg.Issued
-		}
-	}
-
 	if err := format.WriteCert(cert); err != nil {
 		return ret, fmt.Errorf("%w: %v", pkg.ErrWriteCert, err)
 	}
 
+	// the acme certificate is renewed by vault, so it is only new to us if it differs from the one we already had
+	if ret.ExistingCert == nil || !bytes.Equal(ret.ExistingCert.Raw, ret.IssuedCert.Raw) {
+		ret.Status = pkg.Issued
+	} else {
+		ret.Status = pkg.Noop
+	}
+
 	return ret, nil
 }
 
@@ -158,7 +226,52 @@ func (p *PkiService) shouldIssue(cert *x509.Certificate) (bool, error) {
 	return p.strategy.Renew(cert)
 }
 
+// isUnusable returns whether the certificate is expired or revoked. Renewing an unusable certificate can not be vetoed
+// or delayed by the pre-issue gate, otherwise the gate could keep a dead certificate in place indefinitely.
+func (p *PkiService) isUnusable(cert *x509.Certificate) bool {
+	if pkg.IsCertExpired(*cert) {
+		log.Info().Msg("Certificate is expired, not consulting pre-issue gate")
+		return true
+	}
+
+	checker, ok := p.strategy.(RevocationChecker)
+	if !ok {
+		return false
+	}
+
+	revoked, err := checker.IsRevoked(cert)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not check whether certificate is revoked")
+		return false
+	}
+	if revoked {
+		log.Info().Msg("Certificate is revoked, not consulting pre-issue gate")
+	}
+	return revoked
+}
+
 func (p *PkiService) Issue(ctx context.Context, format IssueStorage, args pkg.IssueArgs) (pkg.IssueResult, error) {
+	ret, err := p.issue(ctx, format, args)
+	return ret, p.emitIssueResult(ctx, args.CommonName, ret, err)
+}
+
+// emitIssueResult emits the event that matches the outcome of an issue operation. Errors of observers of
+// CertIssued events are returned, so callers can react on e.g. failed hooks.
+func (p *PkiService) emitIssueResult(ctx context.Context, commonName string, ret pkg.IssueResult, err error) error {
+	switch {
+	case err != nil:
+		p.emitLogged(ctx, IssueFailed{CommonName: commonName, Result: ret, Err: err})
+		return err
+	case ret.Status == pkg.Issued:
+		return p.emit(ctx, CertIssued{CommonName: commonName, Result: ret})
+	case ret.Status != pkg.Unknown:
+		p.emitLogged(ctx, RenewalSkipped{CommonName: commonName, Result: ret})
+	}
+
+	return nil
+}
+
+func (p *PkiService) issue(ctx context.Context, format IssueStorage, args pkg.IssueArgs) (pkg.IssueResult, error) {
 	ret := pkg.IssueResult{
 		Status: pkg.Unknown,
 	}
@@ -169,12 +282,35 @@ func (p *PkiService) Issue(ctx context.Context, format IssueStorage, args pkg.Is
 		log.Warn().Err(err).Msg("Could not read certificate")
 	}
 
-	issueNewCert, err := p.shouldIssue(ret.ExistingCert)
-	if ret.ExistingCert != nil && err == nil && !issueNewCert {
-		ret.Status = pkg.Noop
-		return ret, nil
+	if !args.Force {
+		issueNewCert, err := p.shouldIssue(ret.ExistingCert)
+		if ret.ExistingCert != nil && err == nil && !issueNewCert {
+			ret.Status = pkg.Noop
+			return ret, nil
+		}
+	}
+
+	if ret.ExistingCert != nil && p.gate != nil && !p.isUnusable(ret.ExistingCert) {
+		if err := p.gate.Permit(ctx, ret.ExistingCert); err != nil {
+			var delayErr *pkg.DelayError
+			switch {
+			case errors.As(err, &delayErr):
+				log.Info().Err(err).Msgf("Renewal delayed, retrying in %v", delayErr.RetryAfter)
+				ret.Status = pkg.Delayed
+				ret.RetryAfter = delayErr.RetryAfter
+				return ret, nil
+			case errors.Is(err, pkg.ErrIssueVetoed):
+				log.Info().Err(err).Msg("Renewal vetoed")
+				ret.Status = pkg.Vetoed
+				return ret, nil
+			default:
+				return ret, err
+			}
+		}
 	}
 
+	p.emitLogged(ctx, IssueStarted{CommonName: args.CommonName, Result: ret})
+
 	var issuedCertData *pkg.CertData
 	op := func() error {
 		var err error
@@ -191,6 +327,11 @@ func (p *PkiService) Issue(ctx context.Context, format IssueStorage, args pkg.Is
 		return ret, fmt.Errorf("received cert data invalid: %w: %v", pkg.ErrCertInvalidData, err)
 	}
 
+	// the context is canceled e.g. if this replica lost the leader election while waiting for Vault
+	if err := ctx.Err(); err != nil {
+		return ret, fmt.Errorf("%w: %v", pkg.ErrWriteCert, err)
+	}
+
 	if err := format.WriteCert(issuedCertData); err != nil {
 		return ret, fmt.Errorf("%w: %v", pkg.ErrWriteCert, err)
 	}
@@ -237,11 +378,22 @@ func verifyCertAgainstCa(cert, ca *x509.Certificate) error {
 }
 
 func (p *PkiService) Sign(ctx context.Context, sink CsrStorage, args pkg.SignatureArgs) error {
-	csr, err := sink.ReadCsr()
+	cert, err := p.sign(ctx, sink, args)
 	if err != nil {
+		p.emitLogged(ctx, SignFailed{CommonName: args.CommonName, Err: err})
 		return err
 	}
 
+	p.emitLogged(ctx, CertSigned{CommonName: args.CommonName, Cert: cert})
+	return nil
+}
+
+func (p *PkiService) sign(ctx context.Context, sink CsrStorage, args pkg.SignatureArgs) (*x509.Certificate, error) {
+	csr, err := sink.ReadCsr()
+	if err != nil {
+		return nil, err
+	}
+
 	var resp *pkg.Signature
 	op := func() error {
 		var err error
@@ -251,18 +403,126 @@ func (p *PkiService) Sign(ctx context.Context, sink CsrStorage, args pkg.Signatu
 
 	backoffImpl := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
 	if err := backoff.Retry(op, backoffImpl); err != nil {
-		return fmt.Errorf("%w: %v", pkg.ErrSignCert, err)
+		return nil, fmt.Errorf("%w: %v", pkg.ErrSignCert, err)
 	}
 
-	_, err = pkg.ParseCertPem(resp.Certificate)
+	cert, err := pkg.ParseCertPem(resp.Certificate)
 	if err != nil {
-		return fmt.Errorf("received cert data invalid: %w: %v", pkg.ErrCertInvalidData, err)
+		return nil, fmt.Errorf("received cert data invalid: %w: %v", pkg.ErrCertInvalidData, err)
 	}
 
 	err = sink.WriteSignature(resp)
 	if err != nil {
-		return fmt.Errorf("%w: %v", pkg.ErrWriteCert, err)
+		return nil, fmt.Errorf("%w: %v", pkg.ErrWriteCert, err)
 	}
 
-	return nil
+	return cert, nil
+}
+
+// FetchCaChain returns the parsed certificates of the CA chain of the configured mount.
+func (p *PkiService) FetchCaChain() ([]*x509.Certificate, error) {
+	var caData []byte
+	op := func() error {
+		var err error
+		caData, err = p.pkiImpl.FetchCaChain()
+		return err
+	}
+
+	backoffImpl := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+	if err := backoff.Retry(op, backoffImpl); err != nil {
+		return nil, err
+	}
+
+	return pkg.ParseCertsPem(caData)
+}
+
+// UpdateCrl fetches the CRL of the given kind, verifies it against the CA chain and writes it to the sink unless it's
+// older than the CRL that already exists in the sink.
+func (p *PkiService) UpdateCrl(sink CrlStorage, kind pkg.CrlKind, binary bool) (pkg.CrlResult, error) {
+	ret, err := p.updateCrl(sink, kind, binary)
+	p.emitLogged(context.Background(), CrlFetched{Kind: kind, Result: ret, Err: err})
+	return ret, err
+}
+
+func (p *PkiService) updateCrl(sink CrlStorage, kind pkg.CrlKind, binary bool) (pkg.CrlResult, error) {
+	ret := pkg.CrlResult{
+		Status: pkg.Unknown,
+	}
+
+	var crlData []byte
+	op := func() error {
+		var err error
+		crlData, err = p.pkiImpl.FetchCrl(kind, binary)
+		return err
+	}
+
+	backoffImpl := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+	if err := backoff.Retry(op, backoffImpl); err != nil {
+		return ret, fmt.Errorf("%w: %v", pkg.ErrFetchCrl, err)
+	}
+
+	var err error
+	ret.FetchedCrl, err = pkg.ParseCrl(crlData)
+	if err != nil {
+		return ret, fmt.Errorf("%w: %v", pkg.ErrCrlInvalid, err)
+	}
+
+	cas, err := p.FetchCaChain()
+	if err != nil {
+		return ret, fmt.Errorf("%w: could not fetch ca chain: %v", pkg.ErrFetchCrl, err)
+	}
+
+	if err := pkg.VerifyCrl(ret.FetchedCrl, cas); err != nil {
+		return ret, err
+	}
+
+	if kind.IsDelta() {
+		if _, err := pkg.DeltaCrlBaseNumber(ret.FetchedCrl); err != nil {
+			return ret, err
+		}
+	}
+
+	existingData, err := sink.ReadCrl()
+	if err != nil && !errors.Is(err, pkg.ErrNoCertFound) {
+		log.Warn().Err(err).Msg("Could not read existing crl")
+	}
+
+	if len(existingData) > 0 {
+		ret.ExistingCrl, err = pkg.ParseCrl(existingData)
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not parse existing crl, overwriting it")
+		}
+	}
+
+	if ret.ExistingCrl != nil {
+		if isCrlOlder(ret.FetchedCrl, ret.ExistingCrl) {
+			return ret, pkg.ErrCrlOutdated
+		}
+
+		if bytes.Equal(ret.FetchedCrl.Raw, ret.ExistingCrl.Raw) {
+			ret.Status = pkg.Noop
+			return ret, nil
+		}
+	}
+
+	if err := sink.WriteCrl(crlData); err != nil {
+		return ret, fmt.Errorf("%w: %v", pkg.ErrWriteCert, err)
+	}
+
+	ret.Status = pkg.Issued
+	return ret, nil
+}
+
+// isCrlOlder checks whether the candidate CRL has been issued before the existing CRL. CRLs of different issuers
+// can not be compared.
+func isCrlOlder(candidate, existing *x509.RevocationList) bool {
+	if !bytes.Equal(candidate.RawIssuer, existing.RawIssuer) {
+		return false
+	}
+
+	if candidate.Number != nil && existing.Number != nil && candidate.Number.Cmp(existing.Number) != 0 {
+		return candidate.Number.Cmp(existing.Number) < 0
+	}
+
+	return candidate.ThisUpdate.Before(existing.ThisUpdate)
 }
@@ -0,0 +1,371 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/renew_strategy"
+	"golang.org/x/net/context"
+)
+
+type crlStorageMock struct {
+	data []byte
+}
+
+func (m *crlStorageMock) ReadCrl() ([]byte, error) {
+	if len(m.data) == 0 {
+		return nil, pkg.ErrNoCertFound
+	}
+	return m.data, nil
+}
+
+func (m *crlStorageMock) WriteCrl(crlData []byte) error {
+	m.data = crlData
+	return nil
+}
+
+type issueStorageMock struct {
+	cert    *x509.Certificate
+	written *pkg.CertData
+}
+
+func (m *issueStorageMock) ReadCert() (*x509.Certificate, error) {
+	if m.cert == nil {
+		return nil, pkg.ErrNoCertFound
+	}
+	return m.cert, nil
+}
+
+func (m *issueStorageMock) WriteCert(cert *pkg.CertData) error {
+	m.written = cert
+	return nil
+}
+
+type gateMock struct {
+	err    error
+	called bool
+}
+
+func (m *gateMock) Permit(_ context.Context, _ *x509.Certificate) error {
+	m.called = true
+	return m.err
+}
+
+// revokedStrategy renews all certificates and reports them as revoked.
+type revokedStrategy struct{}
+
+func (s *revokedStrategy) Renew(_ *x509.Certificate) (bool, error) {
+	return true, nil
+}
+
+func (s *revokedStrategy) IsRevoked(_ *x509.Certificate) (bool, error) {
+	return true, nil
+}
+
+type testCa struct {
+	cert *testutil.Cert
+	pem  []byte
+}
+
+func buildTestCa(t *testing.T) *testCa {
+	t.Helper()
+	ca := testutil.NewCa(t)
+	return &testCa{cert: ca, pem: ca.CertPem()}
+}
+
+func (ca *testCa) crl(t *testing.T, number int64) []byte {
+	t.Helper()
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: time.Now().Add(time.Duration(number) * time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca.cert.Cert, ca.cert.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return crl
+}
+
+func (ca *testCa) issue(t *testing.T, serial int64) (*x509.Certificate, []byte) {
+	t.Helper()
+	leaf := testutil.NewCert(t, &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: "leaf"}}, ca.cert)
+	return leaf.Cert, leaf.CertPem()
+}
+
+func TestPkiService_IssueGate(t *testing.T) {
+	ca := buildTestCa(t)
+	existing, _ := ca.issue(t, 10)
+	_, issued := ca.issue(t, 11)
+	expired := *existing
+	expired.NotAfter = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name           string
+		existing       *x509.Certificate
+		strategy       RenewStrategy
+		gateErr        error
+		wantStatus     pkg.IssueStatus
+		wantRetryAfter time.Duration
+		wantErr        bool
+		wantGateCalled bool
+	}{
+		{
+			name:           "permitted",
+			existing:       existing,
+			wantStatus:     pkg.Issued,
+			wantGateCalled: true,
+		},
+		{
+			name:           "vetoed",
+			existing:       existing,
+			gateErr:        fmt.Errorf("%w: exit status 1", pkg.ErrIssueVetoed),
+			wantStatus:     pkg.Vetoed,
+			wantGateCalled: true,
+		},
+		{
+			name:           "delayed",
+			existing:       existing,
+			gateErr:        &pkg.DelayError{RetryAfter: 5 * time.Minute, Err: errors.New("exit status 75")},
+			wantStatus:     pkg.Delayed,
+			wantRetryAfter: 5 * time.Minute,
+			wantGateCalled: true,
+		},
+		{
+			name:           "gate failure",
+			existing:       existing,
+			gateErr:        errors.New("unexpected"),
+			wantStatus:     pkg.Unknown,
+			wantErr:        true,
+			wantGateCalled: true,
+		},
+		{
+			name:       "expired cert skips gate",
+			existing:   &expired,
+			gateErr:    fmt.Errorf("%w: exit status 1", pkg.ErrIssueVetoed),
+			wantStatus: pkg.Issued,
+		},
+		{
+			name:       "revoked cert skips gate",
+			existing:   existing,
+			strategy:   &revokedStrategy{},
+			gateErr:    fmt.Errorf("%w: exit status 1", pkg.ErrIssueVetoed),
+			wantStatus: pkg.Issued,
+		},
+		{
+			name:       "no existing cert skips gate",
+			gateErr:    fmt.Errorf("%w: exit status 1", pkg.ErrIssueVetoed),
+			wantStatus: pkg.Issued,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &testutil.PkiClientMock{CaChain: ca.pem, Issued: &pkg.CertData{Certificate: issued}}
+			gate := &gateMock{err: tt.gateErr}
+			strategy := tt.strategy
+			if strategy == nil {
+				strategy = &renew_strategy.StaticRenewal{Decision: true}
+			}
+			p, err := NewPkiService(client, strategy, WithPreIssueGate(gate))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			storage := &issueStorageMock{cert: tt.existing}
+			result, err := p.Issue(context.Background(), storage, pkg.IssueArgs{CommonName: "leaf"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Issue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("Issue() status = %v, want %v", result.Status, tt.wantStatus)
+			}
+			if result.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("Issue() retryAfter = %v, want %v", result.RetryAfter, tt.wantRetryAfter)
+			}
+			if gate.called != tt.wantGateCalled {
+				t.Errorf("Issue() gate called = %v, want %v", gate.called, tt.wantGateCalled)
+			}
+			if (storage.written != nil) != (tt.wantStatus == pkg.Issued) {
+				t.Errorf("Issue() written = %v, want status %v", storage.written != nil, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPkiService_IssueForce(t *testing.T) {
+	ca := buildTestCa(t)
+	existing, _ := ca.issue(t, 10)
+	_, issued := ca.issue(t, 11)
+
+	for _, force := range []bool{false, true} {
+		client := &testutil.PkiClientMock{CaChain: ca.pem, Issued: &pkg.CertData{Certificate: issued}}
+		p, err := NewPkiService(client, &renew_strategy.StaticRenewal{Decision: false})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		storage := &issueStorageMock{cert: existing}
+		result, err := p.Issue(context.Background(), storage, pkg.IssueArgs{CommonName: "leaf", Force: force})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := pkg.Noop
+		if force {
+			want = pkg.Issued
+		}
+		if result.Status != want {
+			t.Errorf("Issue() force = %v, status = %v, want %v", force, result.Status, want)
+		}
+	}
+}
+
+func TestPkiService_IssueCanceled(t *testing.T) {
+	ca := buildTestCa(t)
+	_, issued := ca.issue(t, 11)
+
+	client := &testutil.PkiClientMock{CaChain: ca.pem, Issued: &pkg.CertData{Certificate: issued}}
+	p, err := NewPkiService(client, &renew_strategy.StaticRenewal{Decision: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// e.g. the lease has been lost while waiting for Vault
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	storage := &issueStorageMock{}
+	if _, err := p.Issue(ctx, storage, pkg.IssueArgs{CommonName: "leaf", Force: true}); !errors.Is(err, pkg.ErrWriteCert) {
+		t.Errorf("Issue() error = %v, want %v", err, pkg.ErrWriteCert)
+	}
+	if storage.written != nil {
+		t.Error("expected certificate not to be written after the context has been canceled")
+	}
+}
+
+func TestPkiService_ReadAcme(t *testing.T) {
+	ca := buildTestCa(t)
+	existing, existingPem := ca.issue(t, 10)
+	_, renewedPem := ca.issue(t, 11)
+
+	tests := []struct {
+		name     string
+		existing *x509.Certificate
+		acme     []byte
+		want     pkg.IssueStatus
+	}{
+		{name: "empty storage", acme: existingPem, want: pkg.Issued},
+		{name: "renewed", existing: existing, acme: renewedPem, want: pkg.Issued},
+		{name: "unchanged", existing: existing, acme: existingPem, want: pkg.Noop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &testutil.PkiClientMock{CaChain: ca.pem, Issued: &pkg.CertData{Certificate: tt.acme}}
+			p, err := NewPkiService(client, &renew_strategy.StaticRenewal{Decision: false})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			storage := &issueStorageMock{cert: tt.existing}
+			result, err := p.ReadAcme(context.Background(), storage, "leaf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("ReadAcme() status = %v, want %v", result.Status, tt.want)
+			}
+			if storage.written == nil {
+				t.Error("expected certificate to be written")
+			}
+		})
+	}
+}
+
+func TestPkiService_UpdateCrl(t *testing.T) {
+	ca := buildTestCa(t)
+	otherCa := buildTestCa(t)
+
+	crl1 := ca.crl(t, 1)
+	crl2 := ca.crl(t, 2)
+
+	tests := []struct {
+		name       string
+		fetched    []byte
+		caChain    []byte
+		existing   []byte
+		wantStatus pkg.IssueStatus
+		wantErr    error
+		wantData   []byte
+	}{
+		{
+			name:       "no existing crl",
+			fetched:    crl1,
+			caChain:    ca.pem,
+			wantStatus: pkg.Issued,
+			wantData:   crl1,
+		},
+		{
+			name:       "newer crl",
+			fetched:    crl2,
+			caChain:    ca.pem,
+			existing:   crl1,
+			wantStatus: pkg.Issued,
+			wantData:   crl2,
+		},
+		{
+			name:       "same crl",
+			fetched:    crl1,
+			caChain:    ca.pem,
+			existing:   crl1,
+			wantStatus: pkg.Noop,
+			wantData:   crl1,
+		},
+		{
+			name:       "older crl",
+			fetched:    crl1,
+			caChain:    ca.pem,
+			existing:   crl2,
+			wantStatus: pkg.Unknown,
+			wantErr:    pkg.ErrCrlOutdated,
+			wantData:   crl2,
+		},
+		{
+			name:       "invalid signature",
+			fetched:    crl2,
+			caChain:    otherCa.pem,
+			existing:   crl1,
+			wantStatus: pkg.Unknown,
+			wantErr:    pkg.ErrCrlInvalid,
+			wantData:   crl1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPkiService(&testutil.PkiClientMock{Crl: tt.fetched, CaChain: tt.caChain}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sink := &crlStorageMock{data: tt.existing}
+			got, err := p.UpdateCrl(sink, pkg.CrlBase, true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateCrl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("UpdateCrl() status = %v, want %v", got.Status, tt.wantStatus)
+			}
+			if string(sink.data) != string(tt.wantData) {
+				t.Errorf("UpdateCrl() wrote unexpected data")
+			}
+		})
+	}
+}
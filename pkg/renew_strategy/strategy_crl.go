@@ -0,0 +1,201 @@
+package renew_strategy
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+)
+
+// CrlSource provides the CRL and the CA chain that is used to verify the CRL's signature.
+type CrlSource interface {
+	FetchCrl(kind pkg.CrlKind, binary bool) ([]byte, error)
+	FetchCaChain() ([]byte, error)
+}
+
+type renewStrategy interface {
+	Renew(cert *x509.Certificate) (bool, error)
+}
+
+// revocationCacheTtl is the duration a checked revocation state is reused for, so the CRLs are downloaded only once
+// while deciding about a certificate.
+const revocationCacheTtl = time.Minute
+
+type revocationState struct {
+	serial  *big.Int
+	revoked bool
+	checked time.Time
+}
+
+// Revocation forces renewal of a certificate that is listed on the PKI's CRL. If the certificate is not revoked, the
+// decision is delegated to the wrapped strategy.
+type Revocation struct {
+	source    CrlSource
+	next      renewStrategy
+	onRevoked func(cert *x509.Certificate)
+	unified   bool
+	delta     bool
+
+	mutex sync.Mutex
+	last  *revocationState
+}
+
+type RevocationOpt func(r *Revocation) error
+
+func WithRevokedHandler(handler func(cert *x509.Certificate)) RevocationOpt {
+	return func(r *Revocation) error {
+		if handler == nil {
+			return errors.New("nil handler supplied")
+		}
+		r.onRevoked = handler
+		return nil
+	}
+}
+
+// WithUnifiedCrl uses the unified cross-cluster CRL instead of the CRL of the local cluster.
+func WithUnifiedCrl() RevocationOpt {
+	return func(r *Revocation) error {
+		r.unified = true
+		return nil
+	}
+}
+
+// WithDeltaCrl merges the delta CRL into the base CRL to detect revocations that happened since the base CRL has been
+// issued.
+func WithDeltaCrl() RevocationOpt {
+	return func(r *Revocation) error {
+		r.delta = true
+		return nil
+	}
+}
+
+func NewRevocation(source CrlSource, next renewStrategy, opts ...RevocationOpt) (*Revocation, error) {
+	if source == nil {
+		return nil, errors.New("empty crl source provided")
+	}
+
+	if next == nil {
+		return nil, errors.New("empty strategy provided")
+	}
+
+	ret := &Revocation{
+		source: source,
+		next:   next,
+	}
+
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (r *Revocation) Renew(cert *x509.Certificate) (bool, error) {
+	if cert == nil {
+		return true, errors.New("empty certificate provided")
+	}
+
+	revoked, err := r.checkRevoked(cert)
+	if err != nil {
+		// not being able to check the CRL must not lead to issuing certificates each run
+		log.Warn().Err(err).Msg("Could not check whether certificate is revoked")
+	} else if revoked {
+		log.Warn().Str("serial", pkg.FormatSerial(cert.SerialNumber)).Msg("Certificate is listed on the CRL")
+		if r.onRevoked != nil {
+			r.onRevoked(cert)
+		}
+		return true, nil
+	}
+
+	return r.next.Renew(cert)
+}
+
+// IsRevoked returns whether the certificate is listed on the CRL. The state checked by a preceding call to Renew is
+// reused for a short time instead of downloading the CRLs again.
+func (r *Revocation) IsRevoked(cert *x509.Certificate) (bool, error) {
+	r.mutex.Lock()
+	last := r.last
+	r.mutex.Unlock()
+
+	if last != nil && last.serial.Cmp(cert.SerialNumber) == 0 && time.Since(last.checked) < revocationCacheTtl {
+		return last.revoked, nil
+	}
+
+	return r.checkRevoked(cert)
+}
+
+// checkRevoked downloads the CRLs, checks whether the certificate is listed and remembers the result.
+func (r *Revocation) checkRevoked(cert *x509.Certificate) (bool, error) {
+	revoked, err := r.fetchRevoked(cert)
+	if err != nil {
+		return false, err
+	}
+
+	r.mutex.Lock()
+	r.last = &revocationState{serial: cert.SerialNumber, revoked: revoked, checked: time.Now()}
+	r.mutex.Unlock()
+	return revoked, nil
+}
+
+func (r *Revocation) fetchRevoked(cert *x509.Certificate) (bool, error) {
+	caData, err := r.source.FetchCaChain()
+	if err != nil {
+		return false, fmt.Errorf("could not fetch ca chain: %w", err)
+	}
+
+	cas, err := pkg.ParseCertsPem(caData)
+	if err != nil {
+		return false, fmt.Errorf("could not parse ca chain: %w", err)
+	}
+
+	baseKind, deltaKind := pkg.CrlBase, pkg.CrlDelta
+	if r.unified {
+		baseKind, deltaKind = pkg.CrlUnified, pkg.CrlUnifiedDelta
+	}
+
+	base, err := r.fetchCrl(baseKind, cas)
+	if err != nil {
+		return false, err
+	}
+
+	var deltas []*x509.RevocationList
+	if r.delta {
+		delta, err := r.fetchCrl(deltaKind, cas)
+		if err != nil {
+			return false, err
+		}
+		deltas = append(deltas, delta)
+	}
+
+	revoked, err := pkg.NewRevocationSet(base, deltas...)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked.IsRevoked(cert.SerialNumber), nil
+}
+
+func (r *Revocation) fetchCrl(kind pkg.CrlKind, cas []*x509.Certificate) (*x509.RevocationList, error) {
+	crlData, err := r.source.FetchCrl(kind, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch %s: %w", kind, err)
+	}
+
+	crl, err := pkg.ParseCrl(crlData)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", kind, err)
+	}
+
+	if err := pkg.VerifyCrl(crl, cas); err != nil {
+		return nil, err
+	}
+
+	return crl, nil
+}
@@ -0,0 +1,154 @@
+package renew_strategy
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+)
+
+type crlSourceMock struct {
+	crl     []byte
+	ca      []byte
+	err     error
+	fetches int
+}
+
+func (m *crlSourceMock) FetchCrl(_ pkg.CrlKind, _ bool) ([]byte, error) {
+	m.fetches++
+	return m.crl, m.err
+}
+
+func (m *crlSourceMock) FetchCaChain() ([]byte, error) {
+	return m.ca, m.err
+}
+
+func buildCaAndCrl(t *testing.T, revoked ...int64) ([]byte, []byte) {
+	t.Helper()
+
+	ca := testutil.NewCa(t)
+
+	var entries []x509.RevocationListEntry
+	for _, serial := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-1 * time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.Cert, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return crl, ca.CertPem()
+}
+
+func TestRevocation_Renew(t *testing.T) {
+	crl, ca := buildCaAndCrl(t, 42)
+	_, otherCa := buildCaAndCrl(t)
+
+	tests := []struct {
+		name        string
+		source      *crlSourceMock
+		next        renewStrategy
+		serial      int64
+		want        bool
+		wantHandler bool
+	}{
+		{
+			name:        "revoked",
+			source:      &crlSourceMock{crl: crl, ca: ca},
+			next:        &StaticRenewal{Decision: false},
+			serial:      42,
+			want:        true,
+			wantHandler: true,
+		},
+		{
+			name:   "not revoked",
+			source: &crlSourceMock{crl: crl, ca: ca},
+			next:   &StaticRenewal{Decision: false},
+			serial: 43,
+			want:   false,
+		},
+		{
+			name:   "not revoked, delegate",
+			source: &crlSourceMock{crl: crl, ca: ca},
+			next:   &StaticRenewal{Decision: true},
+			serial: 43,
+			want:   true,
+		},
+		{
+			name:   "crl signed by other ca",
+			source: &crlSourceMock{crl: crl, ca: otherCa},
+			next:   &StaticRenewal{Decision: false},
+			serial: 42,
+			want:   false,
+		},
+		{
+			name:   "crl not available",
+			source: &crlSourceMock{err: errors.New("unavailable")},
+			next:   &StaticRenewal{Decision: false},
+			serial: 42,
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handlerCalled bool
+			r, err := NewRevocation(tt.source, tt.next, WithRevokedHandler(func(_ *x509.Certificate) {
+				handlerCalled = true
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := r.Renew(&x509.Certificate{SerialNumber: big.NewInt(tt.serial)})
+			if err != nil {
+				t.Errorf("Renew() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Renew() got = %v, want %v", got, tt.want)
+			}
+			if handlerCalled != tt.wantHandler {
+				t.Errorf("Renew() handler called = %v, want %v", handlerCalled, tt.wantHandler)
+			}
+		})
+	}
+}
+
+func TestRevocation_IsRevoked(t *testing.T) {
+	crl, ca := buildCaAndCrl(t, 42)
+	source := &crlSourceMock{crl: crl, ca: ca}
+	r, err := NewRevocation(source, &StaticRenewal{Decision: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(42)}
+	if _, err := r.Renew(cert); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := r.IsRevoked(cert)
+	if err != nil || !revoked {
+		t.Errorf("IsRevoked() = %v, %v, want true", revoked, err)
+	}
+	if source.fetches != 1 {
+		t.Errorf("expected the crl checked by Renew() to be reused, got %d fetches", source.fetches)
+	}
+
+	// other certificates are checked against the crl again
+	revoked, err = r.IsRevoked(&x509.Certificate{SerialNumber: big.NewInt(43)})
+	if err != nil || revoked {
+		t.Errorf("IsRevoked() = %v, %v, want false", revoked, err)
+	}
+	if source.fetches != 2 {
+		t.Errorf("expected the crl to be fetched again, got %d fetches", source.fetches)
+	}
+}
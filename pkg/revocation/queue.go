@@ -0,0 +1,178 @@
+package revocation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.uber.org/multierr"
+	"golang.org/x/net/context"
+)
+
+// Revoker revokes a certificate by its serial number.
+type Revoker interface {
+	Revoke(ctx context.Context, serial string) error
+}
+
+// Entry is a superseded certificate that is waiting to be revoked.
+type Entry struct {
+	Serial         string    `json:"serial"`
+	CommonName     string    `json:"common_name"`
+	NotAfter       time.Time `json:"not_after"`
+	RevokeAfter    time.Time `json:"revoke_after"`
+	HooksSucceeded bool      `json:"hooks_succeeded"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// IsDue returns whether the entry may be revoked. Certificates are only revoked after the grace period has passed and
+// the post-issue hooks ran successfully, so services that still use the superseded certificate don't break.
+func (e *Entry) IsDue(now time.Time) bool {
+	return e.HooksSucceeded && !now.Before(e.RevokeAfter)
+}
+
+// IsExpired returns whether the certificate is expired and therefore does not need to be revoked anymore.
+func (e *Entry) IsExpired(now time.Time) bool {
+	return now.After(e.NotAfter)
+}
+
+// Queue holds superseded certificates until they are revoked. If a path is given, the queue is persisted to survive
+// restarts.
+type Queue struct {
+	path    string
+	entries []Entry
+	mutex   sync.Mutex
+}
+
+func NewQueue(path string) (*Queue, error) {
+	q := &Queue{path: path}
+	if len(path) == 0 {
+		return q, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return q, nil
+		}
+		return nil, fmt.Errorf("could not read revocation queue '%s': %w", path, err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &q.entries); err != nil {
+			return nil, fmt.Errorf("could not parse revocation queue '%s': %w", path, err)
+		}
+	}
+
+	return q, nil
+}
+
+// Add adds a superseded certificate to the queue. Adding a serial that is already enqueued replaces the entry.
+func (q *Queue) Add(entry Entry) error {
+	if len(entry.Serial) == 0 {
+		return errors.New("empty serial provided")
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i := range q.entries {
+		if q.entries[i].Serial == entry.Serial {
+			q.entries[i] = entry
+			return q.persist()
+		}
+	}
+
+	q.entries = append(q.entries, entry)
+	return q.persist()
+}
+
+// Entries returns a copy of all enqueued entries.
+func (q *Queue) Entries() []Entry {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ret := make([]Entry, len(q.entries))
+	copy(ret, q.entries)
+	return ret
+}
+
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.entries)
+}
+
+// Process revokes all due entries. Entries that have been revoked successfully or whose certificates have expired in
+// the meantime are removed from the queue, failed revocations are retried on the next invocation.
+func (q *Queue) Process(ctx context.Context, revoker Revoker) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	var errs error
+	var remaining []Entry
+	for _, entry := range q.entries {
+		if entry.IsExpired(now) {
+			log.Info().Str("serial", entry.Serial).Msg("Superseded certificate expired, removing it from revocation queue")
+			continue
+		}
+
+		// e.g. this replica lost the leader election, the entry is revoked on the next run
+		if !entry.IsDue(now) || ctx.Err() != nil {
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		if err := revoker.Revoke(ctx, entry.Serial); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			remaining = append(remaining, entry)
+			errs = multierr.Append(errs, fmt.Errorf("could not revoke '%s': %w", entry.Serial, err))
+			continue
+		}
+
+		log.Info().Str("serial", entry.Serial).Msg("Revoked superseded certificate")
+	}
+
+	if err := ctx.Err(); err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("processing revocation queue aborted: %w", err))
+	}
+
+	q.entries = remaining
+	return multierr.Append(errs, q.persist())
+}
+
+func (q *Queue) persist() error {
+	if len(q.path) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(q.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not persist revocation queue: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("could not persist revocation queue: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not persist revocation queue: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), q.path)
+}
@@ -0,0 +1,124 @@
+package revocation
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type revokerMock struct {
+	revoked []string
+	err     error
+}
+
+func (r *revokerMock) Revoke(_ context.Context, serial string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.revoked = append(r.revoked, serial)
+	return nil
+}
+
+func TestQueue_Process(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		entry         Entry
+		canceled      bool
+		revokerErr    error
+		wantErr       bool
+		wantRevoked   bool
+		wantRemaining int
+	}{
+		{
+			name:          "due",
+			entry:         Entry{Serial: "aa", NotAfter: now.Add(time.Hour), RevokeAfter: now.Add(-time.Minute), HooksSucceeded: true},
+			wantRevoked:   true,
+			wantRemaining: 0,
+		},
+		{
+			name:          "grace period not passed",
+			entry:         Entry{Serial: "aa", NotAfter: now.Add(time.Hour), RevokeAfter: now.Add(time.Minute), HooksSucceeded: true},
+			wantRemaining: 1,
+		},
+		{
+			name:          "hooks failed",
+			entry:         Entry{Serial: "aa", NotAfter: now.Add(time.Hour), RevokeAfter: now.Add(-time.Minute), HooksSucceeded: false},
+			wantRemaining: 1,
+		},
+		{
+			name:          "expired",
+			entry:         Entry{Serial: "aa", NotAfter: now.Add(-time.Minute), RevokeAfter: now.Add(-time.Hour), HooksSucceeded: true},
+			wantRemaining: 0,
+		},
+		{
+			name:          "context canceled",
+			entry:         Entry{Serial: "aa", NotAfter: now.Add(time.Hour), RevokeAfter: now.Add(-time.Minute), HooksSucceeded: true},
+			canceled:      true,
+			wantErr:       true,
+			wantRemaining: 1,
+		},
+		{
+			name:          "revocation fails",
+			entry:         Entry{Serial: "aa", NotAfter: now.Add(time.Hour), RevokeAfter: now.Add(-time.Minute), HooksSucceeded: true},
+			revokerErr:    errors.New("vault unavailable"),
+			wantErr:       true,
+			wantRemaining: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewQueue("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Add(tt.entry); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+
+			revoker := &revokerMock{err: tt.revokerErr}
+			if err := q.Process(ctx, revoker); (err != nil) != tt.wantErr {
+				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (len(revoker.revoked) > 0) != tt.wantRevoked {
+				t.Errorf("Process() revoked = %v, wantRevoked %v", revoker.revoked, tt.wantRevoked)
+			}
+			if q.Len() != tt.wantRemaining {
+				t.Errorf("Process() remaining = %d, want %d", q.Len(), tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestQueue_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+
+	q, err := NewQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := Entry{Serial: "aa:bb", NotAfter: time.Now().Add(time.Hour).UTC().Round(time.Second), RevokeAfter: time.Now().Add(time.Hour).UTC().Round(time.Second)}
+	if err := q.Add(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := restored.Entries()
+	if len(entries) != 1 || entries[0] != entry {
+		t.Errorf("NewQueue() restored = %v, want %v", entries, entry)
+	}
+}
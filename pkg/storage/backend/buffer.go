@@ -31,6 +31,17 @@ func (b *BufferPod) Write(data []byte) error {
 	return nil
 }
 
+// WriteRaw writes the data without appending a trailing newline.
+func (b *BufferPod) WriteRaw(data []byte) error {
+	b.Data = data
+	return nil
+}
+
+func (b *BufferPod) Clear() error {
+	b.Data = nil
+	return nil
+}
+
 func (b *BufferPod) CanWrite() error {
 	return nil
 }
@@ -9,26 +9,42 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"syscall"
 
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
 
 	"golang.org/x/sys/unix"
 )
 
 type FilesystemStorage struct {
-	FilePath  string
+	// FilePath is the path of the file. If it is a symlink, the file it points to is replaced and the link is kept.
+	FilePath string
+	// FileOwner and FileGroup are applied to the file on each write. If nil, the owner of an existing file is kept.
 	FileOwner *int
 	FileGroup *int
-	Mode      os.FileMode
+	// Mode is applied to the file on each write. If 0, the mode of an existing file is kept and new files are created
+	// with mode 0600.
+	Mode os.FileMode
+	// Backups is the number of previous versions of the file that are kept as '<file>.1' (the most recent) to
+	// '<file>.N'. If 0, no backups are kept.
+	Backups int
 }
 
 const (
-	FsScheme   = "file"
-	ParamChmod = "chmod"
+	FsScheme     = "file"
+	ParamChmod   = "chmod"
+	ParamBackups = "backups"
 )
 
-var defaultMode os.FileMode = 0600
+var (
+	defaultMode    os.FileMode = 0600
+	defaultBackups             = 1
+)
+
+// ErrNoBackup is returned when rolling back a file without a backup.
+var ErrNoBackup = errors.New("no backup found")
 
 func NewFilesystemStorageFromUri(uri string) (*FilesystemStorage, error) {
 	parsed, err := url.Parse(uri)
@@ -53,7 +69,8 @@ func NewFilesystemStorageFromUri(uri string) (*FilesystemStorage, error) {
 		}
 	}
 
-	mode := defaultMode
+	var mode os.FileMode
+	backups := defaultBackups
 	params, err := url.ParseQuery(parsed.RawQuery)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse queries")
@@ -70,9 +87,20 @@ func NewFilesystemStorageFromUri(uri string) (*FilesystemStorage, error) {
 				return nil, fmt.Errorf("invalid file mode supplied: %v", val[0])
 			}
 		}
+		if key == ParamBackups {
+			backups, err = strconv.Atoi(val[0])
+			if err != nil || backups < 0 {
+				return nil, fmt.Errorf("invalid value for 'backups' param: %v", val)
+			}
+		}
 	}
 
-	return newFilesystemStorage(path, username, pass, mode)
+	ret, err := newFilesystemStorage(path, username, pass, mode)
+	if err != nil {
+		return nil, err
+	}
+	ret.Backups = backups
+	return ret, nil
 }
 
 func expandHomeDir(parsed *url.URL) (string, error) {
@@ -149,27 +177,307 @@ func (fs *FilesystemStorage) CanRead() error {
 	return err
 }
 
+// Write replaces the file atomically: the data is written to a temporary file in the same directory which is
+// renamed to the actual file after its permissions have been set and it has been synced to disk. Readers therefore
+// either see the previous or the new version, even after a crash or if the disk is full.
 func (fs *FilesystemStorage) Write(signedData []byte) error {
+	return commit(fs.Stage(signedData))
+}
+
+// WriteRaw replaces the file atomically like Write, but without appending a trailing newline, e.g. for DER encoded
+// data.
+func (fs *FilesystemStorage) WriteRaw(data []byte) error {
+	return commit(fs.stage(data))
+}
+
+func commit(staged pki.StagedWrite, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if err := staged.Commit(); err != nil {
+		_ = staged.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// Stage writes the data to a temporary file next to the actual file, which replaces the actual file on commit.
+func (fs *FilesystemStorage) Stage(signedData []byte) (pki.StagedWrite, error) {
 	if len(signedData) == 0 || signedData[len(signedData)-1] != '\n' {
 		signedData = append(signedData, '\n')
 	}
 
-	err := os.WriteFile(fs.FilePath, signedData, fs.Mode)
+	staged, err := fs.stage(signedData)
+	if err != nil {
+		return nil, err
+	}
+	return staged, nil
+}
+
+func (fs *FilesystemStorage) stage(data []byte) (*fileStagedWrite, error) {
+	path := fs.resolvePath()
+	ret := &fileStagedWrite{fs: fs, path: path}
+	previous, err := os.ReadFile(path)
+	if err == nil {
+		ret.previous = previous
+		ret.hasPrevious = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read file '%s': %v", fs.FilePath, err)
+	}
+
+	var existing os.FileInfo
+	if ret.hasPrevious {
+		if existing, err = os.Stat(path); err != nil {
+			return nil, fmt.Errorf("could not stat file '%s': %v", fs.FilePath, err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
 	if err != nil {
+		return nil, fmt.Errorf("could not create temporary file for '%s': %v", fs.FilePath, err)
+	}
+	ret.tmpPath = tmp.Name()
+
+	if err := fs.writeTemp(tmp, data, existing); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(ret.tmpPath)
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (fs *FilesystemStorage) writeTemp(tmp *os.File, data []byte, existing os.FileInfo) error {
+	if err := fs.applyPermissions(tmp, existing); err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
 		return fmt.Errorf("could not write file '%s' to disk: %v", fs.FilePath, err)
 	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("could not sync file '%s' to disk: %v", fs.FilePath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write file '%s' to disk: %v", fs.FilePath, err)
+	}
+
+	return nil
+}
+
+type fileStagedWrite struct {
+	fs *FilesystemStorage
+	// path is the resolved path of the file
+	path        string
+	tmpPath     string
+	previous    []byte
+	hasPrevious bool
+	committed   bool
+}
+
+func (w *fileStagedWrite) Commit() error {
+	if err := w.fs.backup(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(w.tmpPath, w.path); err != nil {
+		return fmt.Errorf("could not replace file '%s': %v", w.fs.FilePath, err)
+	}
+	w.committed = true
+
+	return syncDir(filepath.Dir(w.path))
+}
+
+func (w *fileStagedWrite) Rollback() error {
+	if !w.committed {
+		if err := os.Remove(w.tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove temporary file '%s': %v", w.tmpPath, err)
+		}
+		return nil
+	}
+
+	if !w.hasPrevious {
+		if err := os.Remove(w.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove file '%s': %v", w.fs.FilePath, err)
+		}
+		return syncDir(filepath.Dir(w.path))
+	}
+
+	// the commit rotated the backups, restoring the most recent backup also reverts the rotation
+	if w.fs.Backups > 0 {
+		return w.fs.Rollback()
+	}
+
+	noBackups := *w.fs
+	noBackups.Backups = 0
+	restore, err := noBackups.stage(w.previous)
+	if err != nil {
+		return err
+	}
+	if err := restore.Commit(); err != nil {
+		_ = restore.Rollback()
+		return err
+	}
+	return nil
+}
+
+// applyPermissions applies the configured mode and owner to the file. Whatever is not configured is copied from the
+// existing file, if any.
+func (fs *FilesystemStorage) applyPermissions(file *os.File, existing os.FileInfo) error {
+	mode := fs.Mode
+	if mode == 0 {
+		mode = defaultMode
+		if existing != nil {
+			mode = existing.Mode().Perm()
+		}
+	}
+	if err := file.Chmod(mode); err != nil {
+		return fmt.Errorf("could not chmod file '%s': %v", fs.FilePath, err)
+	}
 
 	if fs.FileOwner != nil && fs.FileGroup != nil {
-		err = os.Chown(fs.FilePath, *fs.FileOwner, *fs.FileGroup)
-		if err != nil {
+		if err := file.Chown(*fs.FileOwner, *fs.FileGroup); err != nil {
 			return fmt.Errorf("could not chown file '%s': %v", fs.FilePath, err)
 		}
+		return nil
+	}
+
+	if existing == nil {
+		return nil
+	}
+	if stat, ok := existing.Sys().(*syscall.Stat_t); ok {
+		// unprivileged users may not be able to hand the file to its previous owner, the write itself succeeds anyway
+		if err := file.Chown(int(stat.Uid), int(stat.Gid)); err != nil {
+			log.Warn().Err(err).Msgf("could not keep owner %d:%d of file '%s'", stat.Uid, stat.Gid, fs.FilePath)
+		}
 	}
 
 	return nil
 }
 
+// resolvePath returns the path of the file a symlink points to, so writes replace the file instead of the link.
+func (fs *FilesystemStorage) resolvePath() string {
+	resolved, err := filepath.EvalSymlinks(fs.FilePath)
+	if err != nil {
+		return fs.FilePath
+	}
+	return resolved
+}
+
+func (fs *FilesystemStorage) backupPath(generation int) string {
+	return fs.resolvePath() + "." + strconv.Itoa(generation)
+}
+
+// backup rotates the existing backups and keeps the current file as the most recent backup. The current file is
+// backed up even if its content does not change, so the backups of all files of a keypair stay in lockstep.
+func (fs *FilesystemStorage) backup() error {
+	if fs.Backups <= 0 {
+		return nil
+	}
+
+	path := fs.resolvePath()
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("could not stat file '%s': %v", fs.FilePath, err)
+	}
+
+	for generation := fs.Backups - 1; generation >= 1; generation-- {
+		err := os.Rename(fs.backupPath(generation), fs.backupPath(generation+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not rotate backup of file '%s': %v", fs.FilePath, err)
+		}
+	}
+
+	latest := fs.backupPath(1)
+	if err := os.Remove(latest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove backup '%s': %v", latest, err)
+	}
+
+	// a hard link keeps the current file in place until it is replaced
+	if err := os.Link(path, latest); err != nil {
+		if err := fs.copyFile(path, latest); err != nil {
+			return fmt.Errorf("could not backup file '%s': %v", fs.FilePath, err)
+		}
+	}
+
+	return nil
+}
+
+func (fs *FilesystemStorage) copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	existing, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, defaultMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := fs.applyPermissions(file, existing); err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// HasBackup returns whether a previous version of the file is available to roll back to.
+func (fs *FilesystemStorage) HasBackup() bool {
+	_, err := os.Stat(fs.backupPath(1))
+	return err == nil
+}
+
+// Rollback atomically replaces the file with its most recent backup and shifts the older backups accordingly. The
+// current version of the file is discarded.
+func (fs *FilesystemStorage) Rollback() error {
+	if !fs.HasBackup() {
+		return fmt.Errorf("could not roll back file '%s': %w", fs.FilePath, ErrNoBackup)
+	}
+
+	path := fs.resolvePath()
+	if err := os.Rename(fs.backupPath(1), path); err != nil {
+		return fmt.Errorf("could not roll back file '%s': %v", fs.FilePath, err)
+	}
+
+	for generation := 2; ; generation++ {
+		err := os.Rename(fs.backupPath(generation), fs.backupPath(generation-1))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not rotate backup of file '%s': %v", fs.FilePath, err)
+		}
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir persists the directory entries, e.g. after a file has been renamed.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not open directory '%s': %v", dir, err)
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("could not sync directory '%s': %v", dir, err)
+	}
+	return nil
+}
+
 func (fs *FilesystemStorage) CanWrite() error {
-	dir := filepath.Dir(fs.FilePath)
+	dir := filepath.Dir(fs.resolvePath())
 	return unix.Access(dir, unix.W_OK)
 }
@@ -1,8 +1,10 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
@@ -33,7 +35,7 @@ func TestNewFilesystemStorageFromUri(t *testing.T) {
 				FilePath:  "/home/soeren/.certs/cert.pem",
 				FileOwner: nil,
 				FileGroup: nil,
-				Mode:      defaultMode,
+				Backups:   defaultBackups,
 			},
 			wantErr: false,
 		},
@@ -45,9 +47,24 @@ func TestNewFilesystemStorageFromUri(t *testing.T) {
 				FileOwner: nil,
 				FileGroup: nil,
 				Mode:      os.FileMode(0755),
+				Backups:   defaultBackups,
 			},
 			wantErr: false,
 		},
+		{
+			name: "Backups",
+			uri:  "file:///home/soeren/.certs/cert.pem?backups=3",
+			want: &FilesystemStorage{
+				FilePath: "/home/soeren/.certs/cert.pem",
+				Backups:  3,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid backups",
+			uri:     "file:///home/soeren/.certs/cert.pem?backups=-1",
+			wantErr: true,
+		},
 		{
 			name: "With user and group",
 			uri:  fmt.Sprintf("file://root:%s@/home/soeren/.certs/cert.pem", getOsDependendGroup()),
@@ -55,7 +72,7 @@ func TestNewFilesystemStorageFromUri(t *testing.T) {
 				FilePath:  "/home/soeren/.certs/cert.pem",
 				FileOwner: getLiteral(0),
 				FileGroup: getLiteral(0),
-				Mode:      defaultMode,
+				Backups:   defaultBackups,
 			},
 			wantErr: false,
 		},
@@ -73,3 +90,254 @@ func TestNewFilesystemStorageFromUri(t *testing.T) {
 		})
 	}
 }
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFilesystemStorage_WriteBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cert.pem")
+	fs := &FilesystemStorage{FilePath: path, Mode: 0640, Backups: 2}
+
+	for _, data := range []string{"first", "second", "third", "fourth"} {
+		if err := fs.Write([]byte(data)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	if got := readFile(t, path); got != "fourth\n" {
+		t.Errorf("current = %q", got)
+	}
+	if got := readFile(t, path+".1"); got != "third\n" {
+		t.Errorf("backup 1 = %q", got)
+	}
+	if got := readFile(t, path+".2"); got != "second\n" {
+		t.Errorf("backup 2 = %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected no leftover temporary files, got %d entries", len(entries))
+	}
+}
+
+func TestFilesystemStorage_WriteKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	fs := &FilesystemStorage{FilePath: path}
+
+	if err := fs.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != defaultMode {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), defaultMode)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want mode of the existing file %v", info.Mode().Perm(), os.FileMode(0644))
+	}
+}
+
+func TestFilesystemStorage_WriteSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "cert.pem")
+	link := filepath.Join(dir, "current.pem")
+	if err := os.WriteFile(target, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &FilesystemStorage{FilePath: link, Backups: 1}
+	if err := fs.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected symlink to be kept, got %v", err)
+	}
+	if got := readFile(t, target); got != "second\n" {
+		t.Errorf("target = %q", got)
+	}
+	if got := readFile(t, target+".1"); got != "first\n" {
+		t.Errorf("backup = %q", got)
+	}
+
+	if err := fs.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, link); got != "first\n" {
+		t.Errorf("after rollback = %q", got)
+	}
+}
+
+func TestFilesystemStorage_Rollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	fs := &FilesystemStorage{FilePath: path, Mode: defaultMode, Backups: 3}
+
+	if err := fs.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if fs.HasBackup() {
+		t.Error("no backup expected after first write")
+	}
+	if err := fs.Rollback(); !errors.Is(err, ErrNoBackup) {
+		t.Errorf("Rollback() error = %v, want %v", err, ErrNoBackup)
+	}
+
+	for _, data := range []string{"second", "third"} {
+		if err := fs.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fs.Rollback(); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("current after rollback = %q", got)
+	}
+	if got := readFile(t, path+".1"); got != "first\n" {
+		t.Errorf("backup 1 after rollback = %q", got)
+	}
+
+	if err := fs.Rollback(); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := readFile(t, path); got != "first\n" {
+		t.Errorf("current after second rollback = %q", got)
+	}
+	if fs.HasBackup() {
+		t.Error("no backup expected after rolling back all versions")
+	}
+}
+
+func TestFilesystemStorage_WriteWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	fs := &FilesystemStorage{FilePath: path, Mode: defaultMode}
+
+	for _, data := range []string{"first", "second"} {
+		if err := fs.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fs.HasBackup() {
+		t.Error("no backup expected")
+	}
+}
+
+func TestFilesystemStorage_WriteRaw(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem.ocsp")
+	fs := &FilesystemStorage{FilePath: path, Mode: defaultMode}
+
+	der := []byte{0x30, 0x82, 0x01, 0x0a}
+	if err := fs.WriteRaw(der); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fs.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, der) {
+		t.Errorf("Read() = %v, want %v", got, der)
+	}
+
+	// pem encoded data still receives a trailing newline, even if it contains control characters
+	if err := fs.Write([]byte("data\x01")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fs.Read(); string(got) != "data\x01\n" {
+		t.Errorf("Read() = %q, want trailing newline", got)
+	}
+}
+
+func TestFilesystemStorage_StageRollback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cert.pem")
+	fs := &FilesystemStorage{FilePath: path, Mode: defaultMode}
+
+	// rolling back a committed write without previous data removes the file
+	staged, err := fs.Stage([]byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected file to be removed, got %v", err)
+	}
+
+	if err := fs.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// rolling back an uncommitted write discards the temporary file
+	staged, err = fs.Stage([]byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "first\n" {
+		t.Errorf("current = %q", got)
+	}
+
+	// rolling back a committed write restores the previous data
+	staged, err = fs.Stage([]byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("current = %q", got)
+	}
+	if err := staged.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "first\n" {
+		t.Errorf("current after rollback = %q", got)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no leftover temporary files, got %d entries", len(entries))
+	}
+}
@@ -3,6 +3,7 @@ package shape
 import (
 	"fmt"
 
+	"github.com/soerenschneider/vault-pki-cli/pkg"
 	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
 )
 
@@ -16,6 +17,14 @@ func NewCrlStorage(storage pki.StorageImplementation) (*CrlStorage, error) {
 	}, nil
 }
 
+func (out *CrlStorage) ReadCrl() ([]byte, error) {
+	if out.storage == nil {
+		return nil, pkg.ErrNoCertFound
+	}
+
+	return out.storage.Read()
+}
+
 func (out *CrlStorage) WriteCrl(crlData []byte) error {
 	if out.storage == nil {
 		fmt.Println(string(crlData))
@@ -2,14 +2,21 @@ package shape
 
 import (
 	"bytes"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
 	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
 )
 
+// ErrNoBackup is returned when rolling back a keypair without a previous version.
+var ErrNoBackup = errors.New("no previous version of the keypair found")
+
 // KeyPairStorage offers an interface to read/write keypair data (certificate and private key) and optional ca data.
 type KeyPairStorage struct {
 	ca         pki.StorageImplementation
@@ -17,6 +24,12 @@ type KeyPairStorage struct {
 	privateKey pki.StorageImplementation
 }
 
+// RollbackStorage is implemented by storage implementations that keep previous versions of the data.
+type RollbackStorage interface {
+	HasBackup() bool
+	Rollback() error
+}
+
 func NewKeyPairStorage(cert, privateKey, chain pki.StorageImplementation) (*KeyPairStorage, error) {
 	if nil == privateKey {
 		return nil, errors.New("empty private key storage provided")
@@ -42,30 +55,42 @@ func (f *KeyPairStorage) ReadCert() (*x509.Certificate, error) {
 }
 
 func (f *KeyPairStorage) WriteCert(certData *pkg.CertData) error {
+	writes, err := f.writes(certData)
+	if err != nil {
+		return err
+	}
+
+	tx := &transaction{writes: writes}
+	return tx.run()
+}
+
+// writes returns the data to write to each slot of the keypair.
+func (f *KeyPairStorage) writes(certData *pkg.CertData) ([]slotWrite, error) {
 	if nil == certData {
-		return errors.New("got nil as certData")
+		return nil, errors.New("got nil as certData")
 	}
 
 	// case 1: write cert, ca and private key to same storage
 	if f.cert == nil && f.ca == nil {
-		return f.writeToPrivateSlot(certData)
+		return f.privateSlotWrites(certData), nil
 	}
 
 	// case 2: write cert and private to a same storage, write ca (if existent) to dedicated storage
 	if f.cert == nil && f.ca != nil {
-		return f.writeToCertAndCaSlot(certData)
+		return f.certAndCaSlotWrites(certData), nil
 	}
 
 	// case 3: write to individual storage
-	return f.writeToIndividualSlots(certData)
+	return f.individualSlotWrites(certData), nil
 }
 
 func endsWithNewline(data []byte) bool {
 	return bytes.HasSuffix(data, []byte("\n"))
 }
 
-func (f *KeyPairStorage) writeToPrivateSlot(certData *pkg.CertData) error {
-	var data = certData.Certificate
+func (f *KeyPairStorage) privateSlotWrites(certData *pkg.CertData) []slotWrite {
+	// copy the data, the writes of multiple keypairs are built before writing any of them
+	var data = bytes.Clone(certData.Certificate)
 	if !endsWithNewline(data) {
 		data = append(data, "\n"...)
 	}
@@ -78,11 +103,12 @@ func (f *KeyPairStorage) writeToPrivateSlot(certData *pkg.CertData) error {
 	}
 
 	data = append(data, certData.PrivateKey...)
-	return f.privateKey.Write(data)
+	return []slotWrite{{storage: f.privateKey, data: data}}
 }
 
-func (f *KeyPairStorage) writeToCertAndCaSlot(certData *pkg.CertData) error {
-	var data = certData.Certificate
+func (f *KeyPairStorage) certAndCaSlotWrites(certData *pkg.CertData) []slotWrite {
+	// copy the data, the writes of multiple keypairs are built before writing any of them
+	var data = bytes.Clone(certData.Certificate)
 	if !endsWithNewline(data) {
 		data = append(data, "\n"...)
 	}
@@ -92,19 +118,16 @@ func (f *KeyPairStorage) writeToCertAndCaSlot(certData *pkg.CertData) error {
 		data = append(data, "\n"...)
 	}
 
-	if err := f.privateKey.Write(data); err != nil {
-		return err
-	}
-
+	writes := []slotWrite{{storage: f.privateKey, data: data}}
 	if certData.HasCaData() {
-		caData := certData.CaData
+		caData := bytes.Clone(certData.CaData)
 		if !endsWithNewline(caData) {
 			caData = append(caData, "\n"...)
 		}
-		return f.ca.Write(caData)
+		writes = append(writes, slotWrite{storage: f.ca, data: caData})
 	}
 
-	return nil
+	return writes
 }
 
 var lineBreaksRegex = regexp.MustCompile(`(\r\n?|\n){2,}`)
@@ -114,8 +137,8 @@ func fixLineBreaks(input []byte) (ret []byte) {
 	return
 }
 
-func (f *KeyPairStorage) writeToIndividualSlots(certData *pkg.CertData) error {
-	var certRaw = certData.Certificate
+func (f *KeyPairStorage) individualSlotWrites(certData *pkg.CertData) []slotWrite {
+	var certRaw = bytes.Clone(certData.Certificate)
 	if certData.HasCaData() && f.ca == nil {
 		if !endsWithNewline(certRaw) {
 			certRaw = append(certRaw, "\n"...)
@@ -124,19 +147,138 @@ func (f *KeyPairStorage) writeToIndividualSlots(certData *pkg.CertData) error {
 		certRaw = append(certRaw, certData.CaData...)
 	}
 
-	if err := f.cert.Write(certRaw); err != nil {
-		return err
-	}
+	writes := []slotWrite{{storage: f.cert, data: certRaw}}
 
 	if certData.HasCaData() && f.ca != nil {
-		if err := f.ca.Write(certData.CaData); err != nil {
-			return err
-		}
+		writes = append(writes, slotWrite{storage: f.ca, data: certData.CaData})
 	}
 
 	if certData.HasPrivateKey() {
-		return f.privateKey.Write(fixLineBreaks(certData.PrivateKey))
+		writes = append(writes, slotWrite{storage: f.privateKey, data: fixLineBreaks(certData.PrivateKey)})
+	}
+
+	return writes
+}
+
+// Rollback restores the previous version of the keypair. All configured slots need to support rolling back and need
+// to have a backup, otherwise no slot is rolled back, preventing a mismatching certificate and private key.
+func (f *KeyPairStorage) Rollback() error {
+	var slots []RollbackStorage
+	for _, impl := range []pki.StorageImplementation{f.cert, f.privateKey, f.ca} {
+		if impl == nil {
+			continue
+		}
+
+		slot, ok := impl.(RollbackStorage)
+		if !ok {
+			return fmt.Errorf("storage %T does not support rolling back", impl)
+		}
+		if !slot.HasBackup() {
+			return ErrNoBackup
+		}
+		slots = append(slots, slot)
+	}
+
+	for _, slot := range slots {
+		if err := slot.Rollback(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// keyPairData is the raw data of the slots of a keypair.
+type keyPairData struct {
+	cert       *x509.Certificate
+	certRaw    []byte
+	privateKey []byte
+	ca         []byte
+}
+
+// readKeyPair reads the data of all slots of the keypair.
+func (f *KeyPairStorage) readKeyPair() (*keyPairData, error) {
+	ret := &keyPairData{}
+
+	var err error
+	ret.privateKey, err = f.privateKey.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	ret.certRaw = ret.privateKey
+	if f.cert != nil {
+		ret.certRaw, err = f.cert.Read()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.ca != nil {
+		ret.ca, err = f.ca.Read()
+		if err != nil && !errors.Is(err, pkg.ErrNoCertFound) {
+			return nil, err
+		}
+	}
+
+	ret.cert, err = pkg.ParseCertPem(ret.certRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// keyMatches returns whether the private key belongs to the certificate.
+func (d *keyPairData) keyMatches() bool {
+	_, err := tls.X509KeyPair(d.certRaw, d.privateKey)
+	return err == nil
+}
+
+// certData splits the raw data into the certificate, the ca chain and the private key, so it can be written to
+// storages using a different layout.
+func (d *keyPairData) certData() (*pkg.CertData, error) {
+	ret := &pkg.CertData{CaData: d.ca}
+
+	var chain []byte
+	rest := d.certRaw
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if ret.Certificate == nil {
+			ret.Certificate = pem.EncodeToMemory(block)
+		} else {
+			chain = append(chain, pem.EncodeToMemory(block)...)
+		}
+	}
+
+	// the chain is only part of the cert data if no dedicated ca slot exists
+	if len(ret.CaData) == 0 {
+		ret.CaData = chain
+	}
+
+	rest = d.privateKey
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			ret.PrivateKey = pem.EncodeToMemory(block)
+			break
+		}
+	}
+
+	if ret.Certificate == nil || ret.PrivateKey == nil {
+		return nil, errors.New("could not find certificate and private key")
+	}
+
+	return ret, nil
+}
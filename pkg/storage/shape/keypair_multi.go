@@ -2,43 +2,202 @@ package shape
 
 import (
 	"crypto/x509"
+	"fmt"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/vault-pki-cli/pkg"
 	"go.uber.org/multierr"
 )
 
+// MultiKeyPairStorage writes the keypair to multiple sinks all-or-nothing: if writing to any sink fails, the sinks
+// that have been written already are rolled back.
 type MultiKeyPairStorage struct {
-	sinks []*KeyPairStorage
+	sinks         []*KeyPairStorage
+	parallel      bool
+	statusHandler func([]SinkStatus)
 }
 
-func NewMultiKeyPairSink(sinks ...*KeyPairStorage) (*MultiKeyPairStorage, error) {
+// SinkStatus describes the keypair that is stored in a single sink.
+type SinkStatus struct {
+	// Index is the position of the sink in the storage config.
+	Index int
+	// Cert is the certificate stored in the sink, nil if it could not be read.
+	Cert *x509.Certificate
+	// KeyMatches is true if the private key stored in the sink belongs to the certificate.
+	KeyMatches bool
+	// Stale is true if the sink does not contain the newest valid keypair of all sinks.
+	Stale bool
+	Err   error
+}
+
+type MultiKeyPairStorageOpts func(*MultiKeyPairStorage)
+
+// WithParallelWrites writes to all sinks in parallel, e.g. to speed up writing to many remote sinks.
+func WithParallelWrites(parallel bool) MultiKeyPairStorageOpts {
+	return func(f *MultiKeyPairStorage) {
+		f.parallel = parallel
+	}
+}
+
+// WithStatusHandler calls the handler with the status of all sinks each time the certificate is read, e.g. to update
+// metrics.
+func WithStatusHandler(handler func([]SinkStatus)) MultiKeyPairStorageOpts {
+	return func(f *MultiKeyPairStorage) {
+		f.statusHandler = handler
+	}
+}
+
+func NewMultiKeyPairSink(sinks []*KeyPairStorage, opts ...MultiKeyPairStorageOpts) (*MultiKeyPairStorage, error) {
 	if nil == sinks {
 		return nil, errors.New("no sinks provided")
 	}
 
-	return &MultiKeyPairStorage{sinks: sinks}, nil
+	ret := &MultiKeyPairStorage{sinks: sinks}
+	for _, opt := range opts {
+		opt(ret)
+	}
+
+	return ret, nil
 }
 
 func (f *MultiKeyPairStorage) WriteCert(certData *pkg.CertData) error {
-	var err error
+	var writes []slotWrite
 	for _, sink := range f.sinks {
-		writeErr := sink.WriteCert(certData)
-		if writeErr != nil {
-			err = multierr.Append(err, writeErr)
+		sinkWrites, err := sink.writes(certData)
+		if err != nil {
+			return err
 		}
+		writes = append(writes, sinkWrites...)
 	}
 
-	return err
+	tx := &transaction{writes: writes, parallel: f.parallel}
+	return tx.run()
 }
 
+// ReadCert reads the certificates of all sinks and returns the newest certificate whose private key matches. Sinks that
+// diverge from it are logged. If no sink contains a matching private key, the newest readable certificate is returned.
 func (f *MultiKeyPairStorage) ReadCert() (*x509.Certificate, error) {
-	for _, sink := range f.sinks {
-		cert, err := sink.ReadCert()
-		if err == nil {
-			return cert, err
+	statuses, _ := f.inspect()
+	if f.statusHandler != nil {
+		f.statusHandler(statuses)
+	}
+
+	newest := newestValid(statuses)
+	for _, status := range statuses {
+		if newest != nil && status.Stale {
+			log.Warn().Err(status.Err).Bool("key_matches", status.KeyMatches).Msgf("Sink %d diverges from the newest certificate %s", status.Index, pkg.FormatSerial(newest.Cert.SerialNumber))
+		}
+	}
+	if newest != nil {
+		return newest.Cert, nil
+	}
+
+	var newestReadable *x509.Certificate
+	for _, status := range statuses {
+		if status.Cert != nil && (newestReadable == nil || isNewer(status.Cert, newestReadable)) {
+			newestReadable = status.Cert
+		}
+	}
+	if newestReadable != nil {
+		log.Warn().Msg("No sink contains a private key matching its certificate")
+		return newestReadable, nil
+	}
+
+	for _, status := range statuses {
+		if status.Err != nil && !errors.Is(status.Err, pkg.ErrNoCertFound) {
+			return nil, fmt.Errorf("could not read any cert: %w", status.Err)
+		}
+	}
+	return nil, pkg.ErrNoCertFound
+}
+
+// Inspect reads and compares the keypairs of all sinks.
+func (f *MultiKeyPairStorage) Inspect() []SinkStatus {
+	statuses, _ := f.inspect()
+	return statuses
+}
+
+func (f *MultiKeyPairStorage) inspect() ([]SinkStatus, []*keyPairData) {
+	statuses := make([]SinkStatus, len(f.sinks))
+	data := make([]*keyPairData, len(f.sinks))
+	for index, sink := range f.sinks {
+		statuses[index].Index = index
+		keyPair, err := sink.readKeyPair()
+		if err != nil {
+			statuses[index].Err = err
+			continue
+		}
+
+		data[index] = keyPair
+		statuses[index].Cert = keyPair.cert
+		statuses[index].KeyMatches = keyPair.keyMatches()
+	}
+
+	newest := newestValid(statuses)
+	for index := range statuses {
+		statuses[index].Stale = newest == nil || !statuses[index].KeyMatches || statuses[index].Cert == nil ||
+			statuses[index].Cert.SerialNumber.Cmp(newest.Cert.SerialNumber) != 0
+	}
+
+	return statuses, data
+}
+
+// Sync rewrites all stale sinks using the newest valid keypair of all sinks and returns the number of rewritten sinks.
+func (f *MultiKeyPairStorage) Sync() (int, error) {
+	statuses, data := f.inspect()
+	if f.statusHandler != nil {
+		defer func() {
+			f.statusHandler(f.Inspect())
+		}()
+	}
+
+	newest := newestValid(statuses)
+	if newest == nil {
+		return 0, errors.New("no sink contains a valid keypair")
+	}
+
+	certData, err := data[newest.Index].certData()
+	if err != nil {
+		return 0, fmt.Errorf("could not read keypair of sink %d: %w", newest.Index, err)
+	}
+
+	synced := 0
+	var errs error
+	for _, status := range statuses {
+		if !status.Stale {
+			continue
 		}
+
+		if err := f.sinks[status.Index].WriteCert(certData); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not write sink %d: %w", status.Index, err))
+			continue
+		}
+		log.Info().Msgf("Synced sink %d from sink %d, serial %s", status.Index, newest.Index, pkg.FormatSerial(newest.Cert.SerialNumber))
+		synced++
 	}
 
-	return nil, errors.New("could not read any cert")
+	return synced, errs
+}
+
+// newestValid returns the status of the sink with the newest certificate whose private key matches.
+func newestValid(statuses []SinkStatus) *SinkStatus {
+	var ret *SinkStatus
+	for index := range statuses {
+		status := &statuses[index]
+		if status.Cert == nil || !status.KeyMatches {
+			continue
+		}
+		if ret == nil || isNewer(status.Cert, ret.Cert) {
+			ret = status
+		}
+	}
+	return ret
+}
+
+func isNewer(cert, other *x509.Certificate) bool {
+	if !cert.NotBefore.Equal(other.NotBefore) {
+		return cert.NotBefore.After(other.NotBefore)
+	}
+	return cert.NotAfter.After(other.NotAfter)
 }
@@ -0,0 +1,133 @@
+package shape
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/vault-pki-cli/internal/testutil"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/storage/backend"
+)
+
+func buildMultiStorage(t *testing.T, count int) (*MultiKeyPairStorage, []*KeyPairStorage) {
+	t.Helper()
+	sinks := make([]*KeyPairStorage, count)
+	for index := range sinks {
+		sink, err := NewKeyPairStorage(&backend.BufferPod{}, &backend.BufferPod{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sinks[index] = sink
+	}
+
+	storage, err := NewMultiKeyPairSink(sinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage, sinks
+}
+
+func TestMultiKeyPairStorage_Inspect(t *testing.T) {
+	storage, sinks := buildMultiStorage(t, 4)
+
+	now := time.Now().Truncate(time.Second)
+	old := testutil.NewCertWithSerial(t, 1, now.Add(-time.Hour), now.Add(23*time.Hour), nil).CertData(t, nil)
+	newest := testutil.NewCertWithSerial(t, 2, now, now.Add(24*time.Hour), nil).CertData(t, nil)
+	mismatch := testutil.NewCertWithSerial(t, 3, now.Add(time.Hour), now.Add(25*time.Hour), nil).CertData(t, nil)
+	mismatch.PrivateKey = old.PrivateKey
+
+	for index, certData := range []*pkg.CertData{old, newest, mismatch} {
+		if err := sinks[index].WriteCert(certData); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses := storage.Inspect()
+	want := []struct {
+		serial     int64
+		keyMatches bool
+		stale      bool
+		readable   bool
+	}{
+		{1, true, true, true},
+		{2, true, false, true},
+		{3, false, true, true},
+		{0, false, true, false},
+	}
+
+	for index, tc := range want {
+		status := statuses[index]
+		if (status.Cert != nil) != tc.readable {
+			t.Fatalf("sink %d: readable = %t, want %t, err = %v", index, status.Cert != nil, tc.readable, status.Err)
+		}
+		if tc.readable && status.Cert.SerialNumber.Int64() != tc.serial {
+			t.Errorf("sink %d: serial = %d, want %d", index, status.Cert.SerialNumber.Int64(), tc.serial)
+		}
+		if status.KeyMatches != tc.keyMatches {
+			t.Errorf("sink %d: KeyMatches = %t, want %t", index, status.KeyMatches, tc.keyMatches)
+		}
+		if status.Stale != tc.stale {
+			t.Errorf("sink %d: Stale = %t, want %t", index, status.Stale, tc.stale)
+		}
+	}
+
+	// the newest certificate with a matching key wins, the newer certificate of sink 2 has the wrong key
+	cert, err := storage.ReadCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Int64() != 2 {
+		t.Errorf("ReadCert() serial = %d, want 2", cert.SerialNumber.Int64())
+	}
+}
+
+func TestMultiKeyPairStorage_Sync(t *testing.T) {
+	storage, sinks := buildMultiStorage(t, 3)
+
+	var handled []SinkStatus
+	WithStatusHandler(func(statuses []SinkStatus) {
+		handled = statuses
+	})(storage)
+
+	now := time.Now().Truncate(time.Second)
+	if err := sinks[0].WriteCert(testutil.NewCertWithSerial(t, 1, now.Add(-time.Hour), now.Add(23*time.Hour), nil).CertData(t, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sinks[1].WriteCert(testutil.NewCertWithSerial(t, 2, now, now.Add(24*time.Hour), nil).CertData(t, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	synced, err := storage.Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if synced != 2 {
+		t.Errorf("Sync() = %d, want 2", synced)
+	}
+
+	if len(handled) != 3 {
+		t.Fatalf("expected status handler to be called with all sinks, got %v", handled)
+	}
+	for _, status := range handled {
+		if status.Stale || !status.KeyMatches || status.Cert.SerialNumber.Int64() != 2 {
+			t.Errorf("sink %d not repaired: %+v", status.Index, status)
+		}
+	}
+
+	// nothing left to repair
+	synced, err = storage.Sync()
+	if err != nil || synced != 0 {
+		t.Errorf("Sync() = %d, %v, want 0, nil", synced, err)
+	}
+}
+
+func TestMultiKeyPairStorage_SyncNoValidKeyPair(t *testing.T) {
+	storage, _ := buildMultiStorage(t, 2)
+
+	if _, err := storage.Sync(); err == nil {
+		t.Error("expected error if no sink contains a valid keypair")
+	}
+	if _, err := storage.ReadCert(); err == nil {
+		t.Error("expected error if no sink contains a certificate")
+	}
+}
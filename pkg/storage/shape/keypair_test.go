@@ -1,7 +1,10 @@
 package shape
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -84,7 +87,7 @@ func TestKeyPairSink_WriteCert(t *testing.T) {
 	}
 }
 
-func TestKeyPairSink_writeToIndividualSlots(t *testing.T) {
+func TestKeyPairSink_WriteCertIndividualSlots(t *testing.T) {
 	type fields struct {
 		ca         pki.StorageImplementation
 		cert       pki.StorageImplementation
@@ -142,8 +145,8 @@ G/7g4koczXLoUM3OQXd5Aq2cs4SS1vODrYmgbioFsQ3eDHd1fg==
 				cert:       tt.fields.cert,
 				privateKey: tt.fields.privateKey,
 			}
-			if err := f.writeToIndividualSlots(tt.args.certData); (err != nil) != tt.wantErr {
-				t.Errorf("writeToIndividualSlots() error = %v, wantErr %v", err, tt.wantErr)
+			if err := f.WriteCert(tt.args.certData); (err != nil) != tt.wantErr {
+				t.Errorf("WriteCert() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 			if tt.fields.privateKey != nil {
@@ -170,7 +173,7 @@ G/7g4koczXLoUM3OQXd5Aq2cs4SS1vODrYmgbioFsQ3eDHd1fg==
 	}
 }
 
-func TestKeyPairSink_writeToPrivateSlot(t *testing.T) {
+func TestKeyPairSink_WriteCertPrivateSlot(t *testing.T) {
 	type fields struct {
 		ca         pki.StorageImplementation
 		cert       pki.StorageImplementation
@@ -227,8 +230,8 @@ QN351pgTphi6nlCkGPzkDuwvtxSxiCWXQcaxrHAL7MiJpPzkIBq1
 				cert:       tt.fields.cert,
 				privateKey: tt.fields.privateKey,
 			}
-			if err := f.writeToPrivateSlot(tt.args.certData); (err != nil) != tt.wantErr {
-				t.Errorf("writeToPrivateSlot() error = %v, wantErr %v", err, tt.wantErr)
+			if err := f.WriteCert(tt.args.certData); (err != nil) != tt.wantErr {
+				t.Errorf("WriteCert() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 			if tt.fields.privateKey != nil {
@@ -255,7 +258,7 @@ QN351pgTphi6nlCkGPzkDuwvtxSxiCWXQcaxrHAL7MiJpPzkIBq1
 	}
 }
 
-func TestKeyPairSink_writeToCertAndCaSlot(t *testing.T) {
+func TestKeyPairSink_WriteCertCertAndCaSlot(t *testing.T) {
 	type fields struct {
 		ca         pki.StorageImplementation
 		cert       pki.StorageImplementation
@@ -313,8 +316,8 @@ QN351pgTphi6nlCkGPzkDuwvtxSxiCWXQcaxrHAL7MiJpPzkIBq1
 				cert:       tt.fields.cert,
 				privateKey: tt.fields.privateKey,
 			}
-			if err := f.writeToCertAndCaSlot(tt.args.certData); (err != nil) != tt.wantErr {
-				t.Errorf("writeToCertAndCaSlot() error = %v, wantErr %v", err, tt.wantErr)
+			if err := f.WriteCert(tt.args.certData); (err != nil) != tt.wantErr {
+				t.Errorf("WriteCert() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 			if tt.fields.privateKey != nil {
@@ -340,3 +343,48 @@ QN351pgTphi6nlCkGPzkDuwvtxSxiCWXQcaxrHAL7MiJpPzkIBq1
 		})
 	}
 }
+
+func TestKeyPairStorage_Rollback(t *testing.T) {
+	dir := t.TempDir()
+	certStorage := &backend.FilesystemStorage{FilePath: filepath.Join(dir, "cert.pem"), Mode: 0600, Backups: 1}
+	keyStorage := &backend.FilesystemStorage{FilePath: filepath.Join(dir, "key.pem"), Mode: 0600, Backups: 1}
+	storage, err := NewKeyPairStorage(certStorage, keyStorage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.WriteCert(&pkg.CertData{Certificate: []byte("cert1"), PrivateKey: []byte("key1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Rollback(); !errors.Is(err, ErrNoBackup) {
+		t.Fatalf("Rollback() error = %v, want %v", err, ErrNoBackup)
+	}
+
+	if err := storage.WriteCert(&pkg.CertData{Certificate: []byte("cert2"), PrivateKey: []byte("key2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Rollback(); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	for path, want := range map[string]string{certStorage.FilePath: "cert1\n", keyStorage.FilePath: "key1\n"} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestKeyPairStorage_RollbackUnsupported(t *testing.T) {
+	storage, err := NewKeyPairStorage(nil, &backend.BufferPod{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Rollback(); err == nil {
+		t.Error("expected error rolling back storage without backups")
+	}
+}
@@ -0,0 +1,39 @@
+package shape
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+)
+
+// OcspStorage reads the certificate from an existing keypair storage and writes DER encoded OCSP responses to a
+// dedicated storage, e.g. a stapling file next to the certificate.
+type OcspStorage struct {
+	certs pki.IssueStorage
+	ocsp  pki.StorageImplementation
+}
+
+func NewOcspStorage(certs pki.IssueStorage, ocsp pki.StorageImplementation) (*OcspStorage, error) {
+	if certs == nil {
+		return nil, errors.New("empty cert storage provided")
+	}
+	if ocsp == nil {
+		return nil, errors.New("empty ocsp storage provided")
+	}
+
+	return &OcspStorage{certs: certs, ocsp: ocsp}, nil
+}
+
+func (o *OcspStorage) ReadCert() (*x509.Certificate, error) {
+	return o.certs.ReadCert()
+}
+
+func (o *OcspStorage) WriteOcspResponse(der []byte) error {
+	// the DER encoded response must not be altered, e.g. by a trailing newline
+	if raw, ok := o.ocsp.(pki.RawStorage); ok {
+		return raw.WriteRaw(der)
+	}
+
+	return o.ocsp.Write(der)
+}
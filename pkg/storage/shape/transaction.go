@@ -0,0 +1,147 @@
+package shape
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+)
+
+// slotWrite is the data that is written to a single storage slot.
+type slotWrite struct {
+	storage pki.StorageImplementation
+	data    []byte
+}
+
+// transaction writes to multiple slots all-or-nothing. The data of all slots is staged first and only committed once
+// all slots have been staged successfully. If committing a slot fails, the slots that have been committed already are
+// rolled back.
+type transaction struct {
+	writes   []slotWrite
+	parallel bool
+}
+
+func (t *transaction) run() error {
+	staged := make([]pki.StagedWrite, len(t.writes))
+	errs := t.each(func(index int) error {
+		var err error
+		staged[index], err = stage(t.writes[index])
+		return err
+	})
+	if err := errors.Join(errs...); err != nil {
+		return errors.Join(err, t.rollback(staged))
+	}
+
+	errs = t.each(func(index int) error {
+		return staged[index].Commit()
+	})
+	if err := errors.Join(errs...); err != nil {
+		// rolling back restores the committed writes, including failed commits that may have replaced the data
+		// partially, and discards the writes that have not been committed
+		return errors.Join(err, t.rollback(staged))
+	}
+
+	return nil
+}
+
+// each calls fn for each write, either sequentially, stopping at the first error, or in parallel.
+func (t *transaction) each(fn func(index int) error) []error {
+	errs := make([]error, len(t.writes))
+	if !t.parallel {
+		for index := range t.writes {
+			if errs[index] = fn(index); errs[index] != nil {
+				break
+			}
+		}
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	for index := range t.writes {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			errs[index] = fn(index)
+		}(index)
+	}
+	wg.Wait()
+	return errs
+}
+
+// rollback rolls back the given writes in reverse order, nil entries are skipped.
+func (t *transaction) rollback(staged []pki.StagedWrite) error {
+	var errs []error
+	for index := len(staged) - 1; index >= 0; index-- {
+		if staged[index] == nil {
+			continue
+		}
+		if err := staged[index].Rollback(); err != nil {
+			errs = append(errs, fmt.Errorf("could not roll back write: %w", err))
+		}
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		log.Error().Err(err).Msg("Rolling back the transaction failed, the storage may be inconsistent")
+	}
+	return err
+}
+
+func stage(write slotWrite) (pki.StagedWrite, error) {
+	if transactional, ok := write.storage.(pki.TransactionalStorage); ok {
+		return transactional.Stage(write.data)
+	}
+
+	return stageOverwrite(write)
+}
+
+// overwrite emulates a staged write for storage implementations that do not support staging: the previous data is
+// read when staging and written back on rollback. If there was no previous data, the storage is cleared on rollback,
+// which requires it to implement pki.ClearableStorage. Otherwise, the data of the rolled back write is kept.
+type overwrite struct {
+	storage     pki.StorageImplementation
+	data        []byte
+	previous    []byte
+	hasPrevious bool
+	committed   bool
+}
+
+func stageOverwrite(write slotWrite) (pki.StagedWrite, error) {
+	ret := &overwrite{storage: write.storage, data: write.data}
+
+	previous, err := write.storage.Read()
+	if err == nil {
+		ret.previous = previous
+		ret.hasPrevious = true
+	} else if !errors.Is(err, pkg.ErrNoCertFound) {
+		// writes to storages that can not be read still succeed, they just can not be rolled back
+		log.Warn().Err(err).Msg("Could not read previous data, it can not be restored on rollback")
+	}
+
+	return ret, nil
+}
+
+func (o *overwrite) Commit() error {
+	o.committed = true
+	return o.storage.Write(o.data)
+}
+
+func (o *overwrite) Rollback() error {
+	if !o.committed {
+		return nil
+	}
+
+	if o.hasPrevious {
+		return o.storage.Write(o.previous)
+	}
+
+	if clearable, ok := o.storage.(pki.ClearableStorage); ok {
+		return clearable.Clear()
+	}
+
+	log.Warn().Msg("Storage can not be cleared, keeping the data of the rolled back write")
+	return nil
+}
@@ -0,0 +1,154 @@
+package shape
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soerenschneider/vault-pki-cli/pkg"
+	"github.com/soerenschneider/vault-pki-cli/pkg/pki"
+	"github.com/soerenschneider/vault-pki-cli/pkg/storage/backend"
+)
+
+// failingStorage wraps a BufferPod and fails writing once the configured number of writes has been reached.
+type failingStorage struct {
+	backend.BufferPod
+	writes    int
+	failAfter int
+}
+
+func (s *failingStorage) Write(data []byte) error {
+	if s.writes >= s.failAfter {
+		return errors.New("disk full")
+	}
+	s.writes++
+	return s.BufferPod.Write(data)
+}
+
+func readString(t *testing.T, storage pki.StorageImplementation) string {
+	t.Helper()
+	data, err := storage.Read()
+	if err != nil && !errors.Is(err, pkg.ErrNoCertFound) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestKeyPairStorage_WriteCertRollsBackOnFailure(t *testing.T) {
+	certStorage := &backend.BufferPod{Data: []byte("old cert\n")}
+	caStorage := &backend.BufferPod{Data: []byte("old ca\n")}
+	keyStorage := &failingStorage{BufferPod: backend.BufferPod{Data: []byte("old key\n")}}
+
+	storage, err := NewKeyPairStorage(certStorage, keyStorage, caStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.WriteCert(&pkg.CertData{Certificate: []byte("new cert"), CaData: []byte("new ca"), PrivateKey: []byte("new key")})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	for name, tc := range map[string]struct {
+		storage pki.StorageImplementation
+		want    string
+	}{
+		"cert": {certStorage, "old cert\n"},
+		"ca":   {caStorage, "old ca\n"},
+		"key":  {keyStorage, "old key\n"},
+	} {
+		if got := readString(t, tc.storage); got != tc.want {
+			t.Errorf("%s = %q, want %q", name, got, tc.want)
+		}
+	}
+}
+
+func TestKeyPairStorage_WriteCertRollsBackFirstWrite(t *testing.T) {
+	certStorage := &backend.BufferPod{}
+	caStorage := &backend.BufferPod{}
+	keyStorage := &failingStorage{}
+
+	storage, err := NewKeyPairStorage(certStorage, keyStorage, caStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.WriteCert(&pkg.CertData{Certificate: []byte("new cert"), CaData: []byte("new ca"), PrivateKey: []byte("new key")})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// there was no previous data, rolling back clears the slots
+	for name, slot := range map[string]pki.StorageImplementation{"cert": certStorage, "ca": caStorage, "key": keyStorage} {
+		if got := readString(t, slot); got != "" {
+			t.Errorf("%s = %q, want empty slot", name, got)
+		}
+	}
+}
+
+func TestKeyPairStorage_WriteCertRollsBackFiles(t *testing.T) {
+	dir := t.TempDir()
+	certStorage := &backend.FilesystemStorage{FilePath: filepath.Join(dir, "cert.pem"), Mode: 0600, Backups: 1}
+	keyStorage := &backend.FilesystemStorage{FilePath: filepath.Join(dir, "missing", "key.pem"), Mode: 0600}
+
+	if err := certStorage.Write([]byte("old cert")); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := NewKeyPairStorage(certStorage, keyStorage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// staging the key fails as its directory does not exist, the cert must not be touched
+	if err := storage.WriteCert(&pkg.CertData{Certificate: []byte("new cert"), PrivateKey: []byte("new key")}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if got := readString(t, certStorage); got != "old cert\n" {
+		t.Errorf("cert = %q, want %q", got, "old cert\n")
+	}
+	if certStorage.HasBackup() {
+		t.Error("no backup expected, the cert has not been replaced")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no leftover temporary files, got %d entries", len(entries))
+	}
+}
+
+func TestMultiKeyPairStorage_WriteCert(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		first := &backend.BufferPod{Data: []byte("old\n")}
+		second := &failingStorage{BufferPod: backend.BufferPod{Data: []byte("old\n")}}
+
+		firstSink, _ := NewKeyPairStorage(nil, first, nil)
+		secondSink, _ := NewKeyPairStorage(nil, second, nil)
+		storage, err := NewMultiKeyPairSink([]*KeyPairStorage{firstSink, secondSink}, WithParallelWrites(parallel))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := storage.WriteCert(&pkg.CertData{Certificate: []byte("cert"), PrivateKey: []byte("key")}); err == nil {
+			t.Fatalf("parallel=%t: expected error", parallel)
+		}
+		if got := readString(t, first); got != "old\n" {
+			t.Errorf("parallel=%t: first sink = %q, want it to be rolled back", parallel, got)
+		}
+
+		second.failAfter = 1
+		if err := storage.WriteCert(&pkg.CertData{Certificate: []byte("cert"), PrivateKey: []byte("key")}); err != nil {
+			t.Fatalf("parallel=%t: WriteCert() error = %v", parallel, err)
+		}
+		for _, sink := range []pki.StorageImplementation{first, second} {
+			if got := readString(t, sink); got != "cert\nkey\n" {
+				t.Errorf("parallel=%t: sink = %q", parallel, got)
+			}
+		}
+	}
+}
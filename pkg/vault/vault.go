@@ -150,6 +150,13 @@ func buildSignArgs(csr string, args pkg.SignatureArgs) map[string]interface{} {
 		"alt_names":   strings.Join(args.AltNames, ","),
 	}
 
+	if len(args.KeyUsages) > 0 {
+		data["key_usage"] = strings.Join(args.KeyUsages, ",")
+	}
+	if len(args.ExtKeyUsages) > 0 {
+		data["ext_key_usage"] = strings.Join(args.ExtKeyUsages, ",")
+	}
+
 	return data
 }
 
@@ -340,8 +347,21 @@ func (c *VaultPki) FetchCaChain() ([]byte, error) {
 	return c.readRaw(path)
 }
 
-func (c *VaultPki) FetchCrl(binary bool) ([]byte, error) {
-	path := fmt.Sprintf("%s/crl", c.pkiMountPath)
+func (c *VaultPki) FetchCrl(kind pkg.CrlKind, binary bool) ([]byte, error) {
+	var path string
+	switch kind {
+	case pkg.CrlBase:
+		path = fmt.Sprintf("%s/crl", c.pkiMountPath)
+	case pkg.CrlDelta:
+		path = fmt.Sprintf("%s/crl/delta", c.pkiMountPath)
+	case pkg.CrlUnified:
+		path = fmt.Sprintf("%s/unified-crl", c.pkiMountPath)
+	case pkg.CrlUnifiedDelta:
+		path = fmt.Sprintf("%s/unified-crl/delta", c.pkiMountPath)
+	default:
+		return nil, backoff.Permanent(fmt.Errorf("unknown crl kind '%s'", kind))
+	}
+
 	if !binary {
 		path += "/pem"
 	}